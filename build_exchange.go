@@ -1,5 +1,7 @@
 package cicd
 
+import "time"
+
 const (
 	// TaskTest is a command to test application
 	TaskTest = "test"
@@ -21,6 +23,34 @@ type BuildRequest struct {
 	CommitHash string  `json:"commitHash"`
 	Task       string  `json:"task"`
 	Version    *string `json:"version"` // Version is actual only for TaskDeploy
+
+	// Priority defines order of processing, tasks with higher priority are processed first.
+	// Deploys have priority 10 and tests have priority 0 by default, priority has to be from -10 to 10.
+	Priority *int `json:"priority,omitempty"`
+
+	// RepositoryURL is a remote URL of the repository on any git host (HTTPS or SSH),
+	// the repository is fetched from GitHub by username and repository if it is empty
+	RepositoryURL string `json:"repositoryURL,omitempty"`
+
+	// Branch is a branch or another ref of the commit, e.g. master or refs/pull/1/head.
+	// If the service supersedes stale builds, queued builds of the same branch are cancelled by the new one.
+	Branch string `json:"branch,omitempty"`
+
+	// Timeout and StepTimeout limit execution time (in seconds) of the whole build and of every its step,
+	// default limits of the service are used if they are not set
+	Timeout     int `json:"timeout,omitempty"`
+	StepTimeout int `json:"stepTimeout,omitempty"`
+
+	// Matrix makes a build of every combination of Go versions and platforms of the matrix,
+	// it overrides the matrix of the pipeline file of the repository
+	Matrix *Matrix `json:"matrix,omitempty"`
+}
+
+// Matrix declares cells of a matrix build, every combination of a Go version and a platform is built separately.
+// Cells are built for the default toolchain or the platform of the service if the list is empty.
+type Matrix struct {
+	Go        []string `json:"go,omitempty" yaml:"go"`               // Go are versions of toolchains installed on the service, e.g. 1.11
+	Platforms []string `json:"platforms,omitempty" yaml:"platforms"` // Platforms are GOOS/GOARCH pairs, e.g. linux/arm64
 }
 
 // BuildResponse defines response body of Build API method
@@ -34,3 +64,66 @@ type BuildResponse struct {
 type Build struct {
 	RequestID string `json:"requestID"`
 }
+
+// BuildRecordResponse defines response body of GetBuild API method
+type BuildRecordResponse struct {
+	Error *Error       `json:"error,omitempty"`
+	Data  *BuildRecord `json:"data,omitempty"`
+}
+
+// BuildRecord contains information about a build: its request, current state and history
+type BuildRecord struct {
+	RequestID  string `json:"requestID"`
+	Username   string `json:"username"`
+	Repository string `json:"repository"`
+	CommitHash string `json:"commitHash"`
+	Task       string `json:"task"`
+	Version    string `json:"version,omitempty"`
+
+	RepositoryURL string `json:"repositoryURL,omitempty"`
+	Branch        string `json:"branch,omitempty"`
+	Priority      int    `json:"priority"`
+
+	State    string `json:"state"`              // State is the last reported state of the build
+	Step     string `json:"step,omitempty"`     // Step is the step which is processing now
+	ExitStep string `json:"exitStep,omitempty"` // ExitStep is the last step of the finished build
+	Summary  string `json:"summary,omitempty"`  // Summary is a short description of the failed build
+	WorkerID *int   `json:"workerID,omitempty"` // WorkerID is an ID of the worker which took the build
+	LogRef   string `json:"logRef,omitempty"`   // LogRef is a reference to the full log of the build
+
+	QueuedAt   time.Time  `json:"queuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	Artifacts []Artifact  `json:"artifacts,omitempty"` // Artifacts are files collected by stages of the pipeline
+	Tests     *TestReport `json:"tests,omitempty"`     // Tests are results of tests if the build reported them
+	Coverage  *Coverage   `json:"coverage,omitempty"`  // Coverage is coverage of the code by tests if it is collected
+
+	Parent string      `json:"parent,omitempty"` // Parent is a request ID of the matrix build which the cell belongs to
+	Cell   string      `json:"cell,omitempty"`   // Cell is a name of the cell of the matrix build, e.g. go1.11 linux/arm64
+	Cells  []BuildCell `json:"cells,omitempty"`  // Cells are builds of cells of the matrix build
+}
+
+// BuildCell describes a build of a cell of the matrix build
+type BuildCell struct {
+	RequestID string `json:"requestID"`
+	Name      string `json:"name"`
+	State     string `json:"state"`
+}
+
+// Artifact describes a file collected after a successful stage of the build
+type Artifact struct {
+	Name   string `json:"name"`   // Name is a path of the file relative to the root of the repository
+	Stage  string `json:"stage"`  // Stage is a name of the stage which produced the file
+	Size   int64  `json:"size"`   // Size of the file in bytes
+	SHA256 string `json:"sha256"` // SHA256 is a hex encoded checksum of the file
+
+	// DownloadRef is a reference to download the file, it is empty if the file is removed by retention rules
+	DownloadRef string `json:"downloadRef,omitempty"`
+}
+
+// ArtifactsResponse defines response body of GetArtifacts API method
+type ArtifactsResponse struct {
+	Error *Error     `json:"error,omitempty"`
+	Data  []Artifact `json:"data,omitempty"`
+}
@@ -0,0 +1,147 @@
+// Package coverage parses coverage profiles of `go test -coverprofile` and checks thresholds of coverage
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/k8s-community/cicd"
+)
+
+// Thresholds restrict coverage of builds
+type Thresholds struct {
+	Minimum float64 // Minimum is a minimal total coverage in percent, it isn't checked if zero
+	MaxDrop float64 // MaxDrop is an allowed drop of total coverage in percent against the base
+}
+
+// block is a counted block of statements of the profile
+type block struct {
+	statements int
+	count      int
+}
+
+// Parse reads the coverage profile and computes coverage of packages and total coverage.
+// Blocks which are repeated in the profile (e.g. with -coverpkg) are counted once.
+func Parse(r io.Reader) (*cicd.Coverage, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if scanner.Err() != nil {
+			return nil, scanner.Err()
+		}
+		return nil, fmt.Errorf("coverage profile is empty")
+	}
+	if !strings.HasPrefix(scanner.Text(), "mode: ") {
+		return nil, fmt.Errorf("coverage profile doesn't start with mode")
+	}
+
+	blocks := make(map[string]block)
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 {
+			continue
+		}
+
+		// name.go:line.column,line.column statements count
+		fields := strings.Fields(text)
+		if len(fields) != 3 || !strings.Contains(fields[0], ":") {
+			return nil, fmt.Errorf("wrong line %d of coverage profile: %q", line, text)
+		}
+		statements, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("wrong number of statements in line %d of coverage profile: %s", line, err)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("wrong count in line %d of coverage profile: %s", line, err)
+		}
+
+		b := blocks[fields[0]]
+		b.statements = statements
+		if count > b.count {
+			b.count = count
+		}
+		blocks[fields[0]] = b
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	packages := make(map[string]*cicd.PackageCoverage)
+	c := &cicd.Coverage{}
+	for position, b := range blocks {
+		name := path.Dir(position[:strings.LastIndex(position, ":")])
+		p, ok := packages[name]
+		if !ok {
+			p = &cicd.PackageCoverage{Name: name}
+			packages[name] = p
+		}
+
+		p.Statements += b.statements
+		c.Statements += b.statements
+		if b.count > 0 {
+			p.Covered += b.statements
+			c.Covered += b.statements
+		}
+	}
+
+	for _, p := range packages {
+		p.Total = percent(p.Covered, p.Statements)
+		c.Packages = append(c.Packages, *p)
+	}
+	sort.Slice(c.Packages, func(i, j int) bool {
+		return c.Packages[i].Name < c.Packages[j].Name
+	})
+	c.Total = percent(c.Covered, c.Statements)
+
+	return c, nil
+}
+
+// Compare sets the base of the coverage and the difference with it
+func Compare(c *cicd.Coverage, base cicd.CoverageBase) {
+	delta := round(c.Total - base.Total)
+	c.Base = &base
+	c.Delta = &delta
+}
+
+// Check returns descriptions of violated thresholds, the drop is checked only if the coverage has the base
+func Check(c *cicd.Coverage, thresholds Thresholds) []string {
+	var violations []string
+	if thresholds.Minimum > 0 && c.Total < thresholds.Minimum {
+		violations = append(violations, fmt.Sprintf("coverage %.1f%% is below %.1f%%", c.Total, thresholds.Minimum))
+	}
+	if c.Base != nil && c.Delta != nil && *c.Delta < -thresholds.MaxDrop {
+		violations = append(violations, fmt.Sprintf("coverage dropped by %.1f%% against %s", -*c.Delta, c.Base.Branch))
+	}
+	return violations
+}
+
+// Describe returns a short description of the coverage with its warnings,
+// e.g. "Coverage 75.2% (-1.3% vs master), warning: coverage 75.2% is below 80.0%"
+func Describe(c *cicd.Coverage) string {
+	s := fmt.Sprintf("Coverage %.1f%%", c.Total)
+	if c.Base != nil && c.Delta != nil {
+		s += fmt.Sprintf(" (%+.1f%% vs %s)", *c.Delta, c.Base.Branch)
+	}
+	if len(c.Warnings) > 0 {
+		s += ", warning: " + strings.Join(c.Warnings, ", ")
+	}
+	return s
+}
+
+func percent(covered, statements int) float64 {
+	if statements == 0 {
+		return 0
+	}
+	return round(float64(covered) * 100 / float64(statements))
+}
+
+// round rounds the percent to hundredths, so differences of equal coverages are zero
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,74 @@
+package coverage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/k8s-community/cicd"
+)
+
+const profile = `mode: atomic
+example.com/app/main.go:10.13,12.2 2 1
+example.com/app/main.go:14.13,16.2 2 0
+example.com/app/pkg/lib.go:3.20,5.2 1 0
+example.com/app/pkg/lib.go:7.20,9.2 3 4
+example.com/app/pkg/lib.go:3.20,5.2 1 2
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(profile))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if c.Statements != 8 || c.Covered != 6 || c.Total != 75 {
+		t.Errorf("Unexpected total coverage: %+v", c)
+	}
+	expected := []cicd.PackageCoverage{
+		{Name: "example.com/app", Total: 50, Statements: 4, Covered: 2},
+		{Name: "example.com/app/pkg", Total: 100, Statements: 4, Covered: 4},
+	}
+	if len(c.Packages) != len(expected) {
+		t.Fatalf("Unexpected packages: %+v", c.Packages)
+	}
+	for i, p := range expected {
+		if c.Packages[i] != p {
+			t.Errorf("Expected %+v, got %+v", p, c.Packages[i])
+		}
+	}
+
+	for _, wrong := range []string{"", "example.com/app/main.go:10.13,12.2 2 1\n", "mode: set\nmain.go 2 1\n", "mode: set\nmain.go:1.1,2.2 x 1\n"} {
+		if _, err := Parse(strings.NewReader(wrong)); err == nil {
+			t.Errorf("Expected error for profile %q", wrong)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	c := &cicd.Coverage{Total: 75.25}
+	if violations := Check(c, Thresholds{Minimum: 70}); len(violations) != 0 {
+		t.Errorf("Unexpected violations %v", violations)
+	}
+	if Describe(c) != "Coverage 75.2%" {
+		t.Errorf("Unexpected description %q", Describe(c))
+	}
+
+	Compare(c, cicd.CoverageBase{Branch: "master", RequestID: "1", Total: 77})
+	if *c.Delta != -1.75 {
+		t.Errorf("Unexpected delta %v", *c.Delta)
+	}
+
+	violations := Check(c, Thresholds{Minimum: 80, MaxDrop: 1})
+	expected := []string{"coverage 75.2% is below 80.0%", "coverage dropped by 1.8% against master"}
+	if strings.Join(violations, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected violations %v, got %v", expected, violations)
+	}
+	if violations := Check(c, Thresholds{MaxDrop: 2}); len(violations) != 0 {
+		t.Errorf("Unexpected violations %v", violations)
+	}
+
+	c.Warnings = violations[:1]
+	if d := Describe(c); d != "Coverage 75.2% (-1.8% vs master), warning: coverage 75.2% is below 80.0%" {
+		t.Errorf("Unexpected description %q", d)
+	}
+}
@@ -1,11 +1,14 @@
 package builder
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/store"
 	"github.com/k8s-community/cicd/builder/task"
 )
 
@@ -15,20 +18,81 @@ type Dispatcher struct {
 
 	workers []*worker      // workers to process the tasks
 	pool    chan task.CICD // Tasks processing by workers
+	idle    chan struct{}  // Tokens of idle workers, a task is picked from the "waiting" queue only with a token
 
-	mxQueues    *sync.RWMutex        // Mutex to protect inProgress and waiting queues
-	inProgress  map[string]task.CICD // Tasks which are currently in progress
-	waiting     []task.CICD          // Tasks which are waiting for free worker
-	reassigning map[string]task.CICD
+	mxQueues   *sync.RWMutex                 // Mutex to protect inProgress and waiting queues
+	inProgress map[string]task.CICD          // Tasks which are currently in progress
+	waiting    []task.CICD                   // Tasks which are waiting for free worker, see pick for order of processing
+	cancels    map[string]context.CancelFunc // Functions to cancel tasks which are not processed yet, protected by mxQueues
 
-	waitingQueueReady chan struct{} // Event marking what waiting queue is not empty
+	// Tasks which are waiting until previous tasks of the same repo are processed, in order of adding.
+	// The repo has a record here while its task is in the "waiting" or "inProgress" queue.
+	repoQueues map[string][]task.CICD
+
+	served        map[string]uint64 // Number of the last task of every namespace sent to workers, protected by mxQueues
+	servedCounter uint64            // Number of tasks sent to workers, protected by mxQueues
+
+	waitingQueueReady chan struct{} // Event marking what waiting queue is not empty, see signal
 
 	mxShuttingDown *sync.RWMutex
 	isShuttingDown bool // Flag marking what state has to stop working
 
 	wgWorkersStopped *sync.WaitGroup // WaitGroup is waiting for workers stopping
 
-	medianProcessorExecTime time.Duration
+	queue              store.Queue // Store to keep queues between restarts, nil if queues live only in memory
+	requeueInterrupted bool        // Flag marking what tasks interrupted by restart have to be processed again
+
+	parallelRepoTasks bool // Flag marking what tasks of the same repo might be processed in the same time
+
+	supersede        bool // Flag marking what new tasks cancel queued tasks of the same branch
+	supersedeRunning bool // Flag marking what new tasks cancel also running tasks of the same branch
+
+	// Reasons of cancellation of running tasks by the dispatcher, protected by mxQueues
+	cancellations map[string]cancellation
+
+	mxMatrices *sync.Mutex           // Mutex to protect matrices, it is never locked together with mxQueues
+	matrices   map[string]*task.CICD // Matrix builds which wait until their cells are built
+
+	shutdownOnce *sync.Once
+	stopped      chan struct{} // Event marking what Shutdown is done
+}
+
+// cancellation is a state and a description reported instead of ones of the runner
+// when the dispatcher cancels the running task
+type cancellation struct {
+	state       string
+	description string
+}
+
+// Option defines optional parameters of the Dispatcher
+type Option func(state *Dispatcher)
+
+// WithQueueStore makes the Dispatcher save its queues to the store.
+// Tasks which were in progress during a restart are processed again if requeueInterrupted is true,
+// otherwise they are marked as errored.
+func WithQueueStore(queue store.Queue, requeueInterrupted bool) Option {
+	return func(state *Dispatcher) {
+		state.queue = queue
+		state.requeueInterrupted = requeueInterrupted
+	}
+}
+
+// WithParallelRepoTasks allows to process tasks of the same repo in the same time.
+// It is safe only if the runner processes every task in its own workspace.
+func WithParallelRepoTasks() Option {
+	return func(state *Dispatcher) {
+		state.parallelRepoTasks = true
+	}
+}
+
+// WithSupersede makes new tasks cancel queued tasks of the same repo, branch and type,
+// only the newest commit of the branch is processed. Running tasks are cancelled too if cancelRunning is true.
+// Tasks without a branch are never superseded.
+func WithSupersede(cancelRunning bool) Option {
+	return func(state *Dispatcher) {
+		state.supersede = true
+		state.supersedeRunning = cancelRunning
+	}
 }
 
 // NewDispatcher creates new Dispatcher instance with the parameters:
@@ -38,31 +102,71 @@ type Dispatcher struct {
 // - list of processing tasks and a mutex to deal with them
 // - list of 'to do' tasks and a mutex to deal with them
 // - shutdown channel to mark that service is not available for tasks anymore
-func NewDispatcher(processor Processor, logger logrus.FieldLogger, maxWorkers int, waitBeforeReassign time.Duration) *Dispatcher {
+// - options to set up optional parameters, e.g. WithQueueStore
+func NewDispatcher(processor Processor, logger logrus.FieldLogger, maxWorkers int, options ...Option) *Dispatcher {
 	state := &Dispatcher{
 		logger: logger,
 
-		pool: make(chan task.CICD, maxWorkers),
+		pool: make(chan task.CICD),
+		idle: make(chan struct{}, maxWorkers),
 
 		mxQueues:   &sync.RWMutex{},
 		inProgress: make(map[string]task.CICD),
 
-		waitingQueueReady: make(chan struct{}),
+		served: make(map[string]uint64),
 
-		reassigning: make(map[string]task.CICD),
+		waitingQueueReady: make(chan struct{}, 1),
+
+		repoQueues:    make(map[string][]task.CICD),
+		cancels:       make(map[string]context.CancelFunc),
+		cancellations: make(map[string]cancellation),
+
+		mxMatrices: &sync.Mutex{},
+		matrices:   make(map[string]*task.CICD),
 
 		mxShuttingDown: &sync.RWMutex{},
 		isShuttingDown: false,
 
 		wgWorkersStopped: &sync.WaitGroup{},
 
-		medianProcessorExecTime: waitBeforeReassign,
+		shutdownOnce: &sync.Once{},
+		stopped:      make(chan struct{}),
+	}
+
+	for _, option := range options {
+		option(state)
+	}
+
+	process := func(t task.CICD) {
+		expanded := false
+		if t.Cell == nil {
+			t.Expand = func(cells []task.Cell) error {
+				expanded = true
+				return state.expandRunning(t, cells)
+			}
+		}
+
+		started := time.Now()
+		processor(t)
+		buildDuration.Observe(time.Since(started).Seconds(), typeLabel(t.Type))
+
+		state.release(t.ID)
+		if expanded {
+			// the matrix build is finished when its cells are built
+			return
+		}
+		state.forget(t.ID)
+		t.Finished()
 	}
 
 	state.wgWorkersStopped.Add(maxWorkers)
 
 	for i := 0; i < maxWorkers; i++ {
-		worker := newWorker(processor, logger, i, state.pool, state.mxQueues, state.inProgress, state.wgWorkersStopped)
+		state.idle <- struct{}{}
+	}
+
+	for i := 0; i < maxWorkers; i++ {
+		worker := newWorker(process, state.key, state.proceed, logger, i, state.pool, state.mxQueues, state.inProgress, state.wgWorkersStopped)
 		worker.run()
 
 		state.workers = append(state.workers, worker)
@@ -76,8 +180,51 @@ func NewDispatcher(processor Processor, logger logrus.FieldLogger, maxWorkers in
 // Shutdown makes 'graceful shutdown' of the dispatcher and the workers:
 // - Tasks, which are currently processing by the workers, will be finished
 // - New tasks will be rejected
-// - Scheduled tasks will be canceled
+// - Scheduled tasks will be canceled or kept in the queue store
 func (state *Dispatcher) Shutdown() {
+	state.Drain(context.Background())
+}
+
+// Drain makes the same 'graceful shutdown' as Shutdown, but running tasks are cancelled when ctx is done.
+// It is safe to call Drain several times, all calls return when the dispatcher is stopped.
+func (state *Dispatcher) Drain(ctx context.Context) {
+	state.shutdownOnce.Do(func() {
+		go state.shutdown()
+	})
+
+	select {
+	case <-state.stopped:
+		return
+	case <-ctx.Done():
+	}
+
+	state.logger.Info("Deadline of the shutdown is exceeded, cancel running tasks...")
+	state.mxQueues.Lock()
+	for _, taskItem := range state.inProgress {
+		if cancel, ok := state.cancels[taskItem.ID]; ok {
+			state.cancellations[taskItem.ID] = cancellation{
+				state:       task.StateError,
+				description: "CI/CD service is shutting down, please, try again later.",
+			}
+			cancel()
+		}
+	}
+	state.mxQueues.Unlock()
+
+	<-state.stopped
+}
+
+// IsShuttingDown returns true if the dispatcher doesn't accept new tasks anymore
+func (state *Dispatcher) IsShuttingDown() bool {
+	state.mxShuttingDown.RLock()
+	defer state.mxShuttingDown.RUnlock()
+
+	return state.isShuttingDown
+}
+
+func (state *Dispatcher) shutdown() {
+	defer close(state.stopped)
+
 	state.logger.Info("Dispatcher is preparing for shutdown...")
 
 	state.logger.Info("Mark that service is shutting down and couldn't receive tasks anymore...")
@@ -99,11 +246,22 @@ func (state *Dispatcher) Shutdown() {
 
 	state.logger.Info("Check if there are no tasks in the 'waiting' queue")
 	state.mxQueues.Lock()
-	for _, taskItem := range state.waiting {
+	waiting := state.waiting
+	for _, queued := range state.repoQueues {
+		waiting = append(waiting, queued...)
+	}
+	for _, taskItem := range waiting {
+		if state.queue != nil {
+			taskItem.Callback(taskItem.ID, task.StatePending, "CI/CD service is restarting, the task will be processed after restart.")
+			state.logger.Infof("Shutdown of 'waiting' queue: task %s is kept in the store", taskItem.ID)
+			continue
+		}
 		msg := state.cancelTask(&taskItem)
+		taskItem.Finished()
 		state.logger.Info("Shutdown of 'waiting' queue:" + msg)
 	}
-	state.waiting = state.waiting[:0]
+	state.waiting = nil
+	state.repoQueues = make(map[string][]task.CICD)
 	state.mxQueues.Unlock()
 	state.logger.Info("Done.")
 
@@ -111,62 +269,221 @@ func (state *Dispatcher) Shutdown() {
 	state.mxQueues.Lock()
 	for repo, taskItem := range state.inProgress {
 		msg := state.cancelTask(&taskItem)
+		taskItem.Finished()
 		state.logger.Info("Shutdown of 'in progress' queue: " + msg)
 		delete(state.inProgress, repo)
+		state.releaseLocked(taskItem.ID)
+		state.forget(taskItem.ID)
 	}
+	state.observeQueues()
 	state.mxQueues.Unlock()
 	state.logger.Info("Done")
 
-	state.logger.Info("Check if there are no tasks in the 'reAssign' queue...")
-	for {
-		state.mxQueues.Lock()
-		length := len(state.reassigning)
-		if length > 0 {
-			state.mxQueues.Unlock()
-			time.Sleep(state.medianProcessorExecTime)
-		} else {
-			state.mxQueues.Unlock()
-			break
-		}
-	}
-	state.logger.Info("Done.")
-
 	state.logger.Info("Dispatcher was shutdown successfully.")
 }
 
 // AddTask add Task to the pool.
+// If the task contains the matrix, every its cell is built by a task of its own instead of the task.
 func (state *Dispatcher) AddTask(t *task.CICD) error {
 	// check if service is shutting down
 	state.mxShuttingDown.Lock()
+	if state.isShuttingDown && state.queue != nil {
+		// we couldn't process task now, but it will be processed after restart
+		queue := store.QueueWaiting
+		if len(t.Matrix) > 0 {
+			queue = store.QueueMatrix
+		}
+		state.persist(*t, queue)
+		msg := fmt.Sprintf("Task %s will be processed after restart of the service", t.ID)
+		state.logger.Info("AddTask: " + msg)
+
+		state.mxShuttingDown.Unlock()
+		return errors.New(msg)
+	}
 	if state.isShuttingDown {
 		// we couldn't process task because service is shutting down
 		msg := state.cancelTask(t)
+		t.Finished()
 		state.logger.Info("AddTask: " + msg)
 
 		state.mxShuttingDown.Unlock()
-		return fmt.Errorf(msg)
+		return errors.New(msg)
 	}
 	state.mxShuttingDown.Unlock()
 
+	if len(t.Matrix) > 0 {
+		state.addMatrix(t)
+		return nil
+	}
+
 	logger := state.logger.WithField("task_id", t.ID)
 	logger.Infof("Add task %s to the waiting queue...", t.ID)
 
+	state.persist(*t, store.QueueWaiting)
+
 	state.mxQueues.Lock()
-	state.waiting = append(state.waiting, *t)
+	state.track(t)
+	superseded := state.supersedeQueued(*t)
+	state.enqueue(*t)
+	state.observeQueues()
 	state.mxQueues.Unlock()
 
-	state.waitingQueueReady <- struct{}{}
+	state.dropSuperseded(superseded, *t)
+	state.signal()
 	logger.Info("Task added.")
 
 	return nil
 }
 
-// GetTasks get Tasks to the pool.
-func (state *Dispatcher) GetTasks() (queue []string, progress []string, reassign []string) {
+// dropSuperseded marks the tasks removed from the queues as superseded by the new task
+func (state *Dispatcher) dropSuperseded(superseded []task.CICD, t task.CICD) {
+	for _, item := range superseded {
+		state.logger.WithField("task_id", item.ID).Infof("Task %s is superseded by task %s", item.ID, t.ID)
+		state.forget(item.ID)
+		item.Callback(item.ID, task.StateCancelled, task.SupersededPrefix+t.Commit)
+		item.Finished()
+	}
+}
+
+// Restore loads tasks saved in the queue store before the restart.
+// Callbacks can't be saved, so prepare function has to set them up for every restored task.
+// Matrix builds are restored with their cells, cells which are finished before the restart aren't built again.
+func (state *Dispatcher) Restore(prepare func(t *task.CICD)) error {
+	if state.queue == nil {
+		return nil
+	}
+
+	records, err := state.queue.List()
+	if err != nil {
+		return fmt.Errorf("couldn't load queue: %s", err)
+	}
+
+	// matrix builds have to wait for their cells before the cells are restored
+	for _, record := range records {
+		if record.Queue == store.QueueMatrix {
+			t := record.Task
+			prepare(&t)
+			state.logger.Infof("Restore: matrix build %s waits for its cells", t.ID)
+			state.restoreMatrix(t)
+		}
+	}
+
+	var restored []task.CICD
+	cells := make(map[string]bool)
+	for _, record := range records {
+		if record.Queue == store.QueueMatrix {
+			continue
+		}
+
+		t := record.Task
+		prepare(&t)
+		if len(t.Parent) > 0 {
+			state.watchCell(&t)
+			cells[t.ID] = true
+		}
+
+		if record.Queue == store.QueueInProgress && !state.requeueInterrupted {
+			t.Callback(t.ID, task.StateError, "Task was interrupted by restart of CI/CD service, please, try again.")
+			state.logger.Infof("Restore: task %s was interrupted and marked as errored", t.ID)
+			state.forget(t.ID)
+			t.Finished()
+			continue
+		}
+
+		state.logger.Infof("Restore: task %s is added to the waiting queue", t.ID)
+		state.persist(t, store.QueueWaiting)
+		restored = append(restored, t)
+	}
+
+	for _, t := range state.missingCells(cells) {
+		state.logger.Infof("Restore: cell %s of matrix build %s is added to the waiting queue", t.ID, t.Parent)
+		state.persist(t, store.QueueWaiting)
+		restored = append(restored, t)
+	}
+
+	state.mxQueues.Lock()
+	for i := range restored {
+		state.track(&restored[i])
+		state.enqueue(restored[i])
+	}
+	state.observeQueues()
+	state.mxQueues.Unlock()
+
+	state.signal()
+
+	return nil
+}
+
+// CancelTask cancels the task with given ID.
+// Task which is not started yet is removed from the queues and marked as cancelled,
+// runner of the task which is in progress receives a signal to stop processing.
+// All unfinished cells of the matrix build are cancelled if the task is a matrix build.
+func (state *Dispatcher) CancelTask(id string) error {
+	logger := state.logger.WithField("task_id", id)
+
+	if cells, ok := state.unfinishedCells(id); ok {
+		logger.Infof("Task %s is a matrix build, its cells are cancelled", id)
+		for _, cell := range cells {
+			state.CancelTask(cell)
+		}
+		return nil
+	}
+
+	state.mxQueues.Lock()
+
+	var t task.CICD
+	queued := false
+	for i, item := range state.waiting {
+		if item.ID == id {
+			t, queued = item, true
+			state.waiting = append(state.waiting[:i:i], state.waiting[i+1:]...)
+			// the next task of the repo mustn't wait for the cancelled one
+			state.promote(state.key(item))
+			break
+		}
+	}
+
+	for key, items := range state.repoQueues {
+		for i, item := range items {
+			if item.ID == id {
+				t, queued = item, true
+				state.repoQueues[key] = append(items[:i:i], items[i+1:]...)
+				break
+			}
+		}
+	}
+
+	// cancellation of the context signals the runner if the task is already in progress
+	_, ok := state.cancels[id]
+	state.releaseLocked(id)
+	state.observeQueues()
+	state.mxQueues.Unlock()
+
+	if !ok {
+		return fmt.Errorf("task %s is not found", id)
+	}
+
+	if queued {
+		logger.Infof("Task %s is removed from the queue", id)
+		state.signal()
+		state.forget(id)
+		t.Callback(t.ID, task.StateCancelled, "Task was cancelled.")
+		t.Finished()
+		return nil
+	}
+
+	logger.Infof("Task %s is in progress, its runner is signalled to stop", id)
+	return nil
+}
+
+// GetTasks returns tasks of the queues: waiting for a worker in order of processing, in progress
+// and blocked until previous tasks of the same repo are processed.
+func (state *Dispatcher) GetTasks() (queue []string, progress []string, blocked []string) {
 	state.mxQueues.Lock()
 	defer state.mxQueues.Unlock()
 
-	for _, item := range state.waiting {
+	for _, i := range order(state.waiting, state.served) {
+		item := state.waiting[i]
 		queue = append(queue, item.Prefix+"/"+item.Repo+": "+item.ID)
 	}
 
@@ -174,73 +491,216 @@ func (state *Dispatcher) GetTasks() (queue []string, progress []string, reassign
 		progress = append(progress, item.Prefix+"/"+item.Repo+": "+item.ID)
 	}
 
-	for _, item := range state.reassigning {
-		reassign = append(reassign, item.Prefix+"/"+item.Repo+": "+item.ID)
+	for _, items := range state.repoQueues {
+		for _, item := range items {
+			blocked = append(blocked, item.Prefix+"/"+item.Repo+": "+item.ID)
+		}
 	}
 
-	return queue, progress, reassign
+	return queue, progress, blocked
 }
 
-// processWaitingQueue gets task from the "waiting" queue.
-// For each repo only one task might be processing in the same time, so if the "inProgress" queue already contains
-// that repo, current task will not be added and will be moved to the end of the "waiting" queue.
-func (state *Dispatcher) processWaitingQueue() {
-	for {
-		select {
-		case <-state.waitingQueueReady:
-			state.logger.Info("WaitingQueue processor has caught what waiting queue is ready to be processed...")
+// Waiting returns tasks of the "waiting" queue in order of processing,
+// they are followed by tasks blocked until previous tasks of the same repo are processed
+func (state *Dispatcher) Waiting() []QueuedTask {
+	state.mxQueues.Lock()
+	defer state.mxQueues.Unlock()
 
-			state.mxQueues.Lock()
+	tasks := make([]QueuedTask, 0, len(state.waiting))
+	for position, i := range order(state.waiting, state.served) {
+		item := state.waiting[i]
+		tasks = append(tasks, QueuedTask{
+			ID:        item.ID,
+			Namespace: item.Namespace,
+			Repo:      item.Prefix + "/" + item.Repo,
+			Priority:  item.Priority,
+			Position:  position + 1,
+		})
+	}
 
-			// if there are no waiting tasks because of shutting down, just continue
-			if len(state.waiting) == 0 {
-				state.mxQueues.Unlock()
-				continue
+	for _, items := range state.repoQueues {
+		for _, item := range items {
+			tasks = append(tasks, QueuedTask{
+				ID:        item.ID,
+				Namespace: item.Namespace,
+				Repo:      item.Prefix + "/" + item.Repo,
+				Priority:  item.Priority,
+				Blocked:   true,
+			})
+		}
+	}
+
+	return tasks
+}
+
+// processWaitingQueue sends tasks from the "waiting" queue to the workers while there are tasks.
+// The task with the highest priority is taken first, namespaces with the same priority are served in turn.
+func (state *Dispatcher) processWaitingQueue() {
+	for range state.waitingQueueReady {
+		state.logger.Info("WaitingQueue processor has caught what waiting queue is ready to be processed...")
+
+		for {
+			// the task is picked only when a worker is idle,
+			// so tasks added meanwhile are able to overtake it by priority or fairness
+			<-state.idle
+			t, ok := state.next()
+			if !ok {
+				state.idle <- struct{}{}
+				break
 			}
 
-			t := state.waiting[0]
+			state.logger.WithField("task_id", t.ID).Debugf("Task %s is going to be processed...", t.ID)
+			state.persist(t, store.QueueInProgress)
+			select {
+			case state.pool <- t:
+			case <-state.stopped:
+				// the task is cancelled by Shutdown as a task in progress
+				return
+			}
+		}
+	}
+}
 
-			logger := state.logger.WithField("task_id", t.ID)
-			logger.Debugf("Task %s is getting from the waiting queue...", t.ID)
+// next moves the next task from the "waiting" queue to the "inProgress" queue
+func (state *Dispatcher) next() (task.CICD, bool) {
+	state.mxShuttingDown.RLock()
+	isShuttingDown := state.isShuttingDown
+	state.mxShuttingDown.RUnlock()
 
-			inProgress, ok := state.inProgress[t.Repo]
+	// tasks which are not started yet are kept or cancelled by Shutdown
+	if isShuttingDown {
+		return task.CICD{}, false
+	}
 
-			// Define if we can move task to the "in progress" queue
-			// (we can do it only if current repo is not in the "in progress" queue yet)
-			addToInProgress := false
-			if !ok || (inProgress.Repo != t.Repo) {
-				state.inProgress[t.Repo] = t
-				addToInProgress = true
-				logger.Debugf("Task %s is moving to the 'in progress' queue and is going to be processed...", t.ID)
-			}
+	state.mxQueues.Lock()
+	defer state.mxQueues.Unlock()
 
-			state.waiting = state.waiting[1:]
+	if len(state.waiting) == 0 {
+		return task.CICD{}, false
+	}
+
+	i := pick(state.waiting, state.served)
+	t := state.waiting[i]
+	state.waiting = append(state.waiting[:i:i], state.waiting[i+1:]...)
 
-			state.mxQueues.Unlock()
+	state.inProgress[state.key(t)] = t
+	state.servedCounter++
+	state.served[t.Namespace] = state.servedCounter
+	state.observeQueues()
 
-			// Send current task to the workers or move it back to the "waiting" queue
-			if addToInProgress {
-				state.pool <- t
-			} else {
-				go func() {
-					// Task processing takes some time, so to not to repeat the process too many times,
-					// just wait a little before re-add task to the waiting queue
-					state.mxQueues.Lock()
-					state.reassigning[t.ID] = t
-					state.mxQueues.Unlock()
+	return t, true
+}
+
+// enqueue adds the task to the "waiting" queue or, if the repo has a task in the queues already,
+// to the end of the queue of the repo. It has to be called under mxQueues lock.
+func (state *Dispatcher) enqueue(t task.CICD) {
+	key := state.key(t)
+	if queued, ok := state.repoQueues[key]; ok {
+		state.repoQueues[key] = append(queued, t)
+		return
+	}
+
+	state.repoQueues[key] = nil
+	state.waiting = append(state.waiting, t)
+}
+
+// supersedeQueued removes tasks superseded by the new task from the queues and returns them,
+// running tasks are signalled to stop if it is allowed. It has to be called under mxQueues lock.
+func (state *Dispatcher) supersedeQueued(t task.CICD) []task.CICD {
+	if !state.supersede || len(t.Branch) == 0 {
+		return nil
+	}
+
+	var superseded []task.CICD
+
+	// blocked tasks go first, so the tasks promoted instead of superseded ones are actual
+	for key, items := range state.repoQueues {
+		var kept []task.CICD
+		for _, item := range items {
+			if t.Supersedes(item) {
+				superseded = append(superseded, item)
+				continue
+			}
+			kept = append(kept, item)
+		}
+		state.repoQueues[key] = kept
+	}
 
-					time.Sleep(state.medianProcessorExecTime)
+	var waiting, heads []task.CICD
+	for _, item := range state.waiting {
+		if t.Supersedes(item) {
+			heads = append(heads, item)
+			continue
+		}
+		waiting = append(waiting, item)
+	}
+	state.waiting = waiting
+	for _, item := range heads {
+		// the next task of the repo mustn't wait for the superseded one
+		state.promote(state.key(item))
+	}
+	superseded = append(superseded, heads...)
 
-					state.AddTask(&t)
+	for _, item := range superseded {
+		state.releaseLocked(item.ID)
+	}
 
-					state.mxQueues.Lock()
-					delete(state.reassigning, t.ID)
-					state.mxQueues.Unlock()
-				}()
-				logger.Debugf("Task %s moved back to the 'waiting' queue.", t.ID)
+	if state.supersedeRunning {
+		for _, item := range state.inProgress {
+			if cancel, ok := state.cancels[item.ID]; ok && t.Supersedes(item) {
+				state.cancellations[item.ID] = cancellation{
+					state:       task.StateCancelled,
+					description: task.SupersededPrefix + t.Commit,
+				}
+				cancel()
 			}
 		}
 	}
+
+	return superseded
+}
+
+// promote moves the next task of the repo to the "waiting" queue, it has to be called under mxQueues lock
+func (state *Dispatcher) promote(key string) {
+	queued := state.repoQueues[key]
+	if len(queued) == 0 {
+		delete(state.repoQueues, key)
+		return
+	}
+
+	state.waiting = append(state.waiting, queued[0])
+	state.repoQueues[key] = queued[1:]
+}
+
+// proceed is called by a worker when the task is processed and removed from the "inProgress" queue,
+// the worker becomes idle and the next task of the same repo becomes available for the workers at once
+func (state *Dispatcher) proceed(t task.CICD) {
+	state.idle <- struct{}{}
+
+	state.mxQueues.Lock()
+	state.promote(state.key(t))
+	state.observeQueues()
+	state.mxQueues.Unlock()
+
+	state.signal()
+}
+
+// signal wakes the waiting queue processor up, it never blocks: if the processor is busy,
+// it has a pending signal already and will check the queue again
+func (state *Dispatcher) signal() {
+	select {
+	case state.waitingQueueReady <- struct{}{}:
+	default:
+	}
+}
+
+// key returns key of the task in the "inProgress" queue, tasks with the same key couldn't be processed in the same time.
+// Cells of matrix builds are processed in parallel, so they don't wait for each other and for their expanding parent.
+func (state *Dispatcher) key(t task.CICD) string {
+	if state.parallelRepoTasks || len(t.Parent) > 0 {
+		return t.ID
+	}
+	return t.Repo
 }
 
 func (state *Dispatcher) queueLen() int {
@@ -250,6 +710,78 @@ func (state *Dispatcher) queueLen() int {
 	return len(state.waiting)
 }
 
+// track prepares context to be able to cancel the task, it has to be called under mxQueues lock
+func (state *Dispatcher) track(t *task.CICD) {
+	if t.Context != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Context = ctx
+	state.cancels[t.ID] = cancel
+
+	// runners don't know why the task was cancelled, so the reason is set here
+	callback, taskType := t.Callback, t.Type
+	t.Callback = func(taskID string, status string, description string) {
+		if status == task.StateCancelled {
+			if reason, ok := state.cancellation(taskID); ok {
+				status, description = reason.state, reason.description
+			}
+		}
+		observeOutcome(taskType, status)
+		callback(taskID, status, description)
+	}
+}
+
+// cancellation returns the reason if the running task was cancelled by the dispatcher
+func (state *Dispatcher) cancellation(id string) (cancellation, bool) {
+	state.mxQueues.RLock()
+	defer state.mxQueues.RUnlock()
+
+	reason, ok := state.cancellations[id]
+	return reason, ok
+}
+
+// release frees resources of the context of processed task
+func (state *Dispatcher) release(id string) {
+	state.mxQueues.Lock()
+	state.releaseLocked(id)
+	delete(state.cancellations, id)
+	state.mxQueues.Unlock()
+}
+
+// releaseLocked is the same as release, but it has to be called under mxQueues lock
+func (state *Dispatcher) releaseLocked(id string) {
+	if cancel, ok := state.cancels[id]; ok {
+		cancel()
+		delete(state.cancels, id)
+	}
+}
+
+// persist saves the task to the queue store if it is set up
+func (state *Dispatcher) persist(t task.CICD, queue string) {
+	if state.queue == nil {
+		return
+	}
+
+	err := state.queue.Put(t, queue)
+	if err != nil {
+		state.logger.WithField("task_id", t.ID).Errorf("Couldn't save task to the queue store: %s", err)
+	}
+}
+
+// forget removes the task from the queue store if it is set up
+func (state *Dispatcher) forget(id string) {
+	if state.queue == nil {
+		return
+	}
+
+	err := state.queue.Remove(id)
+	if err != nil {
+		state.logger.WithField("task_id", id).Errorf("Couldn't remove task from the queue store: %s", err)
+	}
+}
+
 func (state *Dispatcher) cancelTask(t *task.CICD) string {
 	t.Callback(t.ID, task.StateError, "CI/CD service is shutting down, please, try again later.")
 	return fmt.Sprintf("Task %s wasn't processed because the service is shutting down", t.ID)
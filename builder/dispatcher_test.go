@@ -1,11 +1,16 @@
 package builder
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/store"
 	"github.com/k8s-community/cicd/builder/task"
 )
 
@@ -14,7 +19,7 @@ func prepareDispatcher(maxWorkers int) *Dispatcher {
 		taskItem.Callback(taskItem.ID, taskItem.ID, taskItem.ID)
 	}
 
-	disp := NewDispatcher(processor, logrus.WithField("max_workers", maxWorkers), maxWorkers, 500*time.Millisecond)
+	disp := NewDispatcher(processor, logrus.WithField("max_workers", maxWorkers), maxWorkers)
 	return disp
 }
 
@@ -69,3 +74,332 @@ func TestAddTask(t *testing.T) {
 		}
 	}
 }
+
+func TestRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-dispatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := store.NewFile(filepath.Join(dir, "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, requeue := range []bool{false, true} {
+		// state of the queue before the "restart"
+		queue.Put(*task.NewCICD(nil, "1", "test", "test", "user_1", "test", "test", "test-namespace"), store.QueueInProgress)
+		queue.Put(*task.NewCICD(nil, "2", "test", "test", "user_1", "test", "test", "test-namespace"), store.QueueWaiting)
+		queue.Put(*task.NewCICD(nil, "3", "test", "test", "user_2", "test", "test", "test-namespace"), store.QueueWaiting)
+
+		mux := &sync.RWMutex{}
+		states := make(map[string]string)
+		prepare := func(t *task.CICD) {
+			t.Callback = func(taskID string, state string, description string) {
+				mux.Lock()
+				states[taskID] = state
+				mux.Unlock()
+			}
+		}
+
+		processor := func(taskItem task.CICD) {
+			taskItem.Callback(taskItem.ID, task.StateSuccess, taskItem.ID)
+		}
+
+		disp := NewDispatcher(processor, logrus.WithField("requeue", requeue), 2, WithQueueStore(queue, requeue))
+		err = disp.Restore(prepare)
+		if err != nil {
+			t.Fatalf("Couldn't restore tasks: %s", err)
+		}
+
+		for i := 0; i < 100; i++ {
+			mux.Lock()
+			done := len(states) == 3
+			mux.Unlock()
+			if done {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		disp.Shutdown()
+
+		expected := map[string]string{"1": task.StateError, "2": task.StateSuccess, "3": task.StateSuccess}
+		if requeue {
+			expected["1"] = task.StateSuccess
+		}
+		for taskID, state := range expected {
+			mux.Lock()
+			if states[taskID] != state {
+				t.Errorf("Task %s: expected state %s, got %s", taskID, state, states[taskID])
+			}
+			mux.Unlock()
+		}
+
+		records, _ := queue.List()
+		if len(records) != 0 {
+			t.Errorf("Queue store has to be empty, got %d tasks", len(records))
+		}
+	}
+}
+
+func TestCancelTask(t *testing.T) {
+	started := make(chan struct{})
+	processor := func(taskItem task.CICD) {
+		close(started)
+		<-taskItem.Context.Done()
+		taskItem.Callback(taskItem.ID, task.StateCancelled, taskItem.ID)
+	}
+
+	disp := NewDispatcher(processor, logrus.WithField("test", "cancel"), 1)
+
+	mux := &sync.RWMutex{}
+	states := make(map[string]string)
+	callback := func(taskID string, state string, description string) {
+		mux.Lock()
+		states[taskID] = state
+		mux.Unlock()
+	}
+
+	disp.AddTask(task.NewCICD(callback, "1", "test", "test", "user_1", "test", "test", "test-namespace"))
+	<-started
+	disp.AddTask(task.NewCICD(callback, "2", "test", "test", "user_2", "test", "test", "test-namespace"))
+
+	if err := disp.CancelTask("2"); err != nil {
+		t.Errorf("Couldn't cancel waiting task: %s", err)
+	}
+	if err := disp.CancelTask("1"); err != nil {
+		t.Errorf("Couldn't cancel task in progress: %s", err)
+	}
+	if err := disp.CancelTask("3"); err == nil {
+		t.Errorf("Unknown task mustn't be cancelled")
+	}
+
+	disp.Shutdown()
+
+	for _, taskID := range []string{"1", "2"} {
+		mux.Lock()
+		if states[taskID] != task.StateCancelled {
+			t.Errorf("Task %s: expected state %s, got %s", taskID, task.StateCancelled, states[taskID])
+		}
+		mux.Unlock()
+	}
+}
+
+func TestParallelRepoTasks(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	processor := func(taskItem task.CICD) {
+		started <- taskItem.ID
+		<-release
+		taskItem.Callback(taskItem.ID, task.StateSuccess, taskItem.ID)
+	}
+
+	disp := NewDispatcher(processor, logrus.WithField("test", "parallel"), 2, WithParallelRepoTasks())
+
+	callback := func(taskID string, state string, description string) {}
+	disp.AddTask(task.NewCICD(callback, "1", "test", "test", "user_1", "test", "test", "test-namespace"))
+	disp.AddTask(task.NewCICD(callback, "2", "test", "test", "user_1", "test", "test", "test-namespace"))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("Tasks of the same repo were not processed in the same time")
+		}
+	}
+
+	close(release)
+	disp.Shutdown()
+}
+
+func TestRepoTasksOrder(t *testing.T) {
+	mux := &sync.Mutex{}
+	var processed []string
+	done := make(chan struct{})
+	processor := func(taskItem task.CICD) {
+		mux.Lock()
+		processed = append(processed, taskItem.ID)
+		if len(processed) == 3 {
+			close(done)
+		}
+		mux.Unlock()
+	}
+
+	disp := NewDispatcher(processor, logrus.WithField("test", "order"), 3)
+
+	callback := func(taskID string, state string, description string) {}
+	disp.AddTask(task.NewCICD(callback, "1", "test", "test", "user_1", "test", "test", "test-namespace"))
+	disp.AddTask(task.NewCICD(callback, "2", "test", "test", "user_1", "test", "test", "test-namespace"))
+	disp.AddTask(task.NewCICD(callback, "3", "test", "test", "user_1", "test", "test", "test-namespace"))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Tasks of the same repo were not processed one after another without delay")
+	}
+	disp.Shutdown()
+
+	mux.Lock()
+	defer mux.Unlock()
+	for i, taskID := range []string{"1", "2", "3"} {
+		if processed[i] != taskID {
+			t.Errorf("Expected task %s at position %d, got %s", taskID, i, processed[i])
+		}
+	}
+}
+
+func TestPriorityOvertakes(t *testing.T) {
+	mux := &sync.Mutex{}
+	var processed []string
+	started := make(chan struct{})
+	release := make(chan struct{})
+	processor := func(taskItem task.CICD) {
+		if taskItem.ID == "1" {
+			close(started)
+			<-release
+		}
+		mux.Lock()
+		processed = append(processed, taskItem.ID)
+		mux.Unlock()
+		taskItem.Callback(taskItem.ID, task.StateSuccess, "")
+	}
+
+	disp := NewDispatcher(processor, logrus.WithField("test", "priority"), 1)
+
+	reported := newStates()
+	disp.AddTask(task.NewCICD(reported.callback, "1", "test", "test", "user_1", "test", "test", "test-namespace"))
+	<-started
+
+	// the worker is busy, so the test mustn't be picked before the deploy added later
+	disp.AddTask(task.NewCICD(reported.callback, "2", "test", "test", "user_2", "test", "test", "test-namespace"))
+	time.Sleep(20 * time.Millisecond)
+	deploy := task.NewCICD(reported.callback, "3", task.TypeDeploy, "test", "user_3", "test", "test", "test-namespace")
+	deploy.Priority = task.PriorityDeploy
+	disp.AddTask(deploy)
+	close(release)
+
+	reported.wait(t, "2")
+	disp.Shutdown()
+
+	mux.Lock()
+	defer mux.Unlock()
+	for i, taskID := range []string{"1", "3", "2"} {
+		if i >= len(processed) || processed[i] != taskID {
+			t.Errorf("Expected order 1, 3, 2, got %v", processed)
+			break
+		}
+	}
+}
+
+func TestSupersede(t *testing.T) {
+	for _, cancelRunning := range []bool{false, true} {
+		started := make(chan string, 3)
+		processor := func(taskItem task.CICD) {
+			started <- taskItem.ID
+			if taskItem.ID == "1" {
+				<-taskItem.Ctx().Done()
+				taskItem.Callback(taskItem.ID, task.StateCancelled, "Cancelled: "+taskItem.Ctx().Err().Error())
+				return
+			}
+			taskItem.Callback(taskItem.ID, task.StateSuccess, taskItem.ID)
+		}
+
+		disp := NewDispatcher(processor, logrus.WithField("test", "supersede"), 2, WithSupersede(cancelRunning))
+
+		mux := &sync.Mutex{}
+		descriptions := make(map[string]string)
+		callback := func(taskID string, state string, description string) {
+			mux.Lock()
+			descriptions[taskID] = state + ": " + description
+			mux.Unlock()
+		}
+
+		for _, id := range []string{"1", "2", "3"} {
+			taskItem := task.NewCICD(callback, id, "test", "test", "user_1", "commit"+id, "", "test-namespace")
+			taskItem.Branch = "master"
+			if id == "2" {
+				taskItem.Branch = "feature"
+			}
+			disp.AddTask(taskItem)
+			if id == "1" {
+				<-started
+			}
+		}
+		taskItem := task.NewCICD(callback, "4", "test", "test", "user_1", "commit4", "", "test-namespace")
+		taskItem.Branch = "master"
+		disp.AddTask(taskItem)
+
+		if !cancelRunning {
+			// the running task blocks the repo until it is cancelled
+			disp.CancelTask("1")
+		}
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-started:
+			case <-time.After(time.Second):
+				t.Fatalf("Tasks were not processed after superseding")
+			}
+		}
+		disp.Shutdown()
+
+		mux.Lock()
+		expected := map[string]string{
+			"1": task.StateCancelled + ": Cancelled: context canceled",
+			"2": task.StateSuccess + ": 2",
+			"3": task.StateCancelled + ": " + task.SupersededPrefix + "commit4",
+			"4": task.StateSuccess + ": 4",
+		}
+		if cancelRunning {
+			expected["1"] = task.StateCancelled + ": " + task.SupersededPrefix + "commit4"
+		}
+		for id, description := range expected {
+			if descriptions[id] != description {
+				t.Errorf("Task %s: expected %q, got %q", id, description, descriptions[id])
+			}
+		}
+		mux.Unlock()
+	}
+}
+
+func TestDrain(t *testing.T) {
+	started := make(chan string, 1)
+	processor := func(taskItem task.CICD) {
+		started <- taskItem.ID
+		<-taskItem.Ctx().Done()
+		taskItem.Callback(taskItem.ID, task.StateCancelled, "Cancelled: "+taskItem.Ctx().Err().Error())
+	}
+
+	disp := NewDispatcher(processor, logrus.WithField("test", "drain"), 1)
+
+	mux := &sync.Mutex{}
+	states := make(map[string]string)
+	callback := func(taskID string, state string, description string) {
+		mux.Lock()
+		states[taskID] = state
+		mux.Unlock()
+	}
+
+	disp.AddTask(task.NewCICD(callback, "1", "test", "test", "user_1", "test", "test", "test-namespace"))
+	disp.AddTask(task.NewCICD(callback, "2", "test", "test", "user_2", "test", "test", "test-namespace"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	disp.Drain(ctx)
+	// the second call returns at once
+	disp.Shutdown()
+
+	if !disp.IsShuttingDown() {
+		t.Errorf("Dispatcher has to reject tasks after the drain")
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, taskID := range []string{"1", "2"} {
+		if states[taskID] != task.StateError {
+			t.Errorf("Task %s: expected state %s, got %s", taskID, task.StateError, states[taskID])
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package builder
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// addMatrix registers the matrix build and adds tasks of its cells to the queues,
+// queued tasks of the same branch are superseded by the matrix build
+func (state *Dispatcher) addMatrix(t *task.CICD) {
+	logger := state.logger.WithField("task_id", t.ID)
+	logger.Infof("Add %d cells of matrix build %s to the waiting queue...", len(t.Matrix), t.ID)
+
+	cells := state.expand(*t)
+	for _, cell := range cells {
+		state.persist(cell, store.QueueWaiting)
+	}
+
+	state.mxQueues.Lock()
+	superseded := state.supersedeQueued(*t)
+	for i := range cells {
+		state.track(&cells[i])
+		state.enqueue(cells[i])
+	}
+	state.observeQueues()
+	state.mxQueues.Unlock()
+
+	state.dropSuperseded(superseded, *t)
+	state.signal()
+	logger.Info("Matrix build added.")
+}
+
+// expandRunning turns the running task into the matrix build declared in the repository,
+// tasks of the cells are processed after the running task as the next tasks of the repo
+func (state *Dispatcher) expandRunning(t task.CICD, cells []task.Cell) error {
+	if len(cells) == 0 {
+		return errors.New("matrix doesn't contain any cell")
+	}
+
+	state.logger.WithField("task_id", t.ID).Infof("Task %s is expanded to %d cells of the matrix", t.ID, len(cells))
+	t.Matrix = append([]task.Cell(nil), cells...)
+	items := state.expand(t)
+	for _, item := range items {
+		state.persist(item, store.QueueWaiting)
+	}
+
+	state.mxQueues.Lock()
+	for i := range items {
+		state.track(&items[i])
+		state.enqueue(items[i])
+	}
+	state.observeQueues()
+	state.mxQueues.Unlock()
+
+	state.signal()
+	return nil
+}
+
+// expand registers the matrix build and returns tasks of its cells which aren't built yet
+func (state *Dispatcher) expand(parent task.CICD) []task.CICD {
+	state.mxMatrices.Lock()
+	state.matrices[parent.ID] = &parent
+	state.persist(parent, store.QueueMatrix)
+	state.mxMatrices.Unlock()
+
+	parent.Step(task.StepMatrix)
+
+	var cells []task.CICD
+	for i, cell := range parent.Matrix {
+		if len(cell.State) == 0 {
+			cells = append(cells, state.newCell(parent, i))
+		}
+	}
+	return cells
+}
+
+// newCell returns the task to build the i-th cell of the matrix build
+func (state *Dispatcher) newCell(parent task.CICD, i int) task.CICD {
+	cell := parent.Matrix[i]
+
+	t := parent
+	t.ID = cellID(parent.ID, i)
+	t.Cell = &cell
+	t.Parent = parent.ID
+	t.Matrix = nil
+	t.Context = nil
+	t.Callback = func(taskID string, status string, description string) {}
+	t.Tracker = nil
+	t.Log = nil
+	t.PrepareCell = nil
+	t.Expand = nil
+	if t.Type == task.TypeDeploy {
+		// cells are never deployed, otherwise the matrix build would deploy once per cell
+		t.Type = task.TypeTest
+	}
+
+	if parent.PrepareCell != nil {
+		parent.PrepareCell(&t)
+	}
+	state.watchCell(&t)
+
+	return t
+}
+
+// watchCell makes the task of the cell report its final state to the matrix build
+func (state *Dispatcher) watchCell(t *task.CICD) {
+	callback, parentID := t.Callback, t.Parent
+	t.Callback = func(taskID string, status string, description string) {
+		callback(taskID, status, description)
+		if status != task.StatePending {
+			state.finishCell(parentID, taskID, status)
+		}
+	}
+}
+
+// finishCell saves the final state of the cell,
+// the combined state of the matrix build is reported when all its cells are finished
+func (state *Dispatcher) finishCell(parentID, id, status string) {
+	state.mxMatrices.Lock()
+	parent, ok := state.matrices[parentID]
+	if !ok {
+		state.mxMatrices.Unlock()
+		return
+	}
+
+	finished := true
+	for i := range parent.Matrix {
+		if cellID(parentID, i) == id && len(parent.Matrix[i].State) == 0 {
+			parent.Matrix[i].State = status
+		}
+		if len(parent.Matrix[i].State) == 0 {
+			finished = false
+		}
+	}
+	if !finished {
+		state.persist(*parent, store.QueueMatrix)
+		state.mxMatrices.Unlock()
+		return
+	}
+	delete(state.matrices, parentID)
+	state.mxMatrices.Unlock()
+
+	state.forget(parentID)
+	combined, description := task.CombineCells(parent.Matrix)
+	state.logger.WithField("task_id", parentID).Infof("Matrix build %s is finished: %s", parentID, description)
+	parent.Callback(parentID, combined, description)
+	parent.Finished()
+}
+
+// unfinishedCells returns IDs of cells of the matrix build which aren't finished yet,
+// it returns false if the task isn't a matrix build waiting for its cells
+func (state *Dispatcher) unfinishedCells(id string) ([]string, bool) {
+	state.mxMatrices.Lock()
+	defer state.mxMatrices.Unlock()
+
+	parent, ok := state.matrices[id]
+	if !ok {
+		return nil, false
+	}
+
+	var ids []string
+	for i, cell := range parent.Matrix {
+		if len(cell.State) == 0 {
+			ids = append(ids, cellID(id, i))
+		}
+	}
+	return ids, true
+}
+
+// restoreMatrix registers the matrix build saved in the queue store before the restart
+func (state *Dispatcher) restoreMatrix(parent task.CICD) {
+	state.mxMatrices.Lock()
+	state.matrices[parent.ID] = &parent
+	state.mxMatrices.Unlock()
+
+	// the matrix build might be saved before its cells were added
+	parent.Step(task.StepMatrix)
+}
+
+// missingCells returns tasks of cells of restored matrix builds which weren't added to the queues before the restart,
+// e.g. because of shutdown during adding of the matrix build, restored contains IDs of restored tasks
+func (state *Dispatcher) missingCells(restored map[string]bool) []task.CICD {
+	state.mxMatrices.Lock()
+	var parents []task.CICD
+	for _, parent := range state.matrices {
+		p := *parent
+		p.Matrix = append([]task.Cell(nil), parent.Matrix...)
+		parents = append(parents, p)
+	}
+	state.mxMatrices.Unlock()
+
+	var missing []task.CICD
+	for _, parent := range parents {
+		for i, cell := range parent.Matrix {
+			if len(cell.State) == 0 && !restored[cellID(parent.ID, i)] {
+				missing = append(missing, state.newCell(parent, i))
+			}
+		}
+	}
+	return missing
+}
+
+// cellID returns ID of the task of the i-th cell of the matrix build
+func cellID(parentID string, i int) string {
+	return parentID + "-" + strconv.Itoa(i+1)
+}
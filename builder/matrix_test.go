@@ -0,0 +1,239 @@
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// states collects states reported by callbacks of tasks
+type states struct {
+	mx           sync.Mutex
+	values       map[string]string
+	descriptions map[string]string
+}
+
+func newStates() *states {
+	return &states{values: make(map[string]string), descriptions: make(map[string]string)}
+}
+
+func (s *states) callback(taskID string, state string, description string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.values[taskID] = state
+	s.descriptions[taskID] = description
+}
+
+func (s *states) get(taskID string) (string, string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.values[taskID], s.descriptions[taskID]
+}
+
+// wait waits until the task reports the final state
+func (s *states) wait(t *testing.T, taskID string) {
+	for i := 0; i < 100; i++ {
+		if state, _ := s.get(taskID); len(state) > 0 && state != task.StatePending {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Task %s wasn't finished", taskID)
+}
+
+func TestMatrix(t *testing.T) {
+	processor := func(taskItem task.CICD) {
+		if taskItem.Cell == nil {
+			// the repository declares the matrix
+			err := taskItem.Expand([]task.Cell{{Go: "1.10"}, {Go: "1.11"}})
+			if err != nil {
+				taskItem.Callback(taskItem.ID, task.StateError, err.Error())
+			}
+			return
+		}
+
+		state := task.StateSuccess
+		if taskItem.Cell.GOOS == "windows" || taskItem.Type == task.TypeDeploy {
+			state = task.StateFailure
+		}
+		taskItem.Callback(taskItem.ID, state, taskItem.Cell.Name())
+	}
+	disp := NewDispatcher(processor, logrus.WithField("test", "matrix"), 2)
+
+	reported := newStates()
+	prepare := func(cell *task.CICD) {
+		cell.Callback = reported.callback
+	}
+
+	requested := task.NewCICD(reported.callback, "requested", "test", "test", "user_1", "test", "test", "test-namespace")
+	requested.Matrix = []task.Cell{{GOOS: "linux", GOARCH: "amd64"}, {GOOS: "windows", GOARCH: "amd64"}}
+	requested.PrepareCell = prepare
+	disp.AddTask(requested)
+
+	declared := task.NewCICD(reported.callback, "declared", "test", "test", "user_2", "test", "test", "test-namespace")
+	declared.PrepareCell = prepare
+	disp.AddTask(declared)
+
+	deployed := task.NewCICD(reported.callback, "deployed", task.TypeDeploy, "test", "user_3", "test", "test", "test-namespace")
+	deployed.Matrix = []task.Cell{{Go: "1.10"}, {Go: "1.11"}}
+	deployed.PrepareCell = prepare
+	disp.AddTask(deployed)
+
+	reported.wait(t, "requested")
+	reported.wait(t, "declared")
+	reported.wait(t, "deployed")
+	disp.Shutdown()
+
+	expected := map[string]string{
+		"requested":   task.StateFailure,
+		"requested-1": task.StateSuccess,
+		"requested-2": task.StateFailure,
+		"declared":    task.StateSuccess,
+		"declared-1":  task.StateSuccess,
+		"declared-2":  task.StateSuccess,
+		"deployed":    task.StateSuccess,
+	}
+	for taskID, state := range expected {
+		if actual, _ := reported.get(taskID); actual != state {
+			t.Errorf("Task %s: expected state %s, got %s", taskID, state, actual)
+		}
+	}
+
+	if _, desc := reported.get("requested"); desc != "1 of 2 cells passed: windows/amd64 failed" {
+		t.Errorf("Unexpected description of the matrix build: %q", desc)
+	}
+	if _, desc := reported.get("declared-2"); desc != "go1.11" {
+		t.Errorf("Unexpected cell of the task: %q", desc)
+	}
+}
+
+func TestParallelCells(t *testing.T) {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	processor := func(taskItem task.CICD) {
+		started <- taskItem.ID
+		<-release
+		taskItem.Callback(taskItem.ID, task.StateSuccess, "Passed")
+	}
+	disp := NewDispatcher(processor, logrus.WithField("test", "matrix"), 2)
+
+	reported := newStates()
+	matrix := task.NewCICD(reported.callback, "matrix", "test", "test", "user_1", "test", "test", "test-namespace")
+	matrix.Matrix = []task.Cell{{Go: "1.10"}, {Go: "1.11"}}
+	matrix.PrepareCell = func(cell *task.CICD) {
+		cell.Callback = reported.callback
+	}
+	disp.AddTask(matrix)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Cells of the same repo have to be processed in parallel")
+		}
+	}
+	close(release)
+
+	reported.wait(t, "matrix")
+	disp.Shutdown()
+}
+
+func TestCancelMatrix(t *testing.T) {
+	started := make(chan struct{}, 1)
+	processor := func(taskItem task.CICD) {
+		started <- struct{}{}
+		<-taskItem.Ctx().Done()
+		taskItem.Callback(taskItem.ID, task.StateCancelled, "Cancelled")
+	}
+	disp := NewDispatcher(processor, logrus.WithField("test", "matrix"), 1)
+
+	reported := newStates()
+	matrix := task.NewCICD(reported.callback, "matrix", "test", "test", "user_1", "test", "test", "test-namespace")
+	matrix.Matrix = []task.Cell{{Go: "1.10"}, {Go: "1.11"}}
+	matrix.PrepareCell = func(cell *task.CICD) {
+		cell.Callback = reported.callback
+	}
+	disp.AddTask(matrix)
+
+	<-started
+	err := disp.CancelTask("matrix")
+	if err != nil {
+		t.Fatalf("Couldn't cancel the matrix build: %s", err)
+	}
+
+	reported.wait(t, "matrix")
+	disp.Shutdown()
+
+	for _, taskID := range []string{"matrix", "matrix-1", "matrix-2"} {
+		if state, _ := reported.get(taskID); state != task.StateCancelled {
+			t.Errorf("Task %s: expected state %s, got %s", taskID, task.StateCancelled, state)
+		}
+	}
+}
+
+func TestRestoreMatrix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-dispatcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := store.NewFile(filepath.Join(dir, "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first cell is finished and the third one wasn't added before the "restart"
+	matrix := task.NewCICD(nil, "matrix", "test", "test", "user_1", "test", "test", "test-namespace")
+	matrix.Matrix = []task.Cell{{Go: "1.10", State: task.StateFailure}, {Go: "1.11"}, {Go: "1.12"}}
+	queue.Put(*matrix, store.QueueMatrix)
+
+	cell := task.NewCICD(nil, "matrix-2", "test", "test", "user_1", "test", "test", "test-namespace")
+	cell.Parent, cell.Cell = "matrix", &task.Cell{Go: "1.11"}
+	queue.Put(*cell, store.QueueWaiting)
+
+	reported := newStates()
+	prepare := func(t *task.CICD) {
+		t.Callback = reported.callback
+		t.PrepareCell = func(cell *task.CICD) {
+			cell.Callback = reported.callback
+		}
+	}
+
+	processor := func(taskItem task.CICD) {
+		taskItem.Callback(taskItem.ID, task.StateSuccess, taskItem.ID)
+	}
+	disp := NewDispatcher(processor, logrus.WithField("test", "matrix"), 2, WithQueueStore(queue, false))
+	err = disp.Restore(prepare)
+	if err != nil {
+		t.Fatalf("Couldn't restore tasks: %s", err)
+	}
+
+	reported.wait(t, "matrix")
+	disp.Shutdown()
+
+	expected := map[string]string{
+		"matrix":   task.StateFailure,
+		"matrix-2": task.StateSuccess,
+		"matrix-3": task.StateSuccess,
+	}
+	for taskID, state := range expected {
+		if actual, _ := reported.get(taskID); actual != state {
+			t.Errorf("Task %s: expected state %s, got %s", taskID, state, actual)
+		}
+	}
+
+	records, _ := queue.List()
+	if len(records) != 0 {
+		t.Errorf("Queue store has to be empty, got %d records", len(records))
+	}
+}
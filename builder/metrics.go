@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/metrics"
+)
+
+// Labels of the queues and the workers
+const (
+	queueWaiting    = "waiting"
+	queueInProgress = "in_progress"
+	queueBlocked    = "blocked"
+
+	workerBusy = "busy"
+	workerIdle = "idle"
+
+	// typeOther labels tasks of unknown types, so the label has a fixed set of values
+	typeOther = "other"
+)
+
+var (
+	queueTasks = metrics.DefaultRegistry.NewGauge(
+		"cicd_queue_tasks", "Number of tasks in the queues of the dispatcher", "queue",
+	)
+	workers = metrics.DefaultRegistry.NewGauge(
+		"cicd_workers", "Number of busy and idle workers", "state",
+	)
+	buildDuration = metrics.DefaultRegistry.NewHistogram(
+		"cicd_build_duration_seconds", "Duration of processing of builds by workers", metrics.DurationBuckets, "type",
+	)
+	buildOutcomes = metrics.DefaultRegistry.NewCounter(
+		"cicd_builds_total", "Number of finished builds by their states", "type", "state",
+	)
+)
+
+// observeQueues updates sizes of the queues, it has to be called under mxQueues lock
+func (state *Dispatcher) observeQueues() {
+	blocked := 0
+	for _, items := range state.repoQueues {
+		blocked += len(items)
+	}
+
+	queueTasks.Set(float64(len(state.waiting)), queueWaiting)
+	queueTasks.Set(float64(len(state.inProgress)), queueInProgress)
+	queueTasks.Set(float64(blocked), queueBlocked)
+}
+
+// observeOutcome counts the build if its state is final
+func observeOutcome(taskType, status string) {
+	if status != task.StatePending {
+		buildOutcomes.Inc(typeLabel(taskType), status)
+	}
+}
+
+// typeLabel returns the value of the type label of the task type
+func typeLabel(taskType string) string {
+	if !task.KnownType(taskType) {
+		return typeOther
+	}
+	return taskType
+}
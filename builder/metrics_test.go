@@ -0,0 +1,47 @@
+package builder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	done := make(chan struct{})
+	processor := func(taskItem task.CICD) {
+		taskItem.Callback(taskItem.ID, task.StateFailure, taskItem.ID)
+		close(done)
+	}
+	disp := NewDispatcher(processor, logrus.WithField("test", "metrics"), 2)
+
+	callback := func(taskID string, state string, description string) {}
+	disp.AddTask(task.NewCICD(callback, "1", "metrics-test", "test", "user_1", "test", "test", "test-namespace"))
+	<-done
+	disp.Shutdown()
+
+	buf := &bytes.Buffer{}
+	err := metrics.DefaultRegistry.Write(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if strings.Contains(buf.String(), "metrics-test") {
+		t.Errorf("Unknown type of the task has to be labeled as %s:\n%s", typeOther, buf.String())
+	}
+
+	for _, line := range []string{
+		// metrics are global, so values of other tests and runs are counted too
+		`cicd_builds_total{type="other",state="failure"} `,
+		`cicd_build_duration_seconds_count{type="other"} `,
+		`cicd_queue_tasks{queue="waiting"} 0` + "\n",
+		`cicd_workers{state="busy"} 0` + "\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Metrics don't contain %s:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/task"
+	"gopkg.in/yaml.v2"
+)
+
+// FileName is a name of the pipeline file in the root of the repository
+const FileName = ".cicd.yml"
+
+// Pipeline describes how to process a repository. Example of the file:
+//
+//	env:
+//	  CGO_ENABLED: "0"
+//	matrix:
+//	  go: ["1.10", "1.11"]
+//	  platforms: [linux/amd64, linux/arm64, windows/amd64]
+//	stages:
+//	  - name: test
+//	    commands:
+//	      - go vet ./...
+//	      - go test -json -race -coverprofile=coverage.out ./...
+//	    tests: true
+//	    coverage: coverage.out
+//	    when:
+//	      platforms: [linux/amd64]
+//	  - name: build
+//	    commands:
+//	      - make build
+//	    artifacts:
+//	      - bin/*
+//	  - name: deploy
+//	    dir: deployments
+//	    env:
+//	      VALUES: values-stable
+//	    commands:
+//	      - make deploy
+//	    when:
+//	      tasks: [deploy]
+//	      branches: [master, release-*]
+type Pipeline struct {
+	Env    map[string]string `yaml:"env"`    // Env is shared by all stages
+	Stages []Stage           `yaml:"stages"` // Stages are processed one by one until the first failed command
+
+	// Matrix makes a build of every combination of Go versions and platforms instead of the build of the commit,
+	// it is ignored if the build request declares its own matrix
+	Matrix cicd.Matrix `yaml:"matrix"`
+}
+
+// Stage is a named set of commands
+type Stage struct {
+	Name     string            `yaml:"name"`
+	Commands []string          `yaml:"commands"` // Commands are executed by shell
+	Env      map[string]string `yaml:"env"`      // Env extends and overrides environment of the pipeline
+	Dir      string            `yaml:"dir"`      // Dir is a working directory relative to the root of the repository
+	When     Condition         `yaml:"when"`     // When defines if the stage has to be processed
+
+	// Artifacts are glob patterns of files (relative to the root of the repository) which are saved
+	// after successful stage, directories are saved with all their files
+	Artifacts []string `yaml:"artifacts"`
+
+	// Tests marks what commands of the stage print `go test -json` output, it is parsed into the test report
+	Tests bool `yaml:"tests"`
+
+	// Coverage is a path of the coverage profile (relative to the root of the repository) which is written
+	// by commands of the stage, it is checked after successful stage
+	Coverage string `yaml:"coverage"`
+}
+
+// Condition defines when the stage has to be processed, empty condition matches everything
+type Condition struct {
+	Tasks    []string `yaml:"tasks"`    // Tasks are types of the task, e.g. test or deploy
+	Branches []string `yaml:"branches"` // Branches are glob patterns of branch names
+
+	// Platforms are glob patterns of GOOS/GOARCH pairs of cells of the matrix build,
+	// e.g. tests might be run only for the platform of the service and other platforms are only compiled
+	Platforms []string `yaml:"platforms"`
+}
+
+// Load reads the pipeline file, the error satisfies os.IsNotExist if the file is absent
+func Load(path string) (*Pipeline, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates the pipeline definition
+func Parse(data []byte) (*Pipeline, error) {
+	p := new(Pipeline)
+	err := yaml.UnmarshalStrict(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %s", FileName, err)
+	}
+
+	if len(p.Stages) == 0 {
+		return nil, fmt.Errorf("%s doesn't contain any stage", FileName)
+	}
+
+	if _, err := task.NewMatrix(p.Matrix); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for i, stage := range p.Stages {
+		if len(stage.Name) == 0 {
+			return nil, fmt.Errorf("stage #%d doesn't have a name", i+1)
+		}
+		if strings.Contains(stage.Name, "/") {
+			// the slash separates contexts of commit statuses of stages from contexts of whole builds
+			return nil, fmt.Errorf("name of stage %s couldn't contain /", stage.Name)
+		}
+		if names[stage.Name] {
+			return nil, fmt.Errorf("stage %s is defined twice", stage.Name)
+		}
+		names[stage.Name] = true
+
+		if len(stage.Commands) == 0 {
+			return nil, fmt.Errorf("stage %s doesn't contain any command", stage.Name)
+		}
+
+		if filepath.IsAbs(stage.Dir) || strings.HasPrefix(filepath.Clean(stage.Dir), "..") {
+			return nil, fmt.Errorf("directory of stage %s has to be inside the repository", stage.Name)
+		}
+
+		for _, pattern := range stage.Artifacts {
+			clean := filepath.Clean(pattern)
+			if len(pattern) == 0 || filepath.IsAbs(pattern) || clean == ".." || strings.HasPrefix(clean, "../") {
+				return nil, fmt.Errorf("artifacts of stage %s have to be inside the repository", stage.Name)
+			}
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("stage %s has wrong artifacts pattern %s: %s", stage.Name, pattern, err)
+			}
+		}
+
+		if clean := filepath.Clean(stage.Coverage); filepath.IsAbs(stage.Coverage) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("coverage profile of stage %s has to be inside the repository", stage.Name)
+		}
+
+		for _, pattern := range stage.When.Branches {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("stage %s has wrong branch pattern %s: %s", stage.Name, pattern, err)
+			}
+		}
+
+		for _, pattern := range stage.When.Platforms {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("stage %s has wrong platform pattern %s: %s", stage.Name, pattern, err)
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Environment returns environment variables of the stage in form of "key=value"
+func (p *Pipeline) Environment(stage Stage) []string {
+	vars := make(map[string]string)
+	for key, value := range p.Env {
+		vars[key] = value
+	}
+	for key, value := range stage.Env {
+		vars[key] = value
+	}
+
+	var env []string
+	for key, value := range vars {
+		env = append(env, key+"="+value)
+	}
+
+	return env
+}
+
+// NeedsBranches returns true if any stage depends on a branch
+func (p *Pipeline) NeedsBranches() bool {
+	for _, stage := range p.Stages {
+		if len(stage.When.Branches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the stage has to be processed for the task type and one of the branches
+func (c Condition) Match(taskType string, branches []string) bool {
+	if len(c.Tasks) > 0 && !contains(c.Tasks, taskType) {
+		return false
+	}
+
+	if len(c.Branches) == 0 {
+		return true
+	}
+
+	for _, pattern := range c.Branches {
+		for _, branch := range branches {
+			if ok, _ := path.Match(pattern, branch); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// MatchPlatform returns true if the stage has to be processed for the platform in form of GOOS/GOARCH
+func (c Condition) MatchPlatform(platform string) bool {
+	if len(c.Platforms) == 0 {
+		return true
+	}
+
+	for _, pattern := range c.Platforms {
+		if ok, _ := path.Match(pattern, platform); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cells returns cells of the matrix of the pipeline, it returns nil if the pipeline doesn't declare the matrix
+func (p *Pipeline) Cells() []task.Cell {
+	// the matrix is validated by Parse
+	cells, _ := task.NewMatrix(p.Matrix)
+	return cells
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const definition = `
+env:
+  CGO_ENABLED: "0"
+  MODE: pipeline
+matrix:
+  go: ["1.10", "1.11"]
+  platforms: [linux/amd64]
+stages:
+  - name: test
+    commands:
+      - go test ./...
+    artifacts:
+      - bin/*
+  - name: deploy
+    dir: deployments
+    env:
+      MODE: stage
+    commands:
+      - make deploy
+    when:
+      tasks: [deploy]
+      branches: [master, release-*]
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(definition))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(p.Stages) != 2 || p.Stages[1].Dir != "deployments" || len(p.Stages[0].Artifacts) != 1 {
+		t.Fatalf("Unexpected stages: %+v", p.Stages)
+	}
+
+	env := p.Environment(p.Stages[1])
+	sort.Strings(env)
+	if strings.Join(env, " ") != "CGO_ENABLED=0 MODE=stage" {
+		t.Errorf("Unexpected environment: %v", env)
+	}
+
+	if !p.NeedsBranches() {
+		t.Errorf("Pipeline depends on branches")
+	}
+
+	if cells := p.Cells(); len(cells) != 2 || cells[1].Name() != "go1.11 linux/amd64" {
+		t.Errorf("Unexpected cells of the matrix: %+v", cells)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":        ``,
+		"unknown":      "stages:\n  - name: test\n    command: [ls]\n",
+		"no name":      "stages:\n  - commands: [ls]\n",
+		"slash":        "stages:\n  - name: build/test\n    commands: [ls]\n",
+		"duplicate":    "stages:\n  - name: test\n    commands: [ls]\n  - name: test\n    commands: [ls]\n",
+		"no commands":  "stages:\n  - name: test\n",
+		"outside dir":  "stages:\n  - name: test\n    dir: ../other\n    commands: [ls]\n",
+		"absolute dir": "stages:\n  - name: test\n    dir: /tmp\n    commands: [ls]\n",
+		"pattern":      "stages:\n  - name: test\n    commands: [ls]\n    when:\n      branches: ['[']\n",
+		"artifacts":    "stages:\n  - name: test\n    commands: [ls]\n    artifacts: ['../bin']\n",
+		"abs artifact": "stages:\n  - name: test\n    commands: [ls]\n    artifacts: [/etc/passwd]\n",
+		"bad artifact": "stages:\n  - name: test\n    commands: [ls]\n    artifacts: ['bin/[']\n",
+		"coverage":     "stages:\n  - name: test\n    commands: [ls]\n    coverage: ../coverage.out\n",
+		"platforms":    "stages:\n  - name: test\n    commands: [ls]\n    when:\n      platforms: ['[']\n",
+		"matrix":       "matrix:\n  platforms: [linux]\nstages:\n  - name: test\n    commands: [ls]\n",
+	}
+
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Expected error for %s definition", name)
+		}
+	}
+}
+
+func TestConditionMatch(t *testing.T) {
+	condition := Condition{Tasks: []string{"deploy"}, Branches: []string{"master", "release-*"}}
+
+	tests := []struct {
+		taskType string
+		branches []string
+		match    bool
+	}{
+		{taskType: "deploy", branches: []string{"master"}, match: true},
+		{taskType: "deploy", branches: []string{"feature", "release-1.0"}, match: true},
+		{taskType: "deploy", branches: []string{"feature"}, match: false},
+		{taskType: "deploy", branches: nil, match: false},
+		{taskType: "test", branches: []string{"master"}, match: false},
+	}
+
+	for _, test := range tests {
+		if condition.Match(test.taskType, test.branches) != test.match {
+			t.Errorf("Expected %v for %s on %v", test.match, test.taskType, test.branches)
+		}
+	}
+
+	if !(Condition{}).Match("test", nil) {
+		t.Errorf("Empty condition has to match everything")
+	}
+}
+
+func TestConditionMatchPlatform(t *testing.T) {
+	condition := Condition{Platforms: []string{"linux/*", "darwin/amd64"}}
+
+	for platform, match := range map[string]bool{"linux/arm64": true, "darwin/amd64": true, "windows/amd64": false} {
+		if condition.MatchPlatform(platform) != match {
+			t.Errorf("Expected %v for %s", match, platform)
+		}
+	}
+
+	if !(Condition{}).MatchPlatform("windows/amd64") {
+		t.Errorf("Empty condition has to match every platform")
+	}
+}
+
+func TestLoadNotExist(t *testing.T) {
+	_, err := Load(filepath.Join(os.TempDir(), "not-existing-dir", FileName))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package process
+
+import (
+	"os/exec"
+)
+
+// SetGroup does nothing, process groups are not supported on Windows
+func SetGroup(command *exec.Cmd) {}
+
+// KillGroup kills the command only, its children are kept
+func KillGroup(command *exec.Cmd) error {
+	return command.Process.Kill()
+}
@@ -0,0 +1,33 @@
+// Package process runs commands of builds in process groups of their own,
+// so children of the interrupted command are killed along with it
+package process
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Run starts the command in a process group of its own and waits until it exits,
+// the whole group is killed if the context is done before and the error of the context is returned
+func Run(ctx context.Context, command *exec.Cmd) error {
+	SetGroup(command)
+
+	err := command.Start()
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		KillGroup(command)
+		<-done
+		return ctx.Err()
+	}
+}
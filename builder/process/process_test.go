@@ -0,0 +1,36 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the child process holds the output, so the command can't finish until the whole group is killed
+	command := exec.Command("sh", "-c", "sleep 10 & echo started; sleep 10")
+	out := new(bytes.Buffer)
+	command.Stdout = out
+
+	start := time.Now()
+	err := Run(ctx, command)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline error, got %v", err)
+	}
+	if out.String() != "started\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Process group wasn't killed in time")
+	}
+
+	err = Run(context.Background(), exec.Command("sh", "-c", "exit 1"))
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Errorf("Expected exit error, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package runners
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// ArtifactStore saves files produced by builds
+type ArtifactStore interface {
+	// Put saves the file of the build, name is a slash-separated path relative to the root of the repository
+	Put(id, stage, name string, r io.Reader) (cicd.Artifact, error)
+}
+
+// collectArtifacts saves files of the repository which match the patterns and reports them to the tracker of the task.
+// Files which are outside of the repository (e.g. by symbolic links) are skipped.
+func collectArtifacts(artifacts ArtifactStore, taskItem task.CICD, stage string, patterns []string, dir string) error {
+	log := taskItem.LogWriter()
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(log, "No artifacts match %s\n", pattern)
+			continue
+		}
+
+		for _, match := range matches {
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.Mode().IsRegular() {
+					return nil
+				}
+
+				real, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				if rel, err := filepath.Rel(root, real); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+					fmt.Fprintf(log, "Artifact %s is skipped: it is outside of the repository\n", path)
+					return nil
+				}
+
+				name, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+
+				artifact, err := saveArtifact(artifacts, taskItem.ID, stage, filepath.ToSlash(name), path)
+				if err != nil {
+					return fmt.Errorf("couldn't save artifact %s: %s", name, err)
+				}
+
+				fmt.Fprintf(log, "Artifact %s is saved: %d bytes, sha256 %s\n", artifact.Name, artifact.Size, artifact.SHA256)
+				taskItem.Artifact(artifact)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func saveArtifact(artifacts ArtifactStore, id, stage, name, path string) (cicd.Artifact, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return cicd.Artifact{}, err
+	}
+	defer file.Close()
+
+	return artifacts.Put(id, stage, name, file)
+}
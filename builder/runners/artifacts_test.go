@@ -0,0 +1,55 @@
+package runners
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+func TestCollectArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "repo")
+	outside := filepath.Join(dir, "outside")
+	for _, path := range []string{filepath.Join(repo, "bin", "linux-amd64"), outside} {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(repo, "bin", "linux-amd64", "app"), []byte("app"), 0644)
+	ioutil.WriteFile(filepath.Join(repo, "bin", "tool"), []byte("tool"), 0644)
+	ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644)
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(repo, "bin", "secret"))
+	os.Symlink(outside, filepath.Join(repo, "linked"))
+
+	artifacts, err := store.NewArtifacts(filepath.Join(dir, "artifacts"), store.Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := &fakeTracker{}
+	taskItem := task.CICD{ID: "1", Tracker: tracker}
+	err = collectArtifacts(artifacts, taskItem, "build", []string{"bin", "linked/*", "missing/*"}, repo)
+	if err != nil {
+		t.Fatalf("Couldn't collect artifacts: %s", err)
+	}
+
+	var names []string
+	for _, artifact := range tracker.artifacts {
+		names = append(names, artifact.Name)
+		if artifact.Stage != "build" || len(artifact.SHA256) != 64 {
+			t.Errorf("Unexpected artifact %+v", artifact)
+		}
+	}
+	if len(names) != 2 || names[0] != "bin/linux-amd64/app" || names[1] != "bin/tool" {
+		t.Errorf("Unexpected artifacts: %v", names)
+	}
+}
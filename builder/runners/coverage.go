@@ -0,0 +1,100 @@
+package runners
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/coverage"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// CoverageBaselines keeps coverage of the last successful builds of base branches
+type CoverageBaselines interface {
+	// Baseline returns coverage of the last successful build of the branch of the repository
+	Baseline(namespace, repo, branch string) (cicd.CoverageBase, bool)
+
+	// SetBaseline saves coverage of the successful build of the branch of the repository
+	SetBaseline(namespace, repo string, base cicd.CoverageBase) error
+}
+
+// CoverageConfig contains settings of checks of coverage of the code by tests
+type CoverageConfig struct {
+	Thresholds coverage.Thresholds // Thresholds restrict coverage of builds
+
+	// BaseBranch is a branch whose last successful build is compared with builds of all branches,
+	// coverage isn't compared if it is empty or Baselines is nil
+	BaseBranch string
+	Baselines  CoverageBaselines
+
+	// Fail fails builds which violate thresholds, otherwise they are only marked with warnings
+	Fail bool
+}
+
+// checkCoverage parses the coverage profile, compares the coverage with the base branch and the thresholds
+// and reports it to the tracker of the task. It returns nil coverage if the profile is absent or broken,
+// and an error if thresholds are violated and they fail builds.
+func (runner *Local) checkCoverage(logger logrus.FieldLogger, taskItem task.CICD, profile string) (*cicd.Coverage, error) {
+	file, err := os.Open(profile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Errorf("Couldn't open coverage profile: %s", err)
+		return nil, nil
+	}
+	defer file.Close()
+
+	c, err := coverage.Parse(file)
+	if err != nil {
+		logger.Errorf("Couldn't parse coverage profile: %s", err)
+		return nil, nil
+	}
+
+	taskItem.Step(task.StepCoverage)
+	config := runner.config.Coverage
+	if len(config.BaseBranch) > 0 && config.Baselines != nil {
+		if base, ok := config.Baselines.Baseline(taskItem.Namespace, taskItem.Repo, baselineBranch(taskItem, config.BaseBranch)); ok {
+			coverage.Compare(c, base)
+		}
+	}
+
+	violations := coverage.Check(c, config.Thresholds)
+	if !config.Fail {
+		c.Warnings = violations
+	}
+	taskItem.Coverage(c)
+
+	if config.Fail && len(violations) > 0 {
+		return c, errors.New(strings.Join(violations, ", "))
+	}
+	return c, nil
+}
+
+// saveBaseline keeps coverage of the successful build of the base branch to compare other builds with it
+func (runner *Local) saveBaseline(logger logrus.FieldLogger, taskItem task.CICD, c *cicd.Coverage) {
+	config := runner.config.Coverage
+	if c == nil || config.Baselines == nil || len(config.BaseBranch) == 0 || taskItem.Branch != config.BaseBranch {
+		return
+	}
+
+	err := config.Baselines.SetBaseline(taskItem.Namespace, taskItem.Repo, cicd.CoverageBase{
+		Branch:    baselineBranch(taskItem, config.BaseBranch),
+		RequestID: taskItem.ID,
+		Total:     c.Total,
+	})
+	if err != nil {
+		logger.Errorf("Couldn't save coverage of the base branch: %s", err)
+	}
+}
+
+// baselineBranch returns the name the baseline of the branch is kept under,
+// every cell of matrix builds is compared with the same cell of the base branch
+func baselineBranch(taskItem task.CICD, branch string) string {
+	if taskItem.Cell == nil {
+		return branch
+	}
+	return branch + " (" + taskItem.Cell.Name() + ")"
+}
@@ -0,0 +1,82 @@
+package runners
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/coverage"
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+func TestCheckCoverage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-coverage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	profile := filepath.Join(dir, "coverage.out")
+	ioutil.WriteFile(profile, []byte("mode: set\nexample.com/app/main.go:1.1,2.2 3 1\nexample.com/app/main.go:3.1,4.2 1 0\n"), 0644)
+
+	baselines, _ := store.NewBaselines("")
+	logger := logrus.WithField("runner", "local")
+	runner := NewLocal(logger, LocalConfig{
+		Coverage: CoverageConfig{
+			Thresholds: coverage.Thresholds{Minimum: 80},
+			BaseBranch: "master",
+			Baselines:  baselines,
+		},
+	})
+
+	tracker := &fakeTracker{}
+	master := task.CICD{ID: "1", Namespace: "k8s-community", Repo: "cicd", Branch: "master", Tracker: tracker}
+	c, err := runner.checkCoverage(logger, master, profile)
+	if err != nil || c == nil || c.Total != 75 || c.Base != nil || len(c.Warnings) != 1 {
+		t.Fatalf("Unexpected coverage %+v, error %v", c, err)
+	}
+	if tracker.coverage != c || tracker.steps[0] != task.StepCoverage {
+		t.Errorf("Coverage isn't reported: %+v", tracker)
+	}
+	runner.saveBaseline(logger, master, c)
+
+	branch := master
+	branch.ID, branch.Branch = "2", "feature"
+	ioutil.WriteFile(profile, []byte("mode: set\nexample.com/app/main.go:1.1,2.2 1 1\nexample.com/app/main.go:3.1,4.2 1 0\n"), 0644)
+	c, err = runner.checkCoverage(logger, branch, profile)
+	if err != nil || c.Total != 50 || c.Base == nil || c.Base.RequestID != "1" || *c.Delta != -25 || len(c.Warnings) != 2 {
+		t.Fatalf("Unexpected coverage %+v, error %v", c, err)
+	}
+	runner.saveBaseline(logger, branch, c)
+	if base, _ := baselines.Baseline("k8s-community", "cicd", "master"); base.RequestID != "1" {
+		t.Errorf("Baseline mustn't be changed by other branches")
+	}
+
+	cell := master
+	cell.ID, cell.Cell = "3", &task.Cell{Go: "1.11"}
+	c, err = runner.checkCoverage(logger, cell, profile)
+	if err != nil || c.Base != nil {
+		t.Fatalf("Cell mustn't be compared with builds of other cells: %+v, error %v", c, err)
+	}
+	runner.saveBaseline(logger, cell, c)
+	if base, _ := baselines.Baseline("k8s-community", "cicd", "master"); base.RequestID != "1" {
+		t.Errorf("Baseline mustn't be changed by cells of matrix builds")
+	}
+	if base, _ := baselines.Baseline("k8s-community", "cicd", "master (go1.11)"); base.RequestID != "3" {
+		t.Errorf("Baseline of the cell isn't saved: %+v", base)
+	}
+
+	runner.config.Coverage.Fail = true
+	c, err = runner.checkCoverage(logger, branch, profile)
+	if err == nil || len(c.Warnings) != 0 {
+		t.Errorf("Expected error, got %v and coverage %+v", err, c)
+	}
+
+	c, err = runner.checkCoverage(logger, branch, filepath.Join(dir, "missing.out"))
+	if c != nil || err != nil {
+		t.Errorf("Unexpected coverage of the missing profile %+v, error %v", c, err)
+	}
+}
@@ -1 +1,715 @@
 package runners
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// Pod phases reported by Kubernetes API
+const (
+	podPhasePending   = "Pending"
+	podPhaseRunning   = "Running"
+	podPhaseSucceeded = "Succeeded"
+	podPhaseFailed    = "Failed"
+	podPhaseUnknown   = "Unknown"
+
+	// podReasonDeadlineExceeded is a reason of the pod which exceeded its activeDeadlineSeconds
+	podReasonDeadlineExceeded = "DeadlineExceeded"
+)
+
+// stepTimeoutExitCode is an exit code of the timeout utility if a command exceeded its limit
+const stepTimeoutExitCode = 124
+
+// apiResponseTimeout limits waiting for headers of responses of API server,
+// the whole request isn't limited because logs of pods are streamed until they are finished
+const apiResponseTimeout = 30 * time.Second
+
+// waitGracePeriod is added to the task timeout to wait for the pod which exceeded its deadline
+const waitGracePeriod = time.Minute
+
+const (
+	inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	inClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	inClusterHostEnv   = "KUBERNETES_SERVICE_HOST"
+	inClusterPortEnv   = "KUBERNETES_SERVICE_PORT"
+
+	jobLabelTaskID = "cicd.k8s.community/task-id"
+)
+
+// KubernetesConfig contains parameters of the Kubernetes runner
+type KubernetesConfig struct {
+	Host      string // Host is a base URL of Kubernetes API server, e.g. https://10.0.0.1:443
+	Token     string // Token is a bearer token to authenticate requests to API server
+	Namespace string // Namespace to create build jobs in
+	Image     string // Image contains Go, git and make to process the task
+
+	// Images are images of Go versions for cells of matrix builds, e.g. "1.11": "golang:1.11",
+	// Image is used for builds without a Go version
+	Images map[string]string
+
+	// Platform is a platform of nodes in form of GOOS/GOARCH, tests of cells of other platforms are only compiled.
+	// It is linux/amd64 if empty.
+	Platform string
+
+	// MakefileTemplate is a path to the Makefile template which replaces the original repository's Makefile
+	MakefileTemplate string
+
+	PollInterval     time.Duration // PollInterval defines how often pod phase is requested
+	LogFlushInterval time.Duration // LogFlushInterval defines how often progress of the job is sent to the callback
+
+	Timeouts Timeouts // Timeouts are default limits of execution time
+
+	// Secrets are added to the environment of the job container,
+	// their values are masked in logs and descriptions of the task
+	Secrets Secrets
+
+	// Env is added to the environment of the job container of all repositories in form of "key=value"
+	Env []string
+
+	// HTTPClient sends requests to API server, the client waiting for responses for 30 seconds is used if nil
+	HTTPClient *http.Client
+}
+
+// InClusterKubernetesConfig returns configuration based on service account of the pod the service is running in
+func InClusterKubernetesConfig() (KubernetesConfig, error) {
+	host, port := os.Getenv(inClusterHostEnv), os.Getenv(inClusterPortEnv)
+	if len(host) == 0 || len(port) == 0 {
+		return KubernetesConfig{}, fmt.Errorf("service is not running inside Kubernetes cluster")
+	}
+
+	token, err := ioutil.ReadFile(inClusterTokenFile)
+	if err != nil {
+		return KubernetesConfig{}, fmt.Errorf("couldn't read service account token: %s", err)
+	}
+
+	client, err := inClusterHTTPClient(inClusterCAFile)
+	if err != nil {
+		return KubernetesConfig{}, err
+	}
+
+	return KubernetesConfig{
+		Host:       "https://" + host + ":" + port,
+		Token:      strings.TrimSpace(string(token)),
+		HTTPClient: client,
+	}, nil
+}
+
+// inClusterHTTPClient returns the client which trusts API server certificates signed by the CA of the cluster
+func inClusterHTTPClient(caFile string) (*http.Client, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read CA certificate of the cluster: %s", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("couldn't parse CA certificate of the cluster %s", caFile)
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSClientConfig:       &tls.Config{RootCAs: roots},
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: apiResponseTimeout,
+		},
+	}, nil
+}
+
+// Kubernetes represents a builder which runs tasks as Jobs inside Kubernetes cluster
+type Kubernetes struct {
+	log    logrus.FieldLogger
+	config KubernetesConfig
+	client *http.Client
+}
+
+// NewKubernetes returns an instance of Kubernetes runner
+func NewKubernetes(log logrus.FieldLogger, config KubernetesConfig) *Kubernetes {
+	if len(config.Namespace) == 0 {
+		config.Namespace = "default"
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = 2 * time.Second
+	}
+	if config.LogFlushInterval == 0 {
+		config.LogFlushInterval = 5 * time.Second
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ResponseHeaderTimeout: apiResponseTimeout,
+			},
+		}
+	}
+
+	return &Kubernetes{
+		log:    log,
+		config: config,
+		client: client,
+	}
+}
+
+// Process do CICD work inside a Job: go get of repo, git checkout to given commit, make test and make deploy
+func (runner *Kubernetes) Process(taskItem task.CICD) {
+	taskItem, steps := timeSteps(taskItem)
+	defer steps.stop()
+
+	logger := runner.log.WithFields(logrus.Fields{"source": taskItem.Prefix, "namespace": taskItem.Namespace, "repo": taskItem.Repo, "commit": taskItem.Commit})
+	ctx := taskItem.Ctx()
+
+	secretEnv := trustedSecrets(runner.config.Secrets, taskItem)
+	if len(secretEnv) > 0 {
+		ctx, taskItem = maskSecrets(ctx, taskItem, secretEnv)
+	}
+
+	job, err := runner.newJob(taskItem, secretEnv)
+	if err != nil {
+		logger.Errorf("Couldn't prepare a job: %s", err)
+		taskItem.Callback(taskItem.ID, task.StateError, "Couldn't prepare a job: "+err.Error())
+		return
+	}
+
+	logger = logger.WithField("job", job.Metadata.Name)
+	if len(secretEnv) > 0 {
+		err = runner.do(ctx, "POST", runner.secretsPath(""), newSecret(job, secretEnv), nil)
+		if err != nil && ctx.Err() != nil {
+			logger.Infof("Task was cancelled")
+			taskItem.Callback(taskItem.ID, task.StateCancelled, "Cancelled: "+errCancelled.Error())
+			return
+		}
+		if err != nil {
+			logger.Errorf("Couldn't create a secret of the job: %s", err)
+			taskItem.Callback(taskItem.ID, task.StateError, "Couldn't create a secret of the job: "+err.Error())
+			return
+		}
+		defer runner.deleteSecret(logger, job.Metadata.Name)
+	}
+
+	logger.Infof("Create job...")
+	err = runner.do(ctx, "POST", runner.jobsPath(""), job, nil)
+	if err != nil && ctx.Err() != nil {
+		logger.Infof("Task was cancelled")
+		taskItem.Callback(taskItem.ID, task.StateCancelled, "Cancelled: "+errCancelled.Error())
+		return
+	}
+	if err != nil {
+		logger.Errorf("Couldn't create a job: %s", err)
+		taskItem.Callback(taskItem.ID, task.StateError, "Couldn't create a job: "+err.Error())
+		return
+	}
+	defer runner.deleteJob(logger, job.Metadata.Name)
+
+	var deadline time.Time
+	if timeout := runner.config.Timeouts.forTask(taskItem).Task; timeout > 0 {
+		deadline = time.Now().Add(timeout + waitGracePeriod)
+	}
+
+	pod, err := runner.waitForPod(ctx, job.Metadata.Name, deadline, podPhasePending)
+	if err == errCancelled {
+		logger.Infof("Task was cancelled")
+		taskItem.Callback(taskItem.ID, task.StateCancelled, "Cancelled: "+err.Error())
+		return
+	}
+	if isTimeout(err) {
+		logger.Errorf("Pod of the job wasn't started in time")
+		taskItem.Callback(taskItem.ID, task.StateTimeout, "Timeout: "+err.Error())
+		return
+	}
+	if err != nil {
+		logger.Errorf("Couldn't get a pod of the job: %s", err)
+		taskItem.Callback(taskItem.ID, task.StateError, "Couldn't get a pod of the job: "+err.Error())
+		return
+	}
+	logger = logger.WithField("pod", pod.Metadata.Name)
+
+	output, err := runner.streamLogs(ctx, logger, taskItem, pod.Metadata.Name)
+	if err != nil {
+		logger.Errorf("Couldn't read logs of the pod: %s", err)
+	}
+
+	pod, err = runner.waitForPod(ctx, job.Metadata.Name, deadline, podPhasePending, podPhaseRunning)
+	if err == errCancelled {
+		logger.Infof("Task was cancelled")
+		taskItem.Callback(taskItem.ID, task.StateCancelled, output+" \n\nCancelled: "+err.Error())
+		return
+	}
+	if isTimeout(err) {
+		logger.Errorf("Pod of the job wasn't finished in time")
+		taskItem.Callback(taskItem.ID, task.StateTimeout, output+" \n\nTimeout: "+err.Error())
+		return
+	}
+	if err != nil {
+		logger.Errorf("Couldn't get a pod of the job: %s", err)
+		taskItem.Callback(taskItem.ID, task.StateError, output+" \n\nError: "+err.Error())
+		return
+	}
+
+	state := podState(pod)
+	logger.Infof("Pod finished with phase %s", pod.Status.Phase)
+	if state == task.StateTimeout {
+		output += " \n\nTimeout: " + timeoutError{}.Error()
+	} else if state != task.StateSuccess && len(pod.Status.Message) > 0 {
+		output += " \n\nError: " + pod.Status.Message
+	}
+	taskItem.Callback(taskItem.ID, state, output)
+}
+
+// podState maps phase of the pod to the state of the task
+func podState(pod *kubePod) string {
+	if pod.Status.Reason == podReasonDeadlineExceeded {
+		return task.StateTimeout
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode == stepTimeoutExitCode {
+			return task.StateTimeout
+		}
+	}
+
+	switch pod.Status.Phase {
+	case podPhasePending, podPhaseRunning:
+		return task.StatePending
+	case podPhaseSucceeded:
+		return task.StateSuccess
+	case podPhaseFailed:
+		return task.StateFailure
+	default:
+		return task.StateError
+	}
+}
+
+// waitForPod waits until the pod of the job leaves all of the given phases.
+// It returns timeoutError if the deadline is passed, zero deadline means no limit,
+// and errCancelled if the task is cancelled.
+func (runner *Kubernetes) waitForPod(ctx context.Context, jobName string, deadline time.Time, phases ...string) (*kubePod, error) {
+	query := url.Values{}
+	query.Set("labelSelector", "job-name="+jobName)
+
+	for {
+		if ctx.Err() != nil {
+			return nil, errCancelled
+		}
+
+		pods := new(kubePodList)
+		err := runner.do(ctx, "GET", runner.podsPath("")+"?"+query.Encode(), nil, pods)
+		if err != nil && ctx.Err() != nil {
+			return nil, errCancelled
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(pods.Items) > 0 {
+			pod := pods.Items[0]
+			if len(pod.Status.Phase) > 0 && !inPhases(pod.Status.Phase, phases) {
+				return &pod, nil
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, timeoutError{}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errCancelled
+		case <-time.After(runner.config.PollInterval):
+		}
+	}
+}
+
+func inPhases(phase string, phases []string) bool {
+	for _, p := range phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// streamLogs follows the container logs and sends them to the task callback
+func (runner *Kubernetes) streamLogs(ctx context.Context, logger logrus.FieldLogger, taskItem task.CICD, podName string) (string, error) {
+	req, err := runner.newRequest(ctx, "GET", runner.podsPath(podName)+"/log?follow=true", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := runner.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	log := taskItem.LogWriter()
+
+	var output bytes.Buffer
+	var step string
+	lines := 0
+	lastFlush := time.Now()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		logger.Info(mask(ctx, line))
+		output.WriteString(line + "\n")
+		fmt.Fprintln(log, line)
+		lines++
+
+		if strings.HasPrefix(line, stepMarker) {
+			step = strings.TrimPrefix(line, stepMarker)
+			taskItem.Step(step)
+		}
+
+		// the log of the task keeps the output, the callback gets only the progress
+		if time.Since(lastFlush) >= runner.config.LogFlushInterval {
+			taskItem.Callback(taskItem.ID, task.StatePending, progress(step, lines))
+			lastFlush = time.Now()
+		}
+	}
+
+	return output.String(), scanner.Err()
+}
+
+// progress returns a short description of the running job
+func progress(step string, lines int) string {
+	if len(step) == 0 {
+		return fmt.Sprintf("Job is running, %d lines of the log", lines)
+	}
+	return fmt.Sprintf("Step %s is running, %d lines of the log", step, lines)
+}
+
+func (runner *Kubernetes) deleteJob(logger logrus.FieldLogger, name string) {
+	body := map[string]string{"kind": "DeleteOptions", "apiVersion": "v1", "propagationPolicy": "Background"}
+	err := runner.do(context.Background(), "DELETE", runner.jobsPath(name), body, nil)
+	if err != nil {
+		logger.Errorf("Couldn't delete the job: %s", err)
+	}
+}
+
+// deleteSecret deletes the secret of the job, it has the name of the job
+func (runner *Kubernetes) deleteSecret(logger logrus.FieldLogger, name string) {
+	err := runner.do(context.Background(), "DELETE", runner.secretsPath(name), nil, nil)
+	if err != nil {
+		logger.Errorf("Couldn't delete the secret of the job: %s", err)
+	}
+}
+
+// newJob returns the job of the task, its container gets secrets from the secret named as the job
+func (runner *Kubernetes) newJob(taskItem task.CICD, secretEnv []string) (*kubeJob, error) {
+	var makefile string
+	if len(runner.config.MakefileTemplate) > 0 {
+		content, err := ioutil.ReadFile(runner.config.MakefileTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read Makefile template: %s", err)
+		}
+		makefile = string(content)
+	}
+
+	image := runner.config.Image
+	if taskItem.Cell != nil && len(taskItem.Cell.Go) > 0 {
+		var ok bool
+		image, ok = runner.config.Images[taskItem.Cell.Go]
+		if !ok {
+			return nil, fmt.Errorf("image of Go %s isn't configured", taskItem.Cell.Go)
+		}
+	}
+
+	project := fmt.Sprintf("%s/%s/%s", taskItem.Prefix, taskItem.Namespace, taskItem.Repo)
+
+	env := []kubeEnvVar{
+		{Name: "NAMESPACE", Value: taskItem.Namespace},
+		{Name: "APP", Value: taskItem.Repo},
+		{Name: "PROJECT", Value: project},
+		{Name: "COMMIT", Value: taskItem.Commit},
+		{Name: "RELEASE", Value: taskItem.Version},
+		{Name: "TASK", Value: taskItem.Type},
+		{Name: "MAKEFILE_TEMPLATE", Value: makefile},
+	}
+	for _, variable := range runner.config.Env {
+		pair := strings.SplitN(variable, "=", 2)
+		if len(pair) == 2 {
+			env = append(env, kubeEnvVar{Name: pair[0], Value: pair[1]})
+		}
+	}
+
+	if taskItem.Cell != nil && len(taskItem.Cell.GOOS) > 0 {
+		env = append(env, kubeEnvVar{Name: "GOOS", Value: taskItem.Cell.GOOS}, kubeEnvVar{Name: "GOARCH", Value: taskItem.Cell.GOARCH})
+	}
+	platform := runner.config.Platform
+	if len(platform) == 0 {
+		platform = "linux/amd64"
+	}
+	if platformOf(taskItem, platform) != platform {
+		env = append(env, kubeEnvVar{Name: "TEST_TARGET", Value: "compile"})
+	}
+
+	timeouts := runner.config.Timeouts.forTask(taskItem)
+	if timeouts.Step > 0 {
+		env = append(env, kubeEnvVar{Name: "STEP_TIMEOUT", Value: strconv.Itoa(int(timeouts.Step.Seconds()))})
+	}
+
+	name := "cicd-" + strings.ToLower(taskItem.ID)
+
+	for _, variable := range secretEnv {
+		pair := strings.SplitN(variable, "=", 2)
+		if len(pair) == 2 {
+			ref := &kubeKeySelector{Name: name, Key: pair[0]}
+			env = append(env, kubeEnvVar{Name: pair[0], ValueFrom: &kubeEnvVarSource{SecretKeyRef: ref}})
+		}
+	}
+	backoffLimit := 0
+
+	job := &kubeJob{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata: kubeMetadata{
+			Name:   name,
+			Labels: map[string]string{jobLabelTaskID: taskItem.ID},
+		},
+	}
+	job.Spec.BackoffLimit = &backoffLimit
+	job.Spec.Template.Metadata.Labels = map[string]string{jobLabelTaskID: taskItem.ID}
+	job.Spec.Template.Spec.RestartPolicy = "Never"
+	if timeouts.Task > 0 {
+		deadlineSeconds := int64(timeouts.Task.Seconds())
+		job.Spec.Template.Spec.ActiveDeadlineSeconds = &deadlineSeconds
+	}
+	job.Spec.Template.Spec.Containers = []kubeContainer{
+		{
+			Name:    "build",
+			Image:   image,
+			Command: []string{"sh", "-c", jobScript},
+			Env:     env,
+		},
+	}
+
+	return job, nil
+}
+
+// newSecret returns the secret which keeps values of secrets of the job,
+// values don't get into the specification of the job and the secret is deleted along with the job
+func newSecret(job *kubeJob, secretEnv []string) *kubeSecret {
+	data := make(map[string]string)
+	for _, variable := range secretEnv {
+		pair := strings.SplitN(variable, "=", 2)
+		if len(pair) == 2 {
+			data[pair[0]] = pair[1]
+		}
+	}
+
+	return &kubeSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   job.Metadata,
+		Type:       "Opaque",
+		StringData: data,
+	}
+}
+
+// stepMarker starts a line of the job log which marks the next step of the task
+const stepMarker = "--- cicd step: "
+
+// jobScript repeats steps of the Local runner inside the container.
+// Every step is marked in the log by stepMarker.
+// Every command is limited by STEP_TIMEOUT if it is set, exceeded command makes the container exit with code 124.
+// TEST_TARGET replaces make test for cells of matrix builds whose tests couldn't be run on the node.
+const jobScript = `set -e
+mark() { echo "` + stepMarker + `$1"; }
+run() {
+	if [ -z "${STEP_TIMEOUT}" ]; then "$@"; return; fi
+	timeout -k 10 "${STEP_TIMEOUT}" "$@" || { code=$?; [ ${code} -ne 124 ] || { echo "Command '$*' exceeded its execution time"; exit 124; }; return ${code}; }
+}
+mark ` + task.StepFetch + `
+run go get -v -d ${PROJECT}/... || true
+cd ${GOPATH}/src/${PROJECT}
+mark ` + task.StepCheckout + `
+run git checkout ${COMMIT}
+mark ` + task.StepPrepare + `
+BUILD_PATH=$(sed -n 's/^BUILD_PATH?=//p' Makefile | head -n 1)
+export BUILD_PATH=${BUILD_PATH:-cmd}
+if [ -z "${RELEASE}" ]; then export RELEASE=$(sed -n 's/^RELEASE?=//p' Makefile | head -n 1); fi
+if [ -n "${MAKEFILE_TEMPLATE}" ]; then printf '%s\n' "${MAKEFILE_TEMPLATE}" > Makefile; fi
+mark ` + task.StepTest + `
+run make ${TEST_TARGET:-test}
+if [ "${TASK}" = "` + cicd.TaskDeploy + `" ]; then mark ` + task.StepDeploy + `; run make deploy; fi
+`
+
+func (runner *Kubernetes) jobsPath(name string) string {
+	path := "/apis/batch/v1/namespaces/" + runner.config.Namespace + "/jobs"
+	if len(name) > 0 {
+		path += "/" + name
+	}
+	return path
+}
+
+func (runner *Kubernetes) podsPath(name string) string {
+	path := "/api/v1/namespaces/" + runner.config.Namespace + "/pods"
+	if len(name) > 0 {
+		path += "/" + name
+	}
+	return path
+}
+
+func (runner *Kubernetes) secretsPath(name string) string {
+	path := "/api/v1/namespaces/" + runner.config.Namespace + "/secrets"
+	if len(name) > 0 {
+		path += "/" + name
+	}
+	return path
+}
+
+func (runner *Kubernetes) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var buf io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		buf = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(runner.config.Host, "/")+path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(runner.config.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+runner.config.Token)
+	}
+
+	return req, nil
+}
+
+func (runner *Kubernetes) do(ctx context.Context, method, path string, body, v interface{}) error {
+	req, err := runner.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := runner.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		status := new(kubeStatus)
+		json.NewDecoder(resp.Body).Decode(status)
+		return fmt.Errorf("%s %s: code %d, %s", method, path, resp.StatusCode, status.Message)
+	}
+
+	if v != nil {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	return nil
+}
+
+// Minimal subset of Kubernetes API objects the runner deals with
+
+type kubeMetadata struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type kubeEnvVar struct {
+	Name      string            `json:"name"`
+	Value     string            `json:"value,omitempty"`
+	ValueFrom *kubeEnvVarSource `json:"valueFrom,omitempty"`
+}
+
+type kubeEnvVarSource struct {
+	SecretKeyRef *kubeKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+type kubeKeySelector struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type kubeSecret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeMetadata      `json:"metadata"`
+	Type       string            `json:"type"`
+	StringData map[string]string `json:"stringData"`
+}
+
+type kubeContainer struct {
+	Name    string       `json:"name"`
+	Image   string       `json:"image"`
+	Command []string     `json:"command,omitempty"`
+	Env     []kubeEnvVar `json:"env,omitempty"`
+}
+
+type kubePodSpec struct {
+	RestartPolicy         string          `json:"restartPolicy"`
+	ActiveDeadlineSeconds *int64          `json:"activeDeadlineSeconds,omitempty"`
+	Containers            []kubeContainer `json:"containers"`
+}
+
+type kubeJob struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Metadata   kubeMetadata `json:"metadata"`
+	Spec       struct {
+		BackoffLimit *int `json:"backoffLimit,omitempty"`
+		Template     struct {
+			Metadata kubeMetadata `json:"metadata"`
+			Spec     kubePodSpec  `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+type kubePod struct {
+	Metadata kubeMetadata `json:"metadata"`
+	Status   struct {
+		Phase             string `json:"phase"`
+		Reason            string `json:"reason,omitempty"`
+		Message           string `json:"message,omitempty"`
+		ContainerStatuses []struct {
+			State struct {
+				Terminated *struct {
+					ExitCode int `json:"exitCode"`
+				} `json:"terminated,omitempty"`
+			} `json:"state"`
+		} `json:"containerStatuses,omitempty"`
+	} `json:"status"`
+}
+
+type kubePodList struct {
+	Items []kubePod `json:"items"`
+}
+
+type kubeStatus struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,379 @@
+package runners
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// fakeAPIServer emulates the part of Kubernetes API used by the Kubernetes runner
+type fakeAPIServer struct {
+	mx             sync.Mutex
+	jobs           map[string]kubeJob
+	deleted        []string
+	secrets        map[string]kubeSecret
+	deletedSecrets []string
+	phases         []string // phases returned one by one on each pods request, the last one is repeated
+	reason         string   // reason of the pod returned with the last phase
+	logs           string
+	namespace      string
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	jobsPath := "/apis/batch/v1/namespaces/" + s.namespace + "/jobs"
+	podsPath := "/api/v1/namespaces/" + s.namespace + "/pods"
+	secretsPath := "/api/v1/namespaces/" + s.namespace + "/secrets"
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == jobsPath:
+		job := kubeJob{}
+		json.NewDecoder(r.Body).Decode(&job)
+		s.jobs[job.Metadata.Name] = job
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(job)
+
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, jobsPath+"/"):
+		s.deleted = append(s.deleted, strings.TrimPrefix(r.URL.Path, jobsPath+"/"))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == "POST" && r.URL.Path == secretsPath:
+		secret := kubeSecret{}
+		json.NewDecoder(r.Body).Decode(&secret)
+		s.secrets[secret.Metadata.Name] = secret
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(secret)
+
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, secretsPath+"/"):
+		s.deletedSecrets = append(s.deletedSecrets, strings.TrimPrefix(r.URL.Path, secretsPath+"/"))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == "GET" && r.URL.Path == podsPath:
+		jobName := strings.TrimPrefix(r.URL.Query().Get("labelSelector"), "job-name=")
+		if _, ok := s.jobs[jobName]; !ok {
+			json.NewEncoder(w).Encode(kubePodList{})
+			return
+		}
+
+		pod := kubePod{}
+		pod.Metadata.Name = jobName + "-pod"
+		pod.Status.Phase = s.phases[0]
+		if len(s.phases) > 1 {
+			s.phases = s.phases[1:]
+		} else {
+			pod.Status.Reason = s.reason
+		}
+		json.NewEncoder(w).Encode(kubePodList{Items: []kubePod{pod}})
+
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/log"):
+		fmt.Fprint(w, s.logs)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(kubeStatus{Message: "not found"})
+	}
+}
+
+// fakeTracker collects steps, artifacts, tests and coverage reported by the runner
+type fakeTracker struct {
+	steps     []string
+	artifacts []cicd.Artifact
+	tests     *cicd.TestReport
+	coverage  *cicd.Coverage
+}
+
+func (f *fakeTracker) Started(taskID string, workerID int) {}
+
+func (f *fakeTracker) Finished(taskID string) {}
+
+func (f *fakeTracker) Step(taskID string, step string) {
+	f.steps = append(f.steps, step)
+}
+
+func (f *fakeTracker) Artifact(taskID string, artifact cicd.Artifact) {
+	f.artifacts = append(f.artifacts, artifact)
+}
+
+func (f *fakeTracker) Tests(taskID string, report *cicd.TestReport) {
+	f.tests = report
+}
+
+func (f *fakeTracker) Coverage(taskID string, coverage *cicd.Coverage) {
+	f.coverage = coverage
+}
+
+func prepareKubernetes(phases []string, reason string) (*Kubernetes, *fakeAPIServer, *httptest.Server) {
+	api := &fakeAPIServer{
+		jobs:      make(map[string]kubeJob),
+		secrets:   make(map[string]kubeSecret),
+		phases:    phases,
+		reason:    reason,
+		logs:      stepMarker + task.StepTest + "\n+ test\nok github.com/test/test\n",
+		namespace: "cicd",
+	}
+	server := httptest.NewServer(api)
+
+	runner := NewKubernetes(logrus.WithField("runner", "kubernetes"), KubernetesConfig{
+		Host:         server.URL,
+		Namespace:    "cicd",
+		Image:        "golang",
+		PollInterval: time.Millisecond,
+		Timeouts:     Timeouts{Task: time.Hour, Step: time.Minute},
+	})
+
+	return runner, api, server
+}
+
+func TestKubernetesProcess(t *testing.T) {
+	tests := []struct {
+		phases []string
+		reason string
+		state  string
+	}{
+		{phases: []string{"", podPhasePending, podPhaseRunning, podPhaseSucceeded}, state: task.StateSuccess},
+		{phases: []string{podPhaseRunning, podPhaseFailed}, state: task.StateFailure},
+		{phases: []string{podPhaseRunning, podPhaseFailed}, reason: podReasonDeadlineExceeded, state: task.StateTimeout},
+		{phases: []string{podPhaseUnknown}, state: task.StateError},
+	}
+
+	for _, test := range tests {
+		runner, api, server := prepareKubernetes(test.phases, test.reason)
+
+		var states, outputs []string
+		callback := func(taskID string, state string, description string) {
+			states = append(states, state)
+			outputs = append(outputs, description)
+		}
+
+		tracker := &fakeTracker{}
+		taskItem := task.NewCICD(callback, "ID", task.TypeTest, "github.com", "cicd", "master", "", "k8s-community")
+		taskItem.Tracker = tracker
+		runner.Process(*taskItem)
+		server.Close()
+
+		if len(tracker.steps) != 1 || tracker.steps[0] != task.StepTest {
+			t.Errorf("Unexpected steps: %v", tracker.steps)
+		}
+
+		if len(states) == 0 {
+			t.Fatalf("Callback was not called for phases %v", test.phases)
+		}
+
+		if states[len(states)-1] != test.state {
+			t.Errorf("Expected state %s, got %s", test.state, states[len(states)-1])
+		}
+
+		if !strings.Contains(outputs[len(outputs)-1], "ok github.com/test/test") {
+			t.Errorf("Logs of the pod are missing in the output: %q", outputs[len(outputs)-1])
+		}
+
+		job, ok := api.jobs["cicd-id"]
+		if !ok {
+			t.Fatalf("Job was not created")
+		}
+
+		if job.Spec.Template.Spec.Containers[0].Image != "golang" {
+			t.Errorf("Unexpected image %s", job.Spec.Template.Spec.Containers[0].Image)
+		}
+
+		deadline := job.Spec.Template.Spec.ActiveDeadlineSeconds
+		if deadline == nil || *deadline != 3600 {
+			t.Errorf("Unexpected active deadline of the pod: %v", deadline)
+		}
+
+		if len(api.deleted) != 1 || api.deleted[0] != "cicd-id" {
+			t.Errorf("Job was not deleted: %v", api.deleted)
+		}
+	}
+}
+
+func TestKubernetesProgress(t *testing.T) {
+	runner, api, server := prepareKubernetes([]string{podPhaseSucceeded}, "")
+	defer server.Close()
+	runner.config.LogFlushInterval = time.Nanosecond
+	api.logs = stepMarker + task.StepTest + "\n" + strings.Repeat("ok github.com/test/test\n", 100)
+
+	var descriptions []string
+	callback := func(taskID string, state string, description string) {
+		descriptions = append(descriptions, description)
+	}
+	log := new(bytes.Buffer)
+
+	taskItem := task.NewCICD(callback, "ID", task.TypeTest, "github.com", "cicd", "master", "", "k8s-community")
+	taskItem.Log = log
+	runner.Process(*taskItem)
+
+	if len(descriptions) < 2 {
+		t.Fatalf("Progress of the job wasn't reported: %v", descriptions)
+	}
+	for _, description := range descriptions[:len(descriptions)-1] {
+		if strings.Contains(description, "ok github.com/test/test") {
+			t.Fatalf("Progress contains the log: %q", description)
+		}
+	}
+	if last := descriptions[len(descriptions)-2]; last != "Step test is running, 101 lines of the log" {
+		t.Errorf("Unexpected progress %q", last)
+	}
+	if strings.Count(log.String(), "ok github.com/test/test") != 100 {
+		t.Errorf("Log of the task doesn't contain the output: %q", log.String())
+	}
+}
+
+func TestKubernetesProcessAPIError(t *testing.T) {
+	runner, _, server := prepareKubernetes([]string{podPhaseSucceeded}, "")
+	runner.config.Namespace = "unknown"
+	defer server.Close()
+
+	var state string
+	callback := func(taskID string, s string, description string) {
+		state = s
+	}
+
+	taskItem := task.NewCICD(callback, "ID", task.TypeTest, "github.com", "cicd", "master", "", "k8s-community")
+	runner.Process(*taskItem)
+
+	if state != task.StateError {
+		t.Errorf("Expected state %s, got %s", task.StateError, state)
+	}
+}
+
+// staticSecrets provides the same secrets to all repositories
+type staticSecrets []string
+
+func (s staticSecrets) Environment(namespace, repo string) []string {
+	return s
+}
+
+func TestKubernetesSecrets(t *testing.T) {
+	runner, api, server := prepareKubernetes([]string{podPhaseSucceeded}, "")
+	defer server.Close()
+	runner.config.Secrets = staticSecrets{"TOKEN=top-secret"}
+	api.logs = "token is top-secret\n"
+
+	var description string
+	callback := func(taskID string, state string, desc string) {
+		description = desc
+	}
+
+	taskItem := task.NewCICD(callback, "ID", task.TypeTest, "github.com", "cicd", "master", "", "k8s-community")
+	taskItem.Trusted = true
+	runner.Process(*taskItem)
+
+	var ref *kubeKeySelector
+	for _, variable := range api.jobs["cicd-id"].Spec.Template.Spec.Containers[0].Env {
+		if variable.Name != "TOKEN" {
+			continue
+		}
+		if len(variable.Value) > 0 || variable.ValueFrom == nil {
+			t.Fatalf("Secret has to be referenced by the job, got %+v", variable)
+		}
+		ref = variable.ValueFrom.SecretKeyRef
+	}
+	if ref == nil || ref.Name != "cicd-id" || ref.Key != "TOKEN" {
+		t.Errorf("Unexpected reference to the secret: %+v", ref)
+	}
+	if secret := api.secrets["cicd-id"]; secret.StringData["TOKEN"] != "top-secret" {
+		t.Errorf("Secret of the job wasn't created: %+v", secret)
+	}
+	if len(api.deletedSecrets) != 1 || api.deletedSecrets[0] != "cicd-id" {
+		t.Errorf("Secret of the job was not deleted: %v", api.deletedSecrets)
+	}
+	if description != "token is ********\n" {
+		t.Errorf("Unexpected description %q", description)
+	}
+}
+
+func TestKubernetesUntrustedSecrets(t *testing.T) {
+	runner, api, server := prepareKubernetes([]string{podPhaseSucceeded}, "")
+	defer server.Close()
+	runner.config.Secrets = staticSecrets{"TOKEN=top-secret"}
+
+	// builds of pull requests aren't trusted
+	taskItem := task.NewCICD(func(string, string, string) {}, "ID", task.TypeTest, "github.com", "cicd", "master", "", "k8s-community")
+	taskItem.Branch = "refs/pull/7/head"
+	runner.Process(*taskItem)
+
+	for _, variable := range api.jobs["cicd-id"].Spec.Template.Spec.Containers[0].Env {
+		if variable.Name == "TOKEN" {
+			t.Errorf("Untrusted build got the secret: %+v", variable)
+		}
+	}
+	if len(api.secrets) > 0 {
+		t.Errorf("Secret was created for the untrusted build: %v", api.secrets)
+	}
+}
+
+func TestKubernetesJobEnv(t *testing.T) {
+	runner, _, server := prepareKubernetes([]string{podPhaseSucceeded}, "")
+	defer server.Close()
+
+	taskItem := task.NewCICD(nil, "ID", task.TypeDeploy, "github.com", "cicd", "master", "", "k8s-community")
+	job, err := runner.newJob(*taskItem, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, variable := range job.Spec.Template.Spec.Containers[0].Env {
+		if variable.Name == "KUBE_CONTEXT" || variable.Name == "REGISTRY" {
+			t.Errorf("Unexpected variable without configuration: %+v", variable)
+		}
+	}
+
+	runner.config.Env = []string{"KUBE_CONTEXT=cluster", "REGISTRY=registry.local"}
+	job, err = runner.newJob(*taskItem, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	env := make(map[string]string)
+	for _, variable := range job.Spec.Template.Spec.Containers[0].Env {
+		env[variable.Name] = variable.Value
+	}
+	if env["KUBE_CONTEXT"] != "cluster" || env["REGISTRY"] != "registry.local" {
+		t.Errorf("Configured variables are missing in the environment of the job: %v", env)
+	}
+}
+
+func TestInClusterHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "cicd-kubernetes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.crt")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+
+	client, err := inClusterHTTPClient(caFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Certificate of API server isn't trusted: %s", err)
+	}
+	resp.Body.Close()
+
+	ioutil.WriteFile(caFile, []byte("wrong"), 0644)
+	_, err = inClusterHTTPClient(caFile)
+	if err == nil {
+		t.Errorf("Expected error for wrong CA certificate")
+	}
+}
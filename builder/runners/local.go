@@ -1,67 +1,194 @@
 package runners
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"bufio"
 	"io"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/pipeline"
+	"github.com/k8s-community/cicd/builder/process"
+	"github.com/k8s-community/cicd/builder/source"
 	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/builder/testreport"
 	ghIntegr "github.com/k8s-community/github-integration/client"
 )
 
+// LocalConfig contains parameters of the Local runner
+type LocalConfig struct {
+	Timeouts Timeouts // Timeouts are default limits of execution time
+
+	WorkspaceDir   string // WorkspaceDir is a directory for workspaces of tasks, temporary directory is used if empty
+	KeepWorkspaces bool   // KeepWorkspaces leaves workspaces after processing for debugging
+
+	Modules ModulesConfig // Modules are settings of repositories which contain go.mod
+
+	// Source fetches repositories, git command line tool without credentials is used if nil
+	Source source.Provider
+
+	// MakefileTemplate is a path of Makefile template for repositories without the pipeline file,
+	// the template of the service in GOPATH is used if empty
+	MakefileTemplate string
+
+	// Artifacts saves files declared by stages of pipelines, artifacts aren't collected if nil
+	Artifacts ArtifactStore
+
+	// Secrets are added to the environment of make targets and stages of pipelines,
+	// their values are masked in logs and descriptions of the task
+	Secrets Secrets
+
+	// Env is added to the environment of make targets and stages of pipelines of all repositories
+	Env []string
+
+	// Coverage contains thresholds of coverage of the code by tests
+	Coverage CoverageConfig
+
+	// Toolchains are GOROOT directories of Go versions for cells of matrix builds, e.g. "1.11": "/usr/local/go1.11",
+	// the toolchain of the service is used for builds without a Go version
+	Toolchains map[string]string
+}
+
+// ModulesConfig contains settings of Go modules
+type ModulesConfig struct {
+	Proxy   string // Proxy is a value of GOPROXY, default of Go is used if empty
+	Private string // Private is a value of GOPRIVATE
+	Flags   string // Flags is a value of GOFLAGS
+	Cache   string // Cache is a module download cache shared by all builds, it is created in WorkspaceDir if empty
+}
+
 // Local represent simple local builder (it runs tasks on current environment)
 type Local struct {
-	log logrus.FieldLogger
+	log    logrus.FieldLogger
+	config LocalConfig
 }
 
 // NewLocal returns an instance of Local runner
-func NewLocal(log logrus.FieldLogger) *Local {
+func NewLocal(log logrus.FieldLogger, config LocalConfig) *Local {
+	if len(config.MakefileTemplate) == 0 {
+		config.MakefileTemplate = os.Getenv("GOPATH") + "/src/github.com/k8s-community/cicd/templates/Makefile.tpl"
+	}
+	if config.Source == nil {
+		config.Source = source.NewGit(source.GitConfig{})
+	}
+	if len(config.Modules.Cache) == 0 {
+		base := config.WorkspaceDir
+		if len(base) == 0 {
+			base = os.TempDir()
+		}
+		config.Modules.Cache = filepath.Join(base, "cicd-mod-cache")
+	}
+
 	return &Local{
-		log: log,
+		log:    log,
+		config: config,
 	}
 }
 
-// Process do CICD work: go get of repo, git checkout to given commit, make test and make deploy
+// Process do CICD work: fetch of repo, checkout of given commit, download of dependencies,
+// make test and make deploy.
+// Every task is processed in its own workspace with separate GOPATH and build cache.
+// Repositories with go.mod are processed in module mode with the module cache shared by all builds.
+// If the repository contains the pipeline file, its stages are processed instead of make targets.
+// Cells of matrix builds use the toolchain of their Go version, tests of cells of other platforms are only compiled.
 func (runner *Local) Process(taskItem task.CICD) {
+	taskItem, steps := timeSteps(taskItem)
+	defer steps.stop()
+
 	logger := runner.log.WithFields(logrus.Fields{"source": taskItem.Prefix, "namespace": taskItem.Namespace, "repo": taskItem.Repo, "commit": taskItem.Commit})
 
-	// TODO: it's good to use something like build.Default.GOPATH, but it doesn't work with daemon
-	gopath := os.Getenv("GOPATH")
+	timeouts := runner.config.Timeouts.forTask(taskItem)
+	ctx, cancel := withTimeout(taskItem.Ctx(), timeouts.Task)
+	defer cancel()
+
+	secretEnv := trustedSecrets(runner.config.Secrets, taskItem)
+	if len(secretEnv) > 0 {
+		ctx, taskItem = maskSecrets(ctx, taskItem, secretEnv)
+	}
+
+	log := taskItem.LogWriter()
+
+	cellEnv, err := runner.cellEnv(taskItem.Cell)
+	if err != nil {
+		logger.Errorf("Couldn't prepare the cell of the matrix: %s", err)
+		processCommandResult(taskItem.ID, taskItem.Callback, "", err)
+		return
+	}
 
 	url := fmt.Sprintf("%s/%s/%s", taskItem.Prefix, taskItem.Namespace, taskItem.Repo)
-	dir := fmt.Sprintf("%s/src/%s", gopath, url)
 
-	logger.Infof("Remove dir %s", dir)
-	err := os.RemoveAll(dir)
+	taskItem.Step(task.StepFetch)
+	ws, err := newWorkspace(runner.config.WorkspaceDir, taskItem.ID, url)
 	processCommandResult(taskItem.ID, taskItem.Callback, "", err)
 	if err != nil {
-		logger.Errorf("Couldn't remove directory %s: %s", dir, err)
+		logger.Errorf("Couldn't create workspace: %s", err)
 		return
 	}
+	logger.Infof("Workspace %s is created", ws.root)
+	defer runner.cleanup(logger, ws)
+
+	dir := ws.dir
 
 	var output string
 
-	out, err := runCommand(logger, []string{}, gopath, "go", "get", "-v", "-d", url+"/...")
+	repo := source.Repository{URL: taskItem.RemoteURL(), Commit: taskItem.Commit}
+	out, err := runSource(ctx, timeouts.Step, log, func(ctx context.Context, log io.Writer) error {
+		return runner.config.Source.Fetch(ctx, repo, dir, log)
+	})
 	output += out
 	processCommandResult(taskItem.ID, taskItem.Callback, output, err)
 	if err != nil {
-		logger.Errorf("Go get returned error: %v", err)
+		logger.Errorf("Fetching of the repository returned error: %v", err)
+		return
 	}
 
-	out, err = runCommand(logger, []string{}, dir, "git", "checkout", taskItem.Commit)
+	taskItem.Step(task.StepCheckout)
+	out, err = runSource(ctx, timeouts.Step, log, func(ctx context.Context, log io.Writer) error {
+		return runner.config.Source.Checkout(ctx, repo, dir, log)
+	})
 	output += out
 	processCommandResult(taskItem.ID, taskItem.Callback, output, err)
 	if err != nil {
 		return
 	}
 
-	buildPath, version, err := parseOriginalMakefile(gopath + "/src/" + url + "/Makefile")
+	taskItem.Step(task.StepPrepare)
+	out, err = runner.downloadDependencies(ctx, logger, timeouts, log, ws)
+	output += out
+	processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+	if err != nil && (ws.modules || isInterrupted(err)) {
+		return
+	}
+
+	definition, err := pipeline.Load(filepath.Join(dir, pipeline.FileName))
+	// deploys are built once by the default toolchain, the matrix is built for other tasks
+	if err == nil && taskItem.Cell == nil && taskItem.Type != cicd.TaskDeploy && len(definition.Cells()) > 0 {
+		err = expandMatrix(taskItem, definition.Cells())
+		if err != nil {
+			processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+		}
+		return
+	}
+	if err == nil {
+		runner.runPipeline(ctx, logger, taskItem, timeouts, definition, ws, url, output, append(cellEnv, secretEnv...))
+		return
+	}
+	if !os.IsNotExist(err) {
+		logger.Errorf("Pipeline reading failed: %s", err)
+		processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+		return
+	}
+
+	buildPath, version, err := parseOriginalMakefile(filepath.Join(dir, "Makefile"))
 	if err != nil {
 		logger.Errorf("Makefile reading failed: %s", err)
 		processCommandResult(
@@ -74,10 +201,7 @@ func (runner *Local) Process(taskItem task.CICD) {
 	}
 
 	// Prepare typical Makefile by template from k8s-community/k8sapp
-	out, err = runCommand(
-		logger, []string{}, dir, "cp",
-		os.Getenv("GOPATH")+"/src/github.com/k8s-community/cicd/templates/Makefile.tpl", "./Makefile",
-	)
+	out, err = runCommand(ctx, logger, timeouts.Step, log, ws.env, dir, "cp", runner.config.MakefileTemplate, "./Makefile")
 	output += out
 	processCommandResult(taskItem.ID, taskItem.Callback, output, err)
 	if err != nil {
@@ -88,25 +212,39 @@ func (runner *Local) Process(taskItem task.CICD) {
 		version = taskItem.Version
 	}
 
-	userEnv := []string{
-		"NAMESPACE=" + taskItem.Namespace,
-		"APP=" + taskItem.Repo,
-		"PROJECT=" + url,
-		"BUILD_PATH=" + buildPath,
-		"KUBE_CONTEXT=" + "gke_tenerife-241408_europe-west1-b_tenerife", // todo: remove this spike
-		"RELEASE=" + version,
-		"REGISTRY=" + "eu.gcr.io/tenerife-241408", // todo: remove this spike
-	}
+	userEnv := append(append([]string(nil), ws.env...),
+		"NAMESPACE="+taskItem.Namespace,
+		"APP="+taskItem.Repo,
+		"PROJECT="+url,
+		"BUILD_PATH="+buildPath,
+		"RELEASE="+version,
+	)
+	userEnv = append(append(append(userEnv, runner.config.Env...), cellEnv...), secretEnv...)
 
-	out, err = runCommand(logger, userEnv, dir, "make", "test")
+	taskItem.Step(task.StepTest)
+	profile := filepath.Join(ws.root, "coverage.out")
+	if platformOf(taskItem, hostPlatform) != hostPlatform {
+		// binaries of other platforms couldn't be run, so tests are only compiled
+		out, err = runCommand(ctx, logger, timeouts.Step, log, userEnv, dir, "make", "compile")
+	} else {
+		testEnv := append(userEnv[:len(userEnv):len(userEnv)], "TESTFLAGS=-json -coverprofile="+profile)
+		out, err = runTests(ctx, logger, timeouts, taskItem, testreport.NewCollector(log), testEnv, dir, "make", "test")
+	}
 	output += out
 	processCommandResult(taskItem.ID, taskItem.Callback, output, err)
 	if err != nil {
 		return
 	}
 
+	testCoverage, err := runner.checkCoverage(logger, taskItem, profile)
+	processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+	if err != nil {
+		return
+	}
+
 	if taskItem.Type == cicd.TaskDeploy {
-		out, err = runCommand(logger, userEnv, dir, "make", "deploy")
+		taskItem.Step(task.StepDeploy)
+		out, err = runCommand(ctx, logger, timeouts.Step, log, userEnv, dir, "make", "deploy")
 		output += out
 		processCommandResult(taskItem.ID, taskItem.Callback, output, err)
 		if err != nil {
@@ -114,15 +252,190 @@ func (runner *Local) Process(taskItem task.CICD) {
 		}
 	}
 
+	runner.saveBaseline(logger, taskItem, testCoverage)
 	taskItem.Callback(taskItem.ID, ghIntegr.StateSuccess, output)
 }
 
-func runCommand(logger logrus.FieldLogger, env []string, dir, name string, arg ...string) (string, error) {
+// runPipeline processes stages of the pipeline declared in the repository instead of the Makefile targets,
+// extraEnv contains environment of the cell of the matrix build and secrets
+func (runner *Local) runPipeline(
+	ctx context.Context, logger logrus.FieldLogger, taskItem task.CICD, timeouts Timeouts,
+	definition *pipeline.Pipeline, ws *workspace, url, output string, extraEnv []string,
+) {
+	log := taskItem.LogWriter()
+	dir := ws.dir
+
+	var branches []string
+	if definition.NeedsBranches() && len(taskItem.Branch) > 0 {
+		// shallow fetches don't know remote branches containing the commit, so the branch of the task is used
+		branches = []string{strings.TrimPrefix(taskItem.Branch, "refs/heads/")}
+	} else if definition.NeedsBranches() {
+		out, err := runCommand(ctx, logger, timeouts.Step, ioutil.Discard, ws.env, dir, "git", "branch", "-r", "--contains", taskItem.Commit)
+		if err != nil {
+			processCommandResult(taskItem.ID, taskItem.Callback, output+out, err)
+			return
+		}
+		branches = remoteBranches(out)
+	}
+
+	env := append(append([]string(nil), ws.env...),
+		"NAMESPACE="+taskItem.Namespace,
+		"APP="+taskItem.Repo,
+		"PROJECT="+url,
+		"COMMIT="+taskItem.Commit,
+		"TASK="+taskItem.Type,
+		"RELEASE="+taskItem.Version,
+	)
+	env = append(append(env, runner.config.Env...), extraEnv...)
+	tests := testreport.NewCollector(log)
+	platform := platformOf(taskItem, hostPlatform)
+	var testCoverage *cicd.Coverage
+
+	for _, stage := range definition.Stages {
+		if !stage.When.Match(taskItem.Type, branches) || !stage.When.MatchPlatform(platform) {
+			logger.Infof("Skip stage %s", stage.Name)
+			continue
+		}
+
+		taskItem.Step(stage.Name)
+		stageEnv := append(env[:len(env):len(env)], definition.Environment(stage)...)
+		for _, command := range stage.Commands {
+			var out string
+			var err error
+			if stage.Tests {
+				out, err = runTests(ctx, logger, timeouts, taskItem, tests, stageEnv, filepath.Join(dir, stage.Dir), "sh", "-c", command)
+			} else {
+				out, err = runCommand(ctx, logger, timeouts.Step, log, stageEnv, filepath.Join(dir, stage.Dir), "sh", "-c", command)
+			}
+			output += out
+			processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+			if err != nil {
+				return
+			}
+		}
+
+		if len(stage.Artifacts) > 0 && runner.config.Artifacts != nil {
+			err := collectArtifacts(runner.config.Artifacts, taskItem, stage.Name, stage.Artifacts, dir)
+			if err != nil {
+				logger.Errorf("Couldn't collect artifacts of stage %s: %s", stage.Name, err)
+				processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+				return
+			}
+		}
+
+		if len(stage.Coverage) > 0 {
+			c, err := runner.checkCoverage(logger, taskItem, filepath.Join(dir, stage.Coverage))
+			processCommandResult(taskItem.ID, taskItem.Callback, output, err)
+			if err != nil {
+				return
+			}
+			if c != nil {
+				testCoverage = c
+			}
+		}
+	}
+
+	runner.saveBaseline(logger, taskItem, testCoverage)
+	taskItem.Callback(taskItem.ID, ghIntegr.StateSuccess, output)
+}
+
+// downloadDependencies switches the workspace to module mode if the repository contains go.mod and downloads
+// dependencies. In GOPATH mode some packages might be not buildable, so errors of go get might be ignored.
+func (runner *Local) downloadDependencies(
+	ctx context.Context, logger logrus.FieldLogger, timeouts Timeouts, log io.Writer, ws *workspace,
+) (string, error) {
+	_, err := os.Stat(filepath.Join(ws.dir, "go.mod"))
+	if os.IsNotExist(err) {
+		ws.useGOPATH()
+		out, err := runCommand(ctx, logger, timeouts.Step, log, ws.env, ws.dir, "go", "get", "-v", "-d", "./...")
+		if err != nil {
+			logger.Errorf("Go get returned error: %v", err)
+		}
+		return out, err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(runner.config.Modules.Cache, 0755)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create module cache: %s", err)
+	}
+
+	ws.useModules(runner.config.Modules)
+	return runCommand(ctx, logger, timeouts.Step, log, ws.env, ws.dir, "go", "mod", "download")
+}
+
+// cleanup removes the workspace of the task unless workspaces are kept for debugging
+func (runner *Local) cleanup(logger logrus.FieldLogger, ws *workspace) {
+	if runner.config.KeepWorkspaces {
+		logger.Infof("Workspace %s is kept", ws.root)
+		return
+	}
+
+	err := ws.remove()
+	if err != nil {
+		logger.Errorf("Couldn't remove workspace %s: %s", ws.root, err)
+	}
+}
+
+// remoteBranches parses output of "git branch -r" and returns names of branches without the remote name
+func remoteBranches(out string) []string {
+	var branches []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.Contains(line, " -> ") {
+			continue
+		}
+		if i := strings.Index(line, "/"); i >= 0 {
+			line = line[i+1:]
+		}
+		branches = append(branches, line)
+	}
+	return branches
+}
+
+// withTimeout returns a context which is done after the timeout, zero timeout means no limit
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// runSource calls the source provider with the step timeout, its output is written to the log and returned
+func runSource(ctx context.Context, stepTimeout time.Duration, log io.Writer, call func(ctx context.Context, log io.Writer) error) (string, error) {
+	if ctx.Err() != nil {
+		return "", interruption(ctx, stepTimeout)
+	}
+
+	stepCtx, cancel := withTimeout(ctx, stepTimeout)
+	defer cancel()
+
+	lines := newLineWriter(log)
+	defer lines.Flush()
+
+	var out bytes.Buffer
+	err := call(stepCtx, io.MultiWriter(&out, lines))
+	if stepCtx.Err() != nil {
+		err = interruption(ctx, stepTimeout)
+	}
+
+	return out.String(), err
+}
+
+// runCommand executes the command in its own process group, its output is written to the log line by line.
+// If the task context is done or the step timeout is exceeded, the whole process group is killed.
+func runCommand(ctx context.Context, logger logrus.FieldLogger, stepTimeout time.Duration, log io.Writer, env []string, dir, name string, arg ...string) (string, error) {
 	logger = logger.WithFields(logrus.Fields{
 		"command":        name + " " + strings.Join(arg, " "),
-		"additional_env": strings.Join(env, " "),
+		"additional_env": mask(ctx, strings.Join(env, " ")),
 	})
 
+	if ctx.Err() != nil {
+		return "", interruption(ctx, stepTimeout)
+	}
+
 	logger.Infof("Execute command...")
 	command := exec.Command(name, arg...)
 
@@ -130,11 +443,45 @@ func runCommand(logger logrus.FieldLogger, env []string, dir, name string, arg .
 	command.Env = osEnv
 	command.Dir = dir
 
-	out, err := command.CombinedOutput()
-	commandOut := string(out)
+	fmt.Fprintf(log, "$ %s %s\n", name, strings.Join(arg, " "))
+	lines := newLineWriter(log)
+	defer lines.Flush()
+
+	var out bytes.Buffer
+	output := io.MultiWriter(&out, lines)
+	command.Stdout = output
+	command.Stderr = output
+	process.SetGroup(command)
 
-	if len(out) > 0 {
-		logger.Info(commandOut)
+	err := command.Start()
+	if err != nil {
+		logger.Errorf("Command failed: %s", err)
+		return "", err
+	}
+
+	stepCtx, cancel := withTimeout(ctx, stepTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-stepCtx.Done():
+		logger.Errorf("Command was interrupted, kill it...")
+		killErr := process.KillGroup(command)
+		if killErr != nil {
+			logger.Errorf("Couldn't kill process group: %s", killErr)
+		}
+		<-done
+		err = interruption(ctx, stepTimeout)
+	}
+
+	commandOut := out.String()
+	if len(commandOut) > 0 {
+		logger.Info(mask(ctx, commandOut))
 	}
 
 	if err != nil {
@@ -146,8 +493,28 @@ func runCommand(logger logrus.FieldLogger, env []string, dir, name string, arg .
 	return commandOut, nil
 }
 
+// runTests executes the command which prints `go test -json` output, the plain text of the output goes to the log
+// and to the result, parsed results of tests are reported to the tracker of the task
+func runTests(
+	ctx context.Context, logger logrus.FieldLogger, timeouts Timeouts, taskItem task.CICD,
+	tests *testreport.Collector, env []string, dir, name string, arg ...string,
+) (string, error) {
+	out, err := runCommand(ctx, logger, timeouts.Step, tests, env, dir, name, arg...)
+	tests.Flush()
+
+	if report := tests.Report(); report != nil {
+		maskReport(ctx, report)
+		taskItem.Tests(report)
+	}
+	return testreport.Text(out), err
+}
+
 func processCommandResult(taskID string, callback task.Callback, output string, err error) {
-	if err != nil {
+	if err == errCancelled {
+		callback(taskID, task.StateCancelled, output+" \n\nCancelled: "+err.Error())
+	} else if isTimeout(err) {
+		callback(taskID, task.StateTimeout, output+" \n\nTimeout: "+err.Error())
+	} else if err != nil {
 		callback(taskID, ghIntegr.StateError, output+" \n\nError: "+err.Error())
 	} else {
 		callback(taskID, ghIntegr.StatePending, output)
@@ -0,0 +1,292 @@
+package runners
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/pipeline"
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/builder/testreport"
+)
+
+func TestRunCommandTimeout(t *testing.T) {
+	logger := logrus.WithField("runner", "local")
+	dir := os.TempDir()
+
+	// the child process holds the output, so the command can't finish until the whole group is killed
+	script := "sleep 10 & echo started; sleep 10"
+
+	start := time.Now()
+	out, err := runCommand(context.Background(), logger, 100*time.Millisecond, ioutil.Discard, nil, dir, "sh", "-c", script)
+	if !isTimeout(err) {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if !err.(timeoutError).step {
+		t.Errorf("Expected step timeout, got %v", err)
+	}
+	if out != "started\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Process group wasn't killed in time")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = runCommand(ctx, logger, time.Minute, ioutil.Discard, nil, dir, "sh", "-c", script)
+	if !isTimeout(err) || err.(timeoutError).step {
+		t.Errorf("Expected task timeout, got %v", err)
+	}
+
+	_, err = runCommand(ctx, logger, time.Minute, ioutil.Discard, nil, dir, "true")
+	if !isTimeout(err) {
+		t.Errorf("Command mustn't be started after task timeout, got %v", err)
+	}
+
+	log := new(bytes.Buffer)
+	out, err = runCommand(context.Background(), logger, time.Minute, log, nil, dir, "echo", "ok")
+	if err != nil || out != "ok\n" {
+		t.Errorf("Unexpected result of the command: %q, %v", out, err)
+	}
+	if log.String() != "$ echo ok\nok\n" {
+		t.Errorf("Unexpected log of the command: %q", log.String())
+	}
+}
+
+func TestRunCommandCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := runCommand(ctx, logrus.WithField("runner", "local"), time.Minute, ioutil.Discard, nil, os.TempDir(), "sleep", "10")
+	if err != errCancelled {
+		t.Errorf("Expected cancellation error, got %v", err)
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	serviceLog := new(bytes.Buffer)
+	logger := logrus.New()
+	logger.Out = serviceLog
+	env := []string{"TOKEN=top-secret"}
+
+	var description string
+	log := new(bytes.Buffer)
+	taskItem := task.CICD{
+		Log: log,
+		Callback: func(taskID string, status string, desc string) {
+			description = desc
+		},
+	}
+	ctx, taskItem := maskSecrets(context.Background(), taskItem, env)
+
+	out, err := runCommand(ctx, logger, time.Minute, taskItem.LogWriter(), env, os.TempDir(), "sh", "-c", "echo token is $TOKEN")
+	if err != nil || out != "token is top-secret\n" {
+		t.Fatalf("Unexpected result of the command: %q, %v", out, err)
+	}
+	processCommandResult("1", taskItem.Callback, out, err)
+
+	if log.String() != "$ sh -c echo token is $TOKEN\ntoken is ********\n" {
+		t.Errorf("Unexpected log of the command: %q", log.String())
+	}
+	if strings.Contains(serviceLog.String(), "top-secret") {
+		t.Errorf("Service log contains the secret: %q", serviceLog.String())
+	}
+	if description != "token is ********\n" {
+		t.Errorf("Unexpected description %q", description)
+	}
+}
+
+func TestTrustedSecrets(t *testing.T) {
+	secrets := staticSecrets{"TOKEN=top-secret"}
+
+	if env := trustedSecrets(secrets, task.CICD{Trusted: true}); len(env) != 1 {
+		t.Errorf("Trusted task didn't get secrets: %v", env)
+	}
+	if env := trustedSecrets(secrets, task.CICD{Branch: "refs/pull/7/head"}); len(env) != 0 {
+		t.Errorf("Build of the pull request got secrets: %v", env)
+	}
+	if env := trustedSecrets(nil, task.CICD{Trusted: true}); len(env) != 0 {
+		t.Errorf("Unexpected secrets without the store: %v", env)
+	}
+}
+
+func TestMaskTestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	events := `{"Action":"run","Package":"example.com/app","Test":"TestToken"}
+{"Action":"output","Package":"example.com/app","Test":"TestToken","Output":"    app_test.go:10: wrong token top-secret\n"}
+{"Action":"fail","Package":"example.com/app","Test":"TestToken","Elapsed":0.1}
+{"Action":"output","Package":"example.com/app","Output":"FAIL with top-secret\n"}
+{"Action":"fail","Package":"example.com/app","Elapsed":0.2}
+`
+	ioutil.WriteFile(filepath.Join(dir, "events.json"), []byte(events), 0644)
+
+	env := []string{"TOKEN=top-secret"}
+	tracker := &fakeTracker{}
+	ctx, taskItem := maskSecrets(context.Background(), task.CICD{Tracker: tracker}, env)
+
+	logger := logrus.WithField("runner", "local")
+	_, err = runTests(ctx, logger, Timeouts{}, taskItem, testreport.NewCollector(ioutil.Discard), env, dir, "cat", "events.json")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	report := tracker.tests
+	if report == nil || len(report.Packages) != 1 || len(report.Packages[0].Tests) != 1 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if output := report.Packages[0].Tests[0].Output; output != "    app_test.go:10: wrong token ********\n" {
+		t.Errorf("Unexpected output of the test %q", output)
+	}
+	if output := report.Packages[0].Output; strings.Contains(output, "top-secret") {
+		t.Errorf("Output of the package contains the secret: %q", output)
+	}
+}
+
+func TestRemoteBranches(t *testing.T) {
+	out := "  origin/HEAD -> origin/master\n  origin/master\n  origin/release-1.0\n"
+
+	branches := remoteBranches(out)
+	if len(branches) != 2 || branches[0] != "master" || branches[1] != "release-1.0" {
+		t.Errorf("Unexpected branches: %v", branches)
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	definition, err := pipeline.Parse([]byte(`
+env:
+  GREETING: hello
+stages:
+  - name: build
+    dir: app
+    env:
+      TARGET: world
+    commands:
+      - echo "$GREETING $TARGET from $(basename $PWD) of $APP" > ../build.txt
+  - name: deploy
+    commands:
+      - touch deployed
+    when:
+      tasks: [deploy]
+  - name: test
+    commands:
+      - touch first
+      - exit 3
+      - touch second
+  - name: after
+    commands:
+      - touch after
+`))
+	if err != nil {
+		t.Fatalf("Couldn't parse the pipeline: %s", err)
+	}
+
+	ws, err := newWorkspace("", "ID", "github.com/k8s-community/cicd")
+	if err != nil {
+		t.Fatalf("Couldn't create workspace: %s", err)
+	}
+	defer ws.remove()
+	os.MkdirAll(filepath.Join(ws.dir, "app"), 0755)
+
+	var states []string
+	tracker := &fakeTracker{}
+	taskItem := task.CICD{
+		ID: "ID", Type: task.TypeTest, Namespace: "k8s-community", Repo: "cicd", Tracker: tracker,
+		Callback: func(taskID string, state string, description string) {
+			states = append(states, state)
+		},
+	}
+
+	runner := NewLocal(logrus.WithField("runner", "local"), LocalConfig{})
+	runner.runPipeline(context.Background(), logrus.WithField("runner", "local"), taskItem, Timeouts{}, definition, ws, "github.com/k8s-community/cicd", "", nil)
+
+	build, err := ioutil.ReadFile(filepath.Join(ws.dir, "build.txt"))
+	if err != nil || string(build) != "hello world from app of cicd\n" {
+		t.Errorf("Unexpected environment or directory of the stage: %q, %v", build, err)
+	}
+	if len(tracker.steps) != 2 || tracker.steps[0] != "build" || tracker.steps[1] != "test" {
+		t.Errorf("Unexpected stages %v, deploy has to be skipped and the pipeline has to stop at the failed stage", tracker.steps)
+	}
+	for _, file := range []string{"deployed", "second", "after"} {
+		if _, err := os.Stat(filepath.Join(ws.dir, file)); err == nil {
+			t.Errorf("Command which creates %s mustn't be run", file)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ws.dir, "first")); err != nil {
+		t.Errorf("Command before the failed one has to be run: %s", err)
+	}
+	if len(states) == 0 || states[len(states)-1] != task.StateError {
+		t.Errorf("Expected the final state %s, got %v", task.StateError, states)
+	}
+}
+
+func TestRunPipelineShallowBranch(t *testing.T) {
+	definition, err := pipeline.Parse([]byte(`
+stages:
+  - name: release
+    commands:
+      - touch released
+    when:
+      branches: [master]
+`))
+	if err != nil {
+		t.Fatalf("Couldn't parse the pipeline: %s", err)
+	}
+
+	origin, err := ioutil.TempDir("", "cicd-origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(origin)
+
+	ws, err := newWorkspace("", "ID", "github.com/k8s-community/cicd")
+	if err != nil {
+		t.Fatalf("Couldn't create workspace: %s", err)
+	}
+	defer ws.remove()
+	os.MkdirAll(ws.dir, 0755)
+
+	// the workspace gets only the commit, so git doesn't know branches which contain it
+	for _, command := range []struct {
+		dir  string
+		args []string
+	}{
+		{origin, []string{"init", "-q"}},
+		{origin, []string{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "first"}},
+		{ws.dir, []string{"init", "-q"}},
+		{ws.dir, []string{"fetch", "-q", "--depth", "1", "file://" + origin, "HEAD"}},
+		{ws.dir, []string{"checkout", "-q", "FETCH_HEAD"}},
+	} {
+		git := exec.Command("git", command.args...)
+		git.Dir = command.dir
+		if out, err := git.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s: %s", command.args, err, out)
+		}
+	}
+
+	tracker := &fakeTracker{}
+	taskItem := task.CICD{
+		ID: "ID", Type: task.TypeTest, Commit: "FETCH_HEAD", Branch: "refs/heads/master", Tracker: tracker,
+		Callback: func(taskID string, state string, description string) {},
+	}
+
+	runner := NewLocal(logrus.WithField("runner", "local"), LocalConfig{})
+	runner.runPipeline(context.Background(), logrus.WithField("runner", "local"), taskItem, Timeouts{}, definition, ws, "github.com/k8s-community/cicd", "", nil)
+
+	if _, err := os.Stat(filepath.Join(ws.dir, "released")); err != nil {
+		t.Errorf("Stage of the branch of the task has to be run, steps %v: %s", tracker.steps, err)
+	}
+}
@@ -0,0 +1,43 @@
+package runners
+
+import (
+	"bytes"
+	"io"
+)
+
+// lineWriter passes only complete lines to the underlying writer
+type lineWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func newLineWriter(w io.Writer) *lineWriter {
+	return &lineWriter{w: w}
+}
+
+// Write buffers data and writes all complete lines to the underlying writer
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+
+	i := bytes.LastIndexByte(l.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	_, err := l.w.Write(l.buf[:i+1])
+	l.buf = append(l.buf[:0], l.buf[i+1:]...)
+
+	return len(p), err
+}
+
+// Flush writes the rest of buffered data as the last line
+func (l *lineWriter) Flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+
+	_, err := l.w.Write(append(l.buf, '\n'))
+	l.buf = l.buf[:0]
+
+	return err
+}
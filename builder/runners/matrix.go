@@ -0,0 +1,83 @@
+package runners
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// hostPlatform is the platform of the service, tests of cells of other platforms are only compiled
+var hostPlatform = runtime.GOOS + "/" + runtime.GOARCH
+
+// FindToolchains returns GOROOT directories of Go versions installed in the directory,
+// every toolchain is a subdirectory named by its version like ones of golang.org/dl, e.g. go1.11
+func FindToolchains(dir string) (map[string]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read directory of toolchains: %s", err)
+	}
+
+	toolchains := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "go1") {
+			continue
+		}
+		root := filepath.Join(dir, entry.Name())
+		if _, err := os.Stat(filepath.Join(root, "bin", "go")); err != nil {
+			continue
+		}
+		toolchains[strings.TrimPrefix(entry.Name(), "go")] = root
+	}
+
+	return toolchains, nil
+}
+
+// cellEnv returns environment of the cell of the matrix build: the toolchain of its Go version and its target platform.
+// Dependencies are downloaded by the default toolchain, only make targets and stages of pipelines use the environment.
+func (runner *Local) cellEnv(cell *task.Cell) ([]string, error) {
+	if cell == nil {
+		return nil, nil
+	}
+
+	var env []string
+	if len(cell.Go) > 0 {
+		root, ok := runner.config.Toolchains[cell.Go]
+		if !ok {
+			var versions []string
+			for version := range runner.config.Toolchains {
+				versions = append(versions, version)
+			}
+			sort.Strings(versions)
+			return nil, fmt.Errorf("Go %s isn't installed, installed versions: %s", cell.Go, strings.Join(versions, ", "))
+		}
+		env = append(env, "GOROOT="+root, "PATH="+filepath.Join(root, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+	if len(cell.GOOS) > 0 {
+		env = append(env, "GOOS="+cell.GOOS, "GOARCH="+cell.GOARCH)
+	}
+
+	return env, nil
+}
+
+// platformOf returns the target platform of the task in form of GOOS/GOARCH
+func platformOf(taskItem task.CICD, host string) string {
+	if taskItem.Cell == nil || len(taskItem.Cell.GOOS) == 0 {
+		return host
+	}
+	return taskItem.Cell.Platform()
+}
+
+// expandMatrix asks the dispatcher to build cells of the matrix declared in the repository instead of the task
+func expandMatrix(taskItem task.CICD, cells []task.Cell) error {
+	if taskItem.Expand == nil {
+		return errors.New("matrix builds aren't supported by the dispatcher")
+	}
+	return taskItem.Expand(cells)
+}
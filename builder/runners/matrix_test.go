@@ -0,0 +1,121 @@
+package runners
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+func TestFindToolchains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-toolchains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"go1.10", "go1.11rc1", "go1.12", "gotip"} {
+		os.MkdirAll(filepath.Join(dir, name, "bin"), 0755)
+	}
+	for _, name := range []string{"go1.10", "go1.11rc1", "gotip"} {
+		ioutil.WriteFile(filepath.Join(dir, name, "bin", "go"), nil, 0755)
+	}
+
+	toolchains, err := FindToolchains(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := map[string]string{"1.10": filepath.Join(dir, "go1.10"), "1.11rc1": filepath.Join(dir, "go1.11rc1")}
+	if len(toolchains) != len(expected) {
+		t.Errorf("Expected toolchains %v, got %v", expected, toolchains)
+	}
+	for version, root := range expected {
+		if toolchains[version] != root {
+			t.Errorf("Expected GOROOT %s of Go %s, got %s", root, version, toolchains[version])
+		}
+	}
+
+	_, err = FindToolchains(filepath.Join(dir, "absent"))
+	if err == nil {
+		t.Errorf("Expected error for absent directory")
+	}
+}
+
+func TestCellEnv(t *testing.T) {
+	runner := NewLocal(logrus.WithField("runner", "local"), LocalConfig{
+		Toolchains: map[string]string{"1.10": "/opt/go1.10", "1.11": "/opt/go1.11"},
+	})
+
+	env, err := runner.cellEnv(nil)
+	if err != nil || env != nil {
+		t.Errorf("Task without the cell mustn't change environment: %v, %v", env, err)
+	}
+
+	env, err = runner.cellEnv(&task.Cell{Go: "1.11", GOOS: "windows", GOARCH: "amd64"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	joined := strings.Join(env, " ")
+	for _, variable := range []string{"GOROOT=/opt/go1.11", "PATH=/opt/go1.11/bin" + string(os.PathListSeparator), "GOOS=windows", "GOARCH=amd64"} {
+		if !strings.Contains(joined, variable) {
+			t.Errorf("Environment %v doesn't contain %s", env, variable)
+		}
+	}
+
+	_, err = runner.cellEnv(&task.Cell{Go: "1.9"})
+	if err == nil || !strings.Contains(err.Error(), "installed versions: 1.10, 1.11") {
+		t.Errorf("Expected error for Go which isn't installed, got %v", err)
+	}
+}
+
+func TestPlatformOf(t *testing.T) {
+	tests := []struct {
+		cell     *task.Cell
+		platform string
+	}{
+		{cell: nil, platform: "linux/amd64"},
+		{cell: &task.Cell{Go: "1.11"}, platform: "linux/amd64"},
+		{cell: &task.Cell{GOOS: "darwin", GOARCH: "arm64"}, platform: "darwin/arm64"},
+	}
+
+	for _, test := range tests {
+		if platform := platformOf(task.CICD{Cell: test.cell}, "linux/amd64"); platform != test.platform {
+			t.Errorf("Expected platform %s, got %s", test.platform, platform)
+		}
+	}
+}
+
+func TestKubernetesCell(t *testing.T) {
+	runner, _, server := prepareKubernetes([]string{podPhaseSucceeded}, "")
+	defer server.Close()
+	runner.config.Images = map[string]string{"1.11": "golang:1.11"}
+
+	taskItem := task.NewCICD(nil, "ID", task.TypeTest, "github.com", "cicd", "master", "", "k8s-community")
+	taskItem.Cell = &task.Cell{Go: "1.11", GOOS: "windows", GOARCH: "amd64"}
+	job, err := runner.newJob(*taskItem, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	container := job.Spec.Template.Spec.Containers[0]
+	if container.Image != "golang:1.11" {
+		t.Errorf("Unexpected image %s", container.Image)
+	}
+	env := make(map[string]string)
+	for _, variable := range container.Env {
+		env[variable.Name] = variable.Value
+	}
+	if env["GOOS"] != "windows" || env["GOARCH"] != "amd64" || env["TEST_TARGET"] != "compile" {
+		t.Errorf("Unexpected environment of the cell: %v", env)
+	}
+
+	taskItem.Cell.Go = "1.9"
+	_, err = runner.newJob(*taskItem, nil)
+	if err == nil {
+		t.Errorf("Expected error for Go version without image")
+	}
+}
@@ -0,0 +1,117 @@
+package runners
+
+import (
+	"sync"
+	"time"
+
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/metrics"
+)
+
+var stepDuration = metrics.DefaultRegistry.NewHistogram(
+	"cicd_build_step_duration_seconds", "Duration of steps of builds", metrics.DurationBuckets, "type", "step",
+)
+
+// Labels of steps and types which names are chosen by repositories and requests,
+// so labels have a fixed set of values
+const (
+	stepPipeline = "pipeline"
+	typeOther    = "other"
+)
+
+// stepTimer measures duration of steps of the task and passes all events to the tracker of the task
+type stepTimer struct {
+	tracker  task.Tracker
+	taskType string
+
+	mx      *sync.Mutex
+	step    string
+	started time.Time
+}
+
+// timeSteps returns the task which reports durations of its steps, the timer has to be stopped
+// when processing of the task is done to measure the last step
+func timeSteps(taskItem task.CICD) (task.CICD, *stepTimer) {
+	taskType := taskItem.Type
+	if !task.KnownType(taskType) {
+		taskType = typeOther
+	}
+
+	timer := &stepTimer{
+		tracker:  taskItem.Tracker,
+		taskType: taskType,
+		mx:       &sync.Mutex{},
+	}
+	taskItem.Tracker = timer
+
+	return taskItem, timer
+}
+
+// Started passes the event to the tracker of the task
+func (timer *stepTimer) Started(taskID string, workerID int) {
+	if timer.tracker != nil {
+		timer.tracker.Started(taskID, workerID)
+	}
+}
+
+// Step measures the previous step and passes the event to the tracker of the task
+func (timer *stepTimer) Step(taskID string, step string) {
+	timer.mx.Lock()
+	timer.observe()
+	timer.step, timer.started = step, time.Now()
+	timer.mx.Unlock()
+
+	if timer.tracker != nil {
+		timer.tracker.Step(taskID, step)
+	}
+}
+
+// Artifact passes the event to the tracker of the task
+func (timer *stepTimer) Artifact(taskID string, artifact cicd.Artifact) {
+	if timer.tracker != nil {
+		timer.tracker.Artifact(taskID, artifact)
+	}
+}
+
+// Tests passes the event to the tracker of the task
+func (timer *stepTimer) Tests(taskID string, report *cicd.TestReport) {
+	if timer.tracker != nil {
+		timer.tracker.Tests(taskID, report)
+	}
+}
+
+// Coverage passes the event to the tracker of the task
+func (timer *stepTimer) Coverage(taskID string, coverage *cicd.Coverage) {
+	if timer.tracker != nil {
+		timer.tracker.Coverage(taskID, coverage)
+	}
+}
+
+// Finished passes the event to the tracker of the task
+func (timer *stepTimer) Finished(taskID string) {
+	if timer.tracker != nil {
+		timer.tracker.Finished(taskID)
+	}
+}
+
+// stop measures the last step
+func (timer *stepTimer) stop() {
+	timer.mx.Lock()
+	timer.observe()
+	timer.step = ""
+	timer.mx.Unlock()
+}
+
+func (timer *stepTimer) observe() {
+	if len(timer.step) == 0 {
+		return
+	}
+
+	step := timer.step
+	if !task.KnownStep(step) {
+		// stages of pipelines are named by repositories
+		step = stepPipeline
+	}
+	stepDuration.Observe(time.Since(timer.started).Seconds(), timer.taskType, step)
+}
@@ -0,0 +1,35 @@
+package runners
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/metrics"
+)
+
+func TestStepLabels(t *testing.T) {
+	taskItem, timer := timeSteps(task.CICD{ID: "ID", Type: "metrics-test"})
+	taskItem.Step("metrics-stage")
+	taskItem.Step(task.StepTest)
+	timer.stop()
+
+	buf := &bytes.Buffer{}
+	err := metrics.DefaultRegistry.Write(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if strings.Contains(buf.String(), "metrics-") {
+		t.Errorf("Names of stages and types of requests have to be replaced:\n%s", buf.String())
+	}
+	for _, line := range []string{
+		`cicd_build_step_duration_seconds_count{type="other",step="pipeline"} `,
+		`cicd_build_step_duration_seconds_count{type="other",step="test"} `,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Metrics don't contain %s:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package runners
+
+import (
+	"context"
+
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/secrets"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// Secrets provides secrets of repositories to builds
+type Secrets interface {
+	// Environment returns secrets available for the repository in form of "key=value"
+	Environment(namespace, repo string) []string
+}
+
+type maskerKey struct{}
+
+// trustedSecrets returns secrets of the repository of the task, untrusted tasks get no secrets
+func trustedSecrets(s Secrets, taskItem task.CICD) []string {
+	if s == nil || !taskItem.Trusted {
+		return nil
+	}
+	return s.Environment(taskItem.Namespace, taskItem.Repo)
+}
+
+// maskSecrets returns the task whose log and callback descriptions have masked values of the environment,
+// the context carries the masker to hide the values in logs of the service
+func maskSecrets(ctx context.Context, taskItem task.CICD, env []string) (context.Context, task.CICD) {
+	masker := secrets.NewMasker(env)
+
+	if taskItem.Log != nil {
+		taskItem.Log = masker.Writer(taskItem.Log)
+	}
+	if callback := taskItem.Callback; callback != nil {
+		taskItem.Callback = func(taskID string, status string, description string) {
+			callback(taskID, status, masker.Mask(description))
+		}
+	}
+
+	return context.WithValue(ctx, maskerKey{}, masker), taskItem
+}
+
+// mask hides values of secrets of the task in the text
+func mask(ctx context.Context, s string) string {
+	masker, ok := ctx.Value(maskerKey{}).(*secrets.Masker)
+	if !ok {
+		return s
+	}
+	return masker.Mask(s)
+}
+
+// maskReport hides values of secrets of the task in outputs of failed and skipped tests
+func maskReport(ctx context.Context, report *cicd.TestReport) {
+	for i := range report.Packages {
+		p := &report.Packages[i]
+		p.Output = mask(ctx, p.Output)
+		for j := range p.Tests {
+			p.Tests[j].Output = mask(ctx, p.Tests[j].Output)
+		}
+	}
+}
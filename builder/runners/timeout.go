@@ -0,0 +1,65 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// Timeouts defines default limits of execution time, they are used if the task doesn't define its own ones
+type Timeouts struct {
+	Task time.Duration // Task limits execution time of the whole task, zero means no limit
+	Step time.Duration // Step limits execution time of every command, zero means no limit
+}
+
+// forTask returns limits of execution time of the given task
+func (t Timeouts) forTask(taskItem task.CICD) Timeouts {
+	if taskItem.Timeout > 0 {
+		t.Task = taskItem.Timeout
+	}
+	if taskItem.StepTimeout > 0 {
+		t.Step = taskItem.StepTimeout
+	}
+
+	return t
+}
+
+// timeoutError is returned when a command or the whole task exceeds its execution time
+type timeoutError struct {
+	step  bool          // step marks what the command exceeded its own limit, not the task's one
+	limit time.Duration // limit is a limit of the step
+}
+
+func (e timeoutError) Error() string {
+	if e.step {
+		return fmt.Sprintf("command exceeded its execution time limit %s", e.limit)
+	}
+	return "build exceeded its execution time limit"
+}
+
+func isTimeout(err error) bool {
+	_, ok := err.(timeoutError)
+	return ok
+}
+
+// errCancelled is returned when the task is cancelled by user's request
+var errCancelled = errors.New("build was cancelled")
+
+// interruption returns the reason why the command was interrupted: cancellation of the task or exceeded timeout
+func interruption(ctx context.Context, stepTimeout time.Duration) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return errCancelled
+	case context.DeadlineExceeded:
+		return timeoutError{}
+	}
+	return timeoutError{step: true, limit: stepTimeout}
+}
+
+// isInterrupted returns true if processing of the task has to be stopped
+func isInterrupted(err error) bool {
+	return err == errCancelled || isTimeout(err)
+}
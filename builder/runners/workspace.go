@@ -0,0 +1,87 @@
+package runners
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// workspace is an isolated directory of the task with its own GOPATH and build cache
+type workspace struct {
+	root   string   // root directory of the workspace
+	gopath string   // GOPATH of the task
+	dir    string   // directory of the repository inside GOPATH
+	env    []string // env points Go tools to the workspace
+
+	modules bool // modules marks what the repository is processed in module mode
+}
+
+// newWorkspace creates a workspace of the task in the base directory, temporary directory is used if base is empty
+func newWorkspace(base, taskID, url string) (*workspace, error) {
+	if len(base) > 0 {
+		err := os.MkdirAll(base, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := ioutil.TempDir(base, "cicd-"+taskID+"-")
+	if err != nil {
+		return nil, err
+	}
+
+	gopath := filepath.Join(root, "go")
+	cache := filepath.Join(root, "cache")
+	for _, dir := range []string{gopath, cache} {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			os.RemoveAll(root)
+			return nil, err
+		}
+	}
+
+	return &workspace{
+		root:   root,
+		gopath: gopath,
+		dir:    filepath.Join(gopath, "src", url),
+		env: []string{
+			"GOPATH=" + gopath,
+			"GOCACHE=" + cache,
+		},
+	}, nil
+}
+
+// useGOPATH makes Go tools work in GOPATH mode
+func (w *workspace) useGOPATH() {
+	w.env = append(w.env, "GO111MODULE=off")
+}
+
+// useModules makes Go tools work in module mode with the settings of modules
+func (w *workspace) useModules(config ModulesConfig) {
+	w.modules = true
+	w.env = append(w.env, "GO111MODULE=on", "GOMODCACHE="+config.Cache)
+
+	settings := [][2]string{
+		{"GOPROXY", config.Proxy},
+		{"GOPRIVATE", config.Private},
+		{"GOFLAGS", config.Flags},
+	}
+	for _, setting := range settings {
+		if len(setting[1]) > 0 {
+			w.env = append(w.env, setting[0]+"="+setting[1])
+		}
+	}
+}
+
+// remove deletes the workspace.
+// Go makes module cache read-only, so permissions are fixed before removing.
+func (w *workspace) remove() error {
+	filepath.Walk(w.root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && info.Mode().Perm()&0200 == 0 {
+			os.Chmod(path, info.Mode().Perm()|0200)
+		}
+		return nil
+	})
+
+	return os.RemoveAll(w.root)
+}
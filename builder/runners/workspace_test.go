@@ -0,0 +1,84 @@
+package runners
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestWorkspace(t *testing.T) {
+	base, err := ioutil.TempDir("", "workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	first, err := newWorkspace(base, "1", "github.com/k8s-community/cicd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	second, err := newWorkspace(base, "1", "github.com/k8s-community/cicd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if first.root == second.root {
+		t.Errorf("Workspaces of tasks have to be different")
+	}
+	if !strings.HasPrefix(first.dir, filepath.Join(first.gopath, "src")) {
+		t.Errorf("Repository %s is outside GOPATH %s", first.dir, first.gopath)
+	}
+
+	// module cache is read-only
+	readOnly := filepath.Join(first.gopath, "pkg", "mod", "module@v1.0.0")
+	os.MkdirAll(readOnly, 0755)
+	ioutil.WriteFile(filepath.Join(readOnly, "go.mod"), []byte("module module"), 0444)
+	os.Chmod(readOnly, 0555)
+
+	err = first.remove()
+	if err != nil {
+		t.Fatalf("Couldn't remove workspace: %s", err)
+	}
+	if _, err := os.Stat(first.root); !os.IsNotExist(err) {
+		t.Errorf("Workspace %s was not removed", first.root)
+	}
+}
+
+func TestDownloadDependenciesModules(t *testing.T) {
+	base, err := ioutil.TempDir("", "workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+
+	runner := NewLocal(logrus.WithField("runner", "local"), LocalConfig{
+		WorkspaceDir: base,
+		Modules:      ModulesConfig{Proxy: "off", Flags: "-mod=mod"},
+	})
+
+	ws, err := newWorkspace(base, "1", "github.com/k8s-community/cicd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	os.MkdirAll(ws.dir, 0755)
+	ioutil.WriteFile(filepath.Join(ws.dir, "go.mod"), []byte("module github.com/k8s-community/cicd\n"), 0644)
+
+	_, err = runner.downloadDependencies(context.Background(), runner.log, Timeouts{}, ioutil.Discard, ws)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	env := strings.Join(ws.env, " ")
+	if !ws.modules || !strings.Contains(env, "GO111MODULE=on") || !strings.Contains(env, "GOPROXY=off") ||
+		!strings.Contains(env, "GOFLAGS=-mod=mod") || !strings.Contains(env, "GOMODCACHE="+filepath.Join(base, "cicd-mod-cache")) {
+		t.Errorf("Workspace is not in module mode: %v", ws.env)
+	}
+	if strings.Contains(env, "GOPRIVATE") {
+		t.Errorf("Empty settings mustn't be set: %v", ws.env)
+	}
+}
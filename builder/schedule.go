@@ -0,0 +1,78 @@
+package builder
+
+import (
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// QueuedTask describes a task in the waiting queue
+type QueuedTask struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Repo      string `json:"repo"`
+	Priority  int    `json:"priority"`
+	Position  int    `json:"position"` // Position is a number of the task in order of processing, starting from 1
+
+	// Blocked marks what the task waits until previous tasks of the same repo are processed,
+	// its position isn't known yet
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// pick returns index of the waiting task which has to be processed next:
+// the task with the highest priority, namespaces with the same priority are processed in turn
+// (the namespace which was served least recently goes first), tasks of the namespace are processed in order of adding.
+// served contains number of the last processed task of every namespace.
+func pick(waiting []task.CICD, served map[string]uint64) int {
+	best := -1
+	for i, t := range waiting {
+		if best < 0 {
+			best = i
+			continue
+		}
+
+		b := waiting[best]
+		if t.Priority != b.Priority {
+			if t.Priority > b.Priority {
+				best = i
+			}
+			continue
+		}
+
+		if served[t.Namespace] < served[b.Namespace] {
+			best = i
+		}
+	}
+	return best
+}
+
+// order returns indexes of waiting tasks in order of processing if no tasks are added meanwhile
+func order(waiting []task.CICD, served map[string]uint64) []int {
+	simulated := make(map[string]uint64, len(served))
+	var counter uint64
+	for namespace, number := range served {
+		simulated[namespace] = number
+		if number > counter {
+			counter = number
+		}
+	}
+
+	rest := make([]int, len(waiting))
+	tasks := make([]task.CICD, len(waiting))
+	for i := range waiting {
+		rest[i] = i
+		tasks[i] = waiting[i]
+	}
+
+	result := make([]int, 0, len(waiting))
+	for len(tasks) > 0 {
+		i := pick(tasks, simulated)
+		result = append(result, rest[i])
+
+		counter++
+		simulated[tasks[i].Namespace] = counter
+
+		tasks = append(tasks[:i], tasks[i+1:]...)
+		rest = append(rest[:i], rest[i+1:]...)
+	}
+
+	return result
+}
@@ -0,0 +1,48 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+func TestOrder(t *testing.T) {
+	newTask := func(id, namespace string, priority int) task.CICD {
+		t := task.NewCICD(nil, id, task.TypeTest, "github.com", id, "commit", "", namespace)
+		t.Priority = priority
+		return *t
+	}
+
+	waiting := []task.CICD{
+		newTask("a1", "a", task.PriorityDefault),
+		newTask("a2", "a", task.PriorityDefault),
+		newTask("a3", "a", task.PriorityDefault),
+		newTask("b1", "b", task.PriorityDefault),
+		newTask("c1", "c", task.PriorityDeploy),
+	}
+
+	tests := []struct {
+		served   map[string]uint64
+		expected []int
+	}{
+		{served: map[string]uint64{}, expected: []int{4, 0, 3, 1, 2}},
+		{served: map[string]uint64{"a": 2, "b": 1}, expected: []int{4, 3, 0, 1, 2}},
+		{served: map[string]uint64{"b": 5}, expected: []int{4, 0, 3, 1, 2}},
+	}
+
+	for _, test := range tests {
+		result := order(waiting, test.served)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Expected order %v for served %v, got %v", test.expected, test.served, result)
+		}
+
+		if pick(waiting, test.served) != test.expected[0] {
+			t.Errorf("Pick has to return the first task of the order %v", test.expected)
+		}
+	}
+
+	if pick(nil, nil) != -1 {
+		t.Errorf("Nothing could be picked from the empty queue")
+	}
+}
@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Mask is a replacement of values of secrets
+const Mask = "********"
+
+// Masker hides values of secrets in the text
+type Masker struct {
+	replacer *strings.Replacer
+}
+
+// NewMasker returns a Masker of values of the environment in form of "key=value",
+// values shorter than MinLength are not masked
+func NewMasker(env []string) *Masker {
+	var values []string
+	for _, item := range env {
+		i := strings.Index(item, "=")
+		if i < 0 || len(item)-i-1 < MinLength {
+			continue
+		}
+		values = append(values, item[i+1:])
+	}
+
+	// longer values go first, so values which contain others are masked entirely
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+
+	var pairs []string
+	for _, value := range values {
+		pairs = append(pairs, value, Mask)
+	}
+
+	return &Masker{replacer: strings.NewReplacer(pairs...)}
+}
+
+// Mask returns the text with masked values of secrets
+func (m *Masker) Mask(s string) string {
+	return m.replacer.Replace(s)
+}
+
+// Writer returns a writer which masks values of secrets in every write and passes the data to w.
+// Values which are split between writes are not masked, so data has to be written by lines.
+func (m *Masker) Writer(w io.Writer) io.Writer {
+	return &maskingWriter{masker: m, w: w}
+}
+
+type maskingWriter struct {
+	masker *Masker
+	w      io.Writer
+}
+
+func (mw *maskingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(mw.w, mw.masker.Mask(string(p)))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
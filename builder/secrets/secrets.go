@@ -0,0 +1,227 @@
+// Package secrets keeps secrets of namespaces and repositories encrypted at rest
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KeySize is a size of the encryption key, secrets are encrypted by AES-256-GCM
+const KeySize = 32
+
+// MinLength is a minimal length of values, shorter values couldn't be masked in logs without damage of them
+const MinLength = 4
+
+// ErrNotFound is returned if there is no secret with given name
+var ErrNotFound = errors.New("secret is not found")
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Store keeps secrets in the encrypted file, it is safe for concurrent use.
+// Secrets of the namespace are available for all its repositories, secrets of the repository override them.
+type Store struct {
+	path string
+	aead cipher.AEAD
+
+	mx     *sync.RWMutex
+	scopes map[string]map[string]string // values of secrets by scope and name
+}
+
+// NewStore opens the file of secrets encrypted by the key, the file is created by the first change
+func NewStore(path string, key []byte) (*Store, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key of secrets has to be %d bytes long, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path:   path,
+		aead:   aead,
+		mx:     &sync.RWMutex{},
+		scopes: make(map[string]map[string]string),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("couldn't decrypt secrets file %s: file is truncated", path)
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt secrets file %s: %s", path, err)
+	}
+
+	err = json.Unmarshal(plain, &s.scopes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse secrets file %s: %s", path, err)
+	}
+
+	return s, nil
+}
+
+// Validate checks what the secret could be saved
+func Validate(namespace, repo, name, value string) error {
+	if len(namespace) == 0 || strings.Contains(namespace, "/") || strings.Contains(repo, "/") {
+		return fmt.Errorf("wrong scope %s/%s", namespace, repo)
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("wrong name %q, it has to be a name of an environment variable", name)
+	}
+	if len(value) < MinLength {
+		return fmt.Errorf("value has to contain at least %d characters", MinLength)
+	}
+	return nil
+}
+
+// Set saves the secret of the namespace or of the repository if it isn't empty
+func (s *Store) Set(namespace, repo, name, value string) error {
+	err := Validate(namespace, repo, name, value)
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	key := scope(namespace, repo)
+	if s.scopes[key] == nil {
+		s.scopes[key] = make(map[string]string)
+	}
+	previous, existed := s.scopes[key][name]
+	s.scopes[key][name] = value
+
+	err = s.save()
+	if err != nil {
+		// the file wasn't changed, so the memory has to be the same
+		if existed {
+			s.scopes[key][name] = previous
+		} else {
+			delete(s.scopes[key], name)
+		}
+	}
+	return err
+}
+
+// Delete removes the secret of the namespace or of the repository if it isn't empty
+func (s *Store) Delete(namespace, repo, name string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	key := scope(namespace, repo)
+	value, ok := s.scopes[key][name]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(s.scopes[key], name)
+	err := s.save()
+	if err != nil {
+		s.scopes[key][name] = value
+	}
+	return err
+}
+
+// Names returns sorted names of secrets of the namespace or of the repository if it isn't empty
+func (s *Store) Names(namespace, repo string) []string {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	names := []string{}
+	for name := range s.scopes[scope(namespace, repo)] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Environment returns secrets available for the repository in form of "key=value"
+func (s *Store) Environment(namespace, repo string) []string {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	vars := make(map[string]string)
+	for name, value := range s.scopes[scope(namespace, "")] {
+		vars[name] = value
+	}
+	for name, value := range s.scopes[scope(namespace, repo)] {
+		vars[name] = value
+	}
+
+	var env []string
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+
+	return env
+}
+
+// save encrypts secrets and replaces the file, it has to be called under lock
+func (s *Store) save() error {
+	plain, err := json.Marshal(s.scopes)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+	data := s.aead.Seal(nonce, nonce, plain, nil)
+
+	file, err := ioutil.TempFile(filepath.Dir(s.path), ".secrets-")
+	if err != nil {
+		return fmt.Errorf("couldn't save secrets: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't save secrets: %s", err)
+	}
+
+	return os.Rename(file.Name(), s.path)
+}
+
+// scope returns key of secrets of the namespace or of the repository
+func scope(namespace, repo string) string {
+	namespace = strings.ToLower(namespace)
+	if len(repo) == 0 {
+		return namespace
+	}
+	return namespace + "/" + strings.ToLower(repo)
+}
@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets")
+	key := bytes.Repeat([]byte{1}, KeySize)
+
+	store, err := NewStore(path, key)
+	if err != nil {
+		t.Fatalf("Couldn't create store: %s", err)
+	}
+
+	for _, secret := range [][4]string{
+		{"k8s-community", "", "TOKEN", "namespace-token"},
+		{"k8s-community", "", "REGISTRY_PASSWORD", "registry-password"},
+		{"k8s-community", "cicd", "TOKEN", "repo-token"},
+	} {
+		err = store.Set(secret[0], secret[1], secret[2], secret[3])
+		if err != nil {
+			t.Fatalf("Couldn't save secret %v: %s", secret, err)
+		}
+	}
+
+	for _, secret := range [][4]string{
+		{"", "", "TOKEN", "value"},
+		{"k8s-community", "cicd/other", "TOKEN", "value"},
+		{"k8s-community", "", "1TOKEN", "value"},
+		{"k8s-community", "", "TOKEN=", "value"},
+		{"k8s-community", "", "TOKEN", "abc"},
+	} {
+		if err := store.Set(secret[0], secret[1], secret[2], secret[3]); err == nil {
+			t.Errorf("Secret %v mustn't be saved", secret)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Couldn't read secrets file: %s", err)
+	}
+	for _, value := range []string{"namespace-token", "registry-password", "TOKEN", "k8s-community"} {
+		if bytes.Contains(data, []byte(value)) {
+			t.Errorf("Secrets file contains plain text %q", value)
+		}
+	}
+
+	store, err = NewStore(path, key)
+	if err != nil {
+		t.Fatalf("Couldn't open store: %s", err)
+	}
+
+	expected := []string{"REGISTRY_PASSWORD=registry-password", "TOKEN=repo-token"}
+	if env := store.Environment("K8S-community", "cicd"); !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected environment %v, got %v", expected, env)
+	}
+	expected = []string{"REGISTRY_PASSWORD=registry-password", "TOKEN=namespace-token"}
+	if env := store.Environment("k8s-community", "other"); !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected environment %v, got %v", expected, env)
+	}
+	if env := store.Environment("other", "cicd"); len(env) != 0 {
+		t.Errorf("Expected empty environment, got %v", env)
+	}
+
+	if names := store.Names("k8s-community", ""); !reflect.DeepEqual(names, []string{"REGISTRY_PASSWORD", "TOKEN"}) {
+		t.Errorf("Unexpected names %v", names)
+	}
+
+	if err := store.Delete("k8s-community", "cicd", "TOKEN"); err != nil {
+		t.Errorf("Couldn't remove secret: %s", err)
+	}
+	if err := store.Delete("k8s-community", "cicd", "TOKEN"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if names := store.Names("k8s-community", "cicd"); len(names) != 0 {
+		t.Errorf("Expected no names, got %v", names)
+	}
+
+	if _, err := NewStore(path, bytes.Repeat([]byte{2}, KeySize)); err == nil {
+		t.Errorf("Secrets mustn't be decrypted by wrong key")
+	}
+	if _, err := NewStore(path, key[:16]); err == nil {
+		t.Errorf("Short key mustn't be accepted")
+	}
+}
+
+func TestMasker(t *testing.T) {
+	masker := NewMasker([]string{"TOKEN=secret", "LONG=secret-token", "SHORT=abc", "EMPTY="})
+
+	masked := masker.Mask("push with secret-token and secret, abc stays")
+	if masked != "push with "+Mask+" and "+Mask+", abc stays" {
+		t.Errorf("Unexpected masked text %q", masked)
+	}
+
+	buf := &bytes.Buffer{}
+	w := masker.Writer(buf)
+	n, err := w.Write([]byte("token is secret\n"))
+	if err != nil || n != 16 {
+		t.Errorf("Unexpected result of write: %d, %v", n, err)
+	}
+	if buf.String() != "token is "+Mask+"\n" {
+		t.Errorf("Unexpected masked log %q", buf.String())
+	}
+}
@@ -0,0 +1,286 @@
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/k8s-community/cicd/builder/process"
+)
+
+// Credential contains credentials of the git host
+type Credential struct {
+	Host string `json:"host"`
+
+	// Username and Token are used for HTTPS remotes, Username might be empty for hosts which ignore it
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+
+	// SSHKey is a path of the private key for SSH remotes,
+	// host keys are checked by KnownHosts file if it is set, new hosts are accepted otherwise
+	SSHKey     string `json:"sshKey,omitempty"`
+	KnownHosts string `json:"knownHosts,omitempty"`
+}
+
+// LoadCredentials reads the JSON file with the list of credentials
+func LoadCredentials(path string) ([]Credential, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []Credential
+	err = json.Unmarshal(data, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse credentials file %s: %s", path, err)
+	}
+
+	return credentials, nil
+}
+
+// GitConfig contains parameters of the Git provider
+type GitConfig struct {
+	Depth       int          // Depth of shallow clones, the whole history is fetched if zero
+	Submodules  bool         // Submodules are checked out recursively if true
+	MirrorDir   string       // MirrorDir keeps bare mirrors of remotes to fetch only new objects, mirrors aren't used if empty
+	Credentials []Credential // Credentials are chosen by host of the remote
+}
+
+// Git is a Provider which uses git command line tool (version 2.31 or newer)
+type Git struct {
+	config GitConfig
+
+	mx      *sync.Mutex
+	mirrors map[string]*sync.Mutex // mirrors are locked while they are updated
+}
+
+// NewGit returns an instance of Git provider
+func NewGit(config GitConfig) *Git {
+	return &Git{
+		config:  config,
+		mx:      &sync.Mutex{},
+		mirrors: make(map[string]*sync.Mutex),
+	}
+}
+
+// Fetch clones the repository into the directory.
+// If mirrors are used, the mirror is updated and the repository is cloned from it, Depth is ignored in this case.
+// If the commit isn't reachable from branches and tags (e.g. head of a pull request), it is fetched separately.
+func (g *Git) Fetch(ctx context.Context, repo Repository, dir string, log io.Writer) error {
+	err := validate(repo)
+	if err != nil {
+		return err
+	}
+
+	env := g.env(repo.URL)
+
+	if len(g.config.MirrorDir) > 0 {
+		return g.fetchFromMirror(ctx, repo, env, dir, log)
+	}
+
+	if g.config.Depth > 0 {
+		err = run(ctx, log, env, "", "git", "init", "-q", dir)
+		if err != nil {
+			return err
+		}
+		err = run(ctx, log, env, dir, "git", "remote", "add", "origin", "--", repo.URL)
+		if err != nil {
+			return err
+		}
+		return run(ctx, log, env, dir, "git", "fetch", "--depth", strconv.Itoa(g.config.Depth), "origin", repo.Commit)
+	}
+
+	err = run(ctx, log, env, "", "git", "clone", "--no-checkout", "--", repo.URL, dir)
+	if err != nil {
+		return err
+	}
+	if hasCommit(ctx, env, dir, repo.Commit) {
+		return nil
+	}
+	return run(ctx, log, env, dir, "git", "fetch", "origin", repo.Commit)
+}
+
+// Checkout switches the repository to the commit and updates submodules if they are enabled
+func (g *Git) Checkout(ctx context.Context, repo Repository, dir string, log io.Writer) error {
+	err := validate(repo)
+	if err != nil {
+		return err
+	}
+
+	env := g.env(repo.URL)
+
+	err = run(ctx, log, env, dir, "git", "checkout", "-q", "--force", repo.Commit)
+	if err != nil {
+		return err
+	}
+
+	if !g.config.Submodules {
+		return nil
+	}
+
+	args := []string{"submodule", "update", "--init", "--recursive"}
+	if g.config.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(g.config.Depth))
+	}
+	return run(ctx, log, env, dir, "git", args...)
+}
+
+// fetchFromMirror creates or updates the bare mirror of the remote and clones the repository from it.
+// The mirror is locked until the clone is done, so concurrent updates couldn't prune the commit.
+func (g *Git) fetchFromMirror(ctx context.Context, repo Repository, env []string, dir string, log io.Writer) error {
+	sum := sha256.Sum256([]byte(repo.URL))
+	mirror := filepath.Join(g.config.MirrorDir, hex.EncodeToString(sum[:8])+".git")
+
+	lock := g.mirrorLock(mirror)
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, err := os.Stat(mirror)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(g.config.MirrorDir, 0755)
+		if err != nil {
+			return err
+		}
+
+		err = run(ctx, log, env, "", "git", "clone", "--mirror", "--", repo.URL, mirror)
+		if err != nil {
+			os.RemoveAll(mirror)
+			return err
+		}
+	} else {
+		err = run(ctx, log, env, mirror, "git", "remote", "set-url", "origin", "--", repo.URL)
+		if err == nil {
+			err = run(ctx, log, env, mirror, "git", "fetch", "--prune", "origin")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !hasCommit(ctx, env, mirror, repo.Commit) {
+		err = run(ctx, log, env, mirror, "git", "fetch", "origin", repo.Commit)
+		if err != nil {
+			return err
+		}
+		// the commit isn't referenced by the mirror, the ref keeps it for the clone and is pruned by the next update
+		err = run(ctx, log, env, mirror, "git", "update-ref", "refs/cicd/"+repo.Commit, repo.Commit)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = run(ctx, log, env, "", "git", "clone", "--no-checkout", mirror, dir)
+	if err != nil {
+		return err
+	}
+	return run(ctx, log, env, dir, "git", "remote", "set-url", "origin", "--", repo.URL)
+}
+
+func (g *Git) mirrorLock(mirror string) *sync.Mutex {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	lock, ok := g.mirrors[mirror]
+	if !ok {
+		lock = &sync.Mutex{}
+		g.mirrors[mirror] = lock
+	}
+	return lock
+}
+
+// env returns environment of git commands with credentials of the remote host.
+// Credentials are passed through environment, so they don't appear in command lines and logs.
+func (g *Git) env(remote string) []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+
+	host := Host(remote)
+	for _, credential := range g.config.Credentials {
+		if len(host) == 0 || credential.Host != host {
+			continue
+		}
+
+		if IsSSH(remote) && len(credential.SSHKey) > 0 {
+			command := "ssh -i " + shellQuote(credential.SSHKey) + " -o IdentitiesOnly=yes -o BatchMode=yes"
+			if len(credential.KnownHosts) > 0 {
+				command += " -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + shellQuote(credential.KnownHosts)
+			} else {
+				command += " -o StrictHostKeyChecking=accept-new"
+			}
+			env = append(env, "GIT_SSH_COMMAND="+command)
+		}
+
+		if !IsSSH(remote) && len(credential.Token) > 0 {
+			auth := base64.StdEncoding.EncodeToString([]byte(credential.Username + ":" + credential.Token))
+			// the header is scoped by the host, so it isn't sent to other hosts, e.g. of submodules
+			env = append(env,
+				"GIT_CONFIG_COUNT=1",
+				"GIT_CONFIG_KEY_0=http.https://"+host+"/.extraHeader",
+				"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+			)
+		}
+		break
+	}
+
+	return env
+}
+
+// validate checks what the repository couldn't be confused with options of git or remote helpers
+func validate(repo Repository) error {
+	if len(repo.URL) == 0 || strings.HasPrefix(repo.URL, "-") || strings.Contains(repo.URL, "::") {
+		return fmt.Errorf("wrong repository URL %q", repo.URL)
+	}
+
+	if len(repo.Commit) < 4 || len(repo.Commit) > 64 {
+		return fmt.Errorf("wrong commit %q", repo.Commit)
+	}
+	for _, c := range repo.Commit {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return fmt.Errorf("wrong commit %q", repo.Commit)
+		}
+	}
+
+	return nil
+}
+
+// hasCommit returns true if the repository contains the commit
+func hasCommit(ctx context.Context, env []string, dir, commit string) bool {
+	return run(ctx, nil, env, dir, "git", "cat-file", "-e", commit+"^{commit}") == nil
+}
+
+// run executes the command, its output is written to the log
+func run(ctx context.Context, log io.Writer, env []string, dir, name string, args ...string) error {
+	command := exec.Command(name, args...)
+	command.Env = append(os.Environ(), env...)
+	command.Dir = dir
+
+	if log != nil {
+		fmt.Fprintf(log, "$ %s %s\n", name, strings.Join(args, " "))
+		command.Stdout = log
+		command.Stderr = log
+	}
+
+	// children of git, e.g. ssh and credential helpers, are killed along with it
+	err := process.Run(ctx, command)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %s", name, args[0], err)
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
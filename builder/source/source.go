@@ -0,0 +1,50 @@
+// Package source fetches sources of repositories to be built
+package source
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Repository defines which sources have to be fetched
+type Repository struct {
+	URL    string // URL of the remote, e.g. https://gitlab.com/group/repo.git or git@gitlab.com:group/repo.git
+	Commit string // Commit is an exact SHA to check out
+}
+
+// Provider fetches sources of repositories, output of the commands is written to the log
+type Provider interface {
+	// Fetch puts the repository into the directory and makes sure what the commit is available
+	Fetch(ctx context.Context, repo Repository, dir string, log io.Writer) error
+
+	// Checkout switches the fetched repository in the directory to the commit
+	Checkout(ctx context.Context, repo Repository, dir string, log io.Writer) error
+}
+
+// Host returns host of the remote URL, both URLs with scheme and scp-like SSH addresses are supported
+func Host(remote string) string {
+	if !strings.Contains(remote, "://") {
+		// scp-like address: [user@]host:path
+		if i := strings.Index(remote, ":"); i > 0 {
+			host := remote[:i]
+			return host[strings.LastIndex(host, "@")+1:]
+		}
+		return ""
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// IsSSH returns true if the remote URL uses SSH
+func IsSSH(remote string) bool {
+	if strings.HasPrefix(remote, "ssh://") || strings.HasPrefix(remote, "git+ssh://") {
+		return true
+	}
+	return !strings.Contains(remote, "://") && len(Host(remote)) > 0
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/k8s-community/cicd"
+)
+
+// Retention defines how long artifacts or records of builds are kept, zero values mean no limit
+type Retention struct {
+	MaxAge    time.Duration // MaxAge removes data of builds which are older
+	MaxBuilds int           // MaxBuilds keeps data of only the latest builds
+}
+
+// Artifacts keeps artifacts of builds in subdirectories of the directory
+type Artifacts struct {
+	dir       string
+	retention Retention
+}
+
+// NewArtifacts returns an instance of Artifacts, the directory is created if it doesn't exist
+func NewArtifacts(dir string, retention Retention) (*Artifacts, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create directory for artifacts: %s", err)
+	}
+
+	return &Artifacts{dir: dir, retention: retention}, nil
+}
+
+// Put saves the artifact of the build and returns its description with size and checksum,
+// name is a slash-separated path relative to the root of the repository
+func (a *Artifacts) Put(id, stage, name string, r io.Reader) (cicd.Artifact, error) {
+	artifact := cicd.Artifact{Name: name, Stage: stage}
+
+	filePath, err := a.path(id, name)
+	if err != nil {
+		return artifact, fmt.Errorf("wrong name of artifact %q", name)
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return artifact, err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(filePath), ".artifact-")
+	if err != nil {
+		return artifact, err
+	}
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+	artifact.Size, err = io.Copy(io.MultiWriter(file, hash), r)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
+	if err != nil {
+		return artifact, err
+	}
+
+	err = os.Rename(file.Name(), filePath)
+	if err != nil {
+		return artifact, err
+	}
+
+	artifact.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return artifact, nil
+}
+
+// Open returns the file of the artifact or ErrNotFound if the artifact doesn't exist or was removed
+func (a *Artifacts) Open(id, name string) (*os.File, error) {
+	filePath, err := a.path(id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) || (err == nil && !info.Mode().IsRegular()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(filePath)
+}
+
+// Exists returns true if the artifact is still kept
+func (a *Artifacts) Exists(id, name string) bool {
+	filePath, err := a.path(id, name)
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(filePath)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Expire removes artifacts of builds according to the retention rules and returns IDs of these builds
+func (a *Artifacts) Expire(now time.Time) ([]string, error) {
+	entries, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var builds []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			builds = append(builds, entry)
+		}
+	}
+
+	// the latest builds go first
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].ModTime().After(builds[j].ModTime())
+	})
+
+	var removed []string
+	for i, build := range builds {
+		expired := a.retention.MaxAge > 0 && now.Sub(build.ModTime()) > a.retention.MaxAge
+		if a.retention.MaxBuilds > 0 && i >= a.retention.MaxBuilds {
+			expired = true
+		}
+		if !expired {
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(a.dir, build.Name()))
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, build.Name())
+	}
+
+	return removed, nil
+}
+
+// path returns path of the artifact, names which lead out of the directory of the build are rejected
+func (a *Artifacts) path(id, name string) (string, error) {
+	if len(id) == 0 || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", ErrNotFound
+	}
+
+	clean := path.Clean("/" + name)
+	if len(name) == 0 || clean == "/" || strings.Contains(name, `\`) || clean != "/"+name {
+		return "", ErrNotFound
+	}
+
+	return filepath.Join(a.dir, id, filepath.FromSlash(clean[1:])), nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	artifacts, err := NewArtifacts(dir, Retention{})
+	if err != nil {
+		t.Fatalf("Couldn't create artifacts directory: %s", err)
+	}
+
+	artifact, err := artifacts.Put("1", "build", "bin/linux-amd64/app", strings.NewReader("binary"))
+	if err != nil {
+		t.Fatalf("Couldn't save artifact: %s", err)
+	}
+	// sha256 of "binary"
+	if artifact.Size != 6 || artifact.SHA256 != "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd" {
+		t.Errorf("Unexpected artifact: %+v", artifact)
+	}
+
+	file, err := artifacts.Open("1", "bin/linux-amd64/app")
+	if err != nil {
+		t.Fatalf("Couldn't open artifact: %s", err)
+	}
+	data, _ := ioutil.ReadAll(file)
+	file.Close()
+	if string(data) != "binary" {
+		t.Errorf("Unexpected content of artifact: %q", data)
+	}
+
+	for _, name := range []string{"", "bin", "../1/bin/linux-amd64/app", "bin/../bin/linux-amd64/app", "/bin/linux-amd64/app"} {
+		if _, err := artifacts.Open("1", name); err != ErrNotFound {
+			t.Errorf("Artifact %q: expected ErrNotFound, got %v", name, err)
+		}
+		if _, err := artifacts.Put("2", "build", name, strings.NewReader("")); err == nil && name != "bin" {
+			t.Errorf("Artifact %q mustn't be saved", name)
+		}
+	}
+	if _, err := artifacts.Open("..", "etc/passwd"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for wrong build ID, got %v", err)
+	}
+}
+
+func TestArtifactsExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	artifacts, err := NewArtifacts(dir, Retention{MaxAge: time.Hour, MaxBuilds: 2})
+	if err != nil {
+		t.Fatalf("Couldn't create artifacts directory: %s", err)
+	}
+
+	now := time.Now()
+	ages := map[string]time.Duration{"old": 2 * time.Hour, "first": 30 * time.Minute, "second": 20 * time.Minute, "third": 10 * time.Minute}
+	for id, age := range ages {
+		_, err = artifacts.Put(id, "build", "app", strings.NewReader(id))
+		if err != nil {
+			t.Fatalf("Couldn't save artifact: %s", err)
+		}
+		os.Chtimes(filepath.Join(dir, id), now.Add(-age), now.Add(-age))
+	}
+
+	removed, err := artifacts.Expire(now)
+	if err != nil {
+		t.Fatalf("Couldn't expire artifacts: %s", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Expected 2 removed builds, got %v", removed)
+	}
+
+	for id, kept := range map[string]bool{"old": false, "first": false, "second": true, "third": true} {
+		if artifacts.Exists(id, "app") != kept {
+			t.Errorf("Build %s: expected kept %v", id, kept)
+		}
+	}
+}
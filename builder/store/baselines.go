@@ -0,0 +1,101 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/k8s-community/cicd"
+)
+
+// Baselines keeps coverage of the last successful builds of branches of repositories,
+// builds of other branches are compared with them. The whole file is rewritten on every change.
+type Baselines struct {
+	mx    *sync.Mutex
+	path  string // path of the JSON file, baselines live in memory if empty
+	bases map[string]cicd.CoverageBase
+}
+
+// NewBaselines opens the file of baselines or creates it if it doesn't exist, baselines live in memory if path is empty
+func NewBaselines(path string) (*Baselines, error) {
+	b := &Baselines{
+		mx:    &sync.Mutex{},
+		path:  path,
+		bases: make(map[string]cicd.CoverageBase),
+	}
+	if len(path) == 0 {
+		return b, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create directory for baselines file: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read baselines file: %s", err)
+	}
+
+	err = json.Unmarshal(data, &b.bases)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse baselines file %s: %s", path, err)
+	}
+
+	return b, nil
+}
+
+// Baseline returns coverage of the last successful build of the branch of the repository
+func (b *Baselines) Baseline(namespace, repo, branch string) (cicd.CoverageBase, bool) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	base, ok := b.bases[baselineKey(namespace, repo, branch)]
+	return base, ok
+}
+
+// SetBaseline saves coverage of the successful build of the branch of the repository
+func (b *Baselines) SetBaseline(namespace, repo string, base cicd.CoverageBase) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.bases[baselineKey(namespace, repo, base.Branch)] = base
+	if len(b.path) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(b.bases)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write baselines file: %s", err)
+	}
+
+	return os.Rename(tmp.Name(), b.path)
+}
+
+func baselineKey(namespace, repo, branch string) string {
+	return strings.ToLower(namespace) + "/" + strings.ToLower(repo) + "@" + branch
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k8s-community/cicd"
+)
+
+func TestBaselines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-baselines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "coverage", "baselines.json")
+	baselines, err := NewBaselines(path)
+	if err != nil {
+		t.Fatalf("Couldn't open baselines: %s", err)
+	}
+
+	if _, ok := baselines.Baseline("k8s-community", "cicd", "master"); ok {
+		t.Errorf("Unexpected baseline in the empty store")
+	}
+
+	base := cicd.CoverageBase{Branch: "master", RequestID: "1", Total: 75.5}
+	err = baselines.SetBaseline("k8s-community", "cicd", base)
+	if err != nil {
+		t.Fatalf("Couldn't save baseline: %s", err)
+	}
+
+	baselines, err = NewBaselines(path)
+	if err != nil {
+		t.Fatalf("Couldn't reopen baselines: %s", err)
+	}
+	if saved, ok := baselines.Baseline("K8s-Community", "CICD", "master"); !ok || saved != base {
+		t.Errorf("Expected baseline %+v, got %+v", base, saved)
+	}
+	if _, ok := baselines.Baseline("k8s-community", "cicd", "develop"); ok {
+		t.Errorf("Unexpected baseline of other branch")
+	}
+
+	memory, _ := NewBaselines("")
+	memory.SetBaseline("k8s-community", "cicd", base)
+	if _, ok := memory.Baseline("k8s-community", "cicd", "master"); !ok {
+		t.Errorf("Baseline isn't kept in memory")
+	}
+}
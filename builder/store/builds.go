@@ -0,0 +1,273 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/k8s-community/cicd"
+)
+
+// ErrNotFound is returned if there is no record with given ID
+var ErrNotFound = errors.New("record is not found")
+
+// Builds is a storage of build records
+type Builds interface {
+	// Create saves a new record
+	Create(record cicd.BuildRecord) error
+
+	// Update changes the record with given ID by the update function
+	Update(id string, update func(record *cicd.BuildRecord)) error
+
+	// Get returns the record with given ID or ErrNotFound
+	Get(id string) (*cicd.BuildRecord, error)
+
+	// Expire removes records of finished builds according to the retention rules and returns IDs of these builds
+	Expire(now time.Time) ([]string, error)
+}
+
+// MemoryBuilds is a Builds storage which keeps records in memory only
+type MemoryBuilds struct {
+	mx        *sync.RWMutex
+	records   map[string]cicd.BuildRecord
+	retention Retention
+}
+
+// NewMemoryBuilds returns an instance of MemoryBuilds, records of finished builds are kept according to the retention
+func NewMemoryBuilds(retention Retention) *MemoryBuilds {
+	return &MemoryBuilds{
+		mx:        &sync.RWMutex{},
+		records:   make(map[string]cicd.BuildRecord),
+		retention: retention,
+	}
+}
+
+// Create saves a new record
+func (m *MemoryBuilds) Create(record cicd.BuildRecord) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.records[record.RequestID] = record
+	return nil
+}
+
+// Update changes the record with given ID by the update function
+func (m *MemoryBuilds) Update(id string, update func(record *cicd.BuildRecord)) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	record, ok := m.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	update(&record)
+	m.records[id] = record
+	return nil
+}
+
+// Get returns the record with given ID or ErrNotFound
+func (m *MemoryBuilds) Get(id string) (*cicd.BuildRecord, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	record, ok := m.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &record, nil
+}
+
+// Expire removes records of finished builds according to the retention rules and returns IDs of these builds
+func (m *MemoryBuilds) Expire(now time.Time) ([]string, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	records := make([]cicd.BuildRecord, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+
+	removed := expiredBuilds(records, m.retention, now)
+	for _, id := range removed {
+		delete(m.records, id)
+	}
+
+	return removed, nil
+}
+
+// expiredBuilds returns IDs of finished builds which exceed the retention, running builds are never expired
+func expiredBuilds(records []cicd.BuildRecord, retention Retention, now time.Time) []string {
+	var finished []cicd.BuildRecord
+	for _, record := range records {
+		if record.FinishedAt != nil {
+			finished = append(finished, record)
+		}
+	}
+
+	// the latest builds go first
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.After(*finished[j].FinishedAt)
+	})
+
+	var expired []string
+	for i, record := range finished {
+		if retention.MaxAge > 0 && now.Sub(*record.FinishedAt) > retention.MaxAge ||
+			retention.MaxBuilds > 0 && i >= retention.MaxBuilds {
+			expired = append(expired, record.RequestID)
+		}
+	}
+
+	return expired
+}
+
+// DirBuilds is a Builds storage which keeps every record in its own JSON file in the directory
+type DirBuilds struct {
+	mx        *sync.Mutex
+	dir       string
+	retention Retention
+}
+
+// NewDirBuilds returns an instance of DirBuilds, the directory is created if it doesn't exist.
+// Records of finished builds are kept according to the retention.
+func NewDirBuilds(dir string, retention Retention) (*DirBuilds, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create directory for build records: %s", err)
+	}
+
+	return &DirBuilds{
+		mx:        &sync.Mutex{},
+		dir:       dir,
+		retention: retention,
+	}, nil
+}
+
+// Create saves a new record
+func (d *DirBuilds) Create(record cicd.BuildRecord) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return d.write(record)
+}
+
+// Update changes the record with given ID by the update function
+func (d *DirBuilds) Update(id string, update func(record *cicd.BuildRecord)) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	record, err := d.read(id)
+	if err != nil {
+		return err
+	}
+
+	update(record)
+	return d.write(*record)
+}
+
+// Get returns the record with given ID or ErrNotFound
+func (d *DirBuilds) Get(id string) (*cicd.BuildRecord, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	return d.read(id)
+}
+
+// Expire removes records of finished builds according to the retention rules and returns IDs of these builds
+func (d *DirBuilds) Expire(now time.Time) ([]string, error) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	entries, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []cicd.BuildRecord
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		record, err := d.read(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			// broken records are kept for investigation
+			continue
+		}
+		records = append(records, *record)
+	}
+
+	var removed []string
+	for _, id := range expiredBuilds(records, d.retention, now) {
+		path, err := d.path(id)
+		if err != nil {
+			return removed, err
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+
+	return removed, nil
+}
+
+func (d *DirBuilds) read(id string) (*cicd.BuildRecord, error) {
+	path, err := d.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := new(cicd.BuildRecord)
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse build record %s: %s", id, err)
+	}
+
+	return record, nil
+}
+
+func (d *DirBuilds) write(record cicd.BuildRecord) error {
+	path, err := d.path(record.RequestID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// path returns path of the record file, ID mustn't point outside the directory
+func (d *DirBuilds) path(id string) (string, error) {
+	if len(id) == 0 || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", ErrNotFound
+	}
+
+	return filepath.Join(d.dir, id+".json"), nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/k8s-community/cicd"
+)
+
+func TestBuilds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-builds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dirBuilds, err := NewDirBuilds(dir, Retention{})
+	if err != nil {
+		t.Fatalf("Couldn't create builds directory: %s", err)
+	}
+
+	for _, builds := range []Builds{NewMemoryBuilds(Retention{}), dirBuilds} {
+		err = builds.Create(cicd.BuildRecord{RequestID: "1", Repository: "cicd", State: "pending", QueuedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("Couldn't create record: %s", err)
+		}
+
+		err = builds.Update("1", func(record *cicd.BuildRecord) {
+			record.State = "success"
+		})
+		if err != nil {
+			t.Fatalf("Couldn't update record: %s", err)
+		}
+
+		record, err := builds.Get("1")
+		if err != nil {
+			t.Fatalf("Couldn't get record: %s", err)
+		}
+		if record.Repository != "cicd" || record.State != "success" {
+			t.Errorf("Unexpected record: %+v", record)
+		}
+
+		for _, id := range []string{"2", "../1", ".", ""} {
+			if _, err = builds.Get(id); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for %q, got %v", id, err)
+			}
+		}
+
+		if err = builds.Update("2", func(record *cicd.BuildRecord) {}); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound on update, got %v", err)
+		}
+	}
+}
+
+func TestBuildsExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-builds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	retention := Retention{MaxAge: 24 * time.Hour, MaxBuilds: 2}
+	dirBuilds, err := NewDirBuilds(dir, retention)
+	if err != nil {
+		t.Fatalf("Couldn't create builds directory: %s", err)
+	}
+
+	now := time.Now()
+	finished := func(age time.Duration) *time.Time {
+		finishedAt := now.Add(-age)
+		return &finishedAt
+	}
+
+	for _, builds := range []Builds{NewMemoryBuilds(retention), dirBuilds} {
+		for _, record := range []cicd.BuildRecord{
+			{RequestID: "running", QueuedAt: now.Add(-48 * time.Hour)},
+			{RequestID: "latest", FinishedAt: finished(time.Minute)},
+			{RequestID: "recent", FinishedAt: finished(time.Hour)},
+			{RequestID: "third", FinishedAt: finished(2 * time.Hour)},
+			{RequestID: "old", FinishedAt: finished(48 * time.Hour)},
+		} {
+			builds.Create(record)
+		}
+
+		removed, err := builds.Expire(now)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(removed) != 2 || removed[0] != "third" || removed[1] != "old" {
+			t.Errorf("Unexpected expired builds %v", removed)
+		}
+
+		for id, kept := range map[string]bool{"running": true, "latest": true, "recent": true, "third": false, "old": false} {
+			if _, err := builds.Get(id); (err == nil) != kept {
+				t.Errorf("Build %s: expected to be kept %v, got error %v", id, kept, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logs keeps logs of builds in files of the directory and lets to follow logs of running builds
+type Logs struct {
+	dir string
+
+	mx      *sync.Mutex
+	running map[string]*Log // logs which are still written
+}
+
+// NewLogs returns an instance of Logs, the directory is created if it doesn't exist
+func NewLogs(dir string) (*Logs, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create directory for logs: %s", err)
+	}
+
+	return &Logs{
+		dir:     dir,
+		mx:      &sync.Mutex{},
+		running: make(map[string]*Log),
+	}, nil
+}
+
+// Create opens the log of the build for writing, new data is appended to the existing log
+func (l *Logs) Create(id string) (*Log, error) {
+	path, err := l.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if log, ok := l.running[id]; ok {
+		return log, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	log := &Log{
+		id:      id,
+		logs:    l,
+		mx:      &sync.Mutex{},
+		file:    file,
+		updated: make(chan struct{}),
+	}
+	l.running[id] = log
+
+	return log, nil
+}
+
+// Finish closes the log of the build if it is still open
+func (l *Logs) Finish(id string) error {
+	l.mx.Lock()
+	log, ok := l.running[id]
+	l.mx.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return log.Close()
+}
+
+// Open returns reader of the log of the build.
+// If follow is true and the build is still running, reading waits for new data until the log is closed
+// or the context is done.
+func (l *Logs) Open(ctx context.Context, id string, follow bool) (io.ReadCloser, error) {
+	path, err := l.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mx.Lock()
+	log := l.running[id]
+	l.mx.Unlock()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !follow || log == nil {
+		return file, nil
+	}
+
+	return &follower{ctx: ctx, file: file, log: log}, nil
+}
+
+// Remove removes the log of the finished build, logs of running builds are kept
+func (l *Logs) Remove(id string) error {
+	path, err := l.path(id)
+	if err != nil {
+		return err
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if _, ok := l.running[id]; ok {
+		return nil
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Expire removes logs of finished builds which weren't written for maxAge and returns IDs of these builds,
+// it removes logs whose records are lost, e.g. records kept in memory before restart
+func (l *Logs) Expire(now time.Time, maxAge time.Duration) ([]string, error) {
+	if maxAge <= 0 {
+		return nil, nil
+	}
+
+	entries, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || !strings.HasSuffix(entry.Name(), ".log") || now.Sub(entry.ModTime()) <= maxAge {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ".log")
+		l.mx.Lock()
+		_, running := l.running[id]
+		l.mx.Unlock()
+		if running {
+			continue
+		}
+
+		err = l.Remove(id)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+
+	return removed, nil
+}
+
+// path returns path of the log file, ID mustn't point outside the directory
+func (l *Logs) path(id string) (string, error) {
+	if len(id) == 0 || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", ErrNotFound
+	}
+
+	return filepath.Join(l.dir, id+".log"), nil
+}
+
+// Log is a log of the running build, it is safe for concurrent use
+type Log struct {
+	id   string
+	logs *Logs
+
+	mx      *sync.Mutex
+	file    *os.File
+	updated chan struct{} // updated is closed and replaced on every write to wake followers up
+	closed  bool
+}
+
+// Write appends data to the log
+func (l *Log) Write(p []byte) (int, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.closed {
+		return 0, os.ErrClosed
+	}
+
+	n, err := l.file.Write(p)
+	close(l.updated)
+	l.updated = make(chan struct{})
+
+	return n, err
+}
+
+// Close marks what the build is finished and nothing will be written to the log
+func (l *Log) Close() error {
+	l.logs.mx.Lock()
+	delete(l.logs.running, l.id)
+	l.logs.mx.Unlock()
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	l.closed = true
+	close(l.updated)
+
+	return l.file.Close()
+}
+
+// state returns channel which will be closed on the next write and the flag of closed log
+func (l *Log) state() (<-chan struct{}, bool) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	return l.updated, l.closed
+}
+
+// follower reads the log of the running build and waits for new data when it reaches the end
+type follower struct {
+	ctx  context.Context
+	file *os.File
+	log  *Log
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	for {
+		// state has to be taken before reading, otherwise a write between reading and waiting could be missed
+		updated, closed := f.log.state()
+
+		n, err := f.file.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+
+		if closed {
+			return 0, io.EOF
+		}
+
+		select {
+		case <-updated:
+		case <-f.ctx.Done():
+			return 0, f.ctx.Err()
+		}
+	}
+}
+
+func (f *follower) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogsFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs, err := NewLogs(dir)
+	if err != nil {
+		t.Fatalf("Couldn't create logs directory: %s", err)
+	}
+
+	log, err := logs.Create("1")
+	if err != nil {
+		t.Fatalf("Couldn't create log: %s", err)
+	}
+	log.Write([]byte("first\n"))
+
+	reader, err := logs.Open(context.Background(), "1", true)
+	if err != nil {
+		t.Fatalf("Couldn't open log: %s", err)
+	}
+	defer reader.Close()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		log.Write([]byte("second\n"))
+		logs.Finish("1")
+	}()
+
+	// reading finishes only when the log is closed
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Couldn't read log: %s", err)
+	}
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("Unexpected log: %q", data)
+	}
+
+	// finished log is read as is
+	reader, err = logs.Open(context.Background(), "1", true)
+	if err != nil {
+		t.Fatalf("Couldn't open finished log: %s", err)
+	}
+	data, _ = ioutil.ReadAll(reader)
+	reader.Close()
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("Unexpected finished log: %q", data)
+	}
+
+	if _, err = logs.Open(context.Background(), "2", true); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLogsFollowCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs, _ := NewLogs(dir)
+	logs.Create("1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	reader, err := logs.Open(ctx, "1", true)
+	if err != nil {
+		t.Fatalf("Couldn't open log: %s", err)
+	}
+	defer reader.Close()
+
+	_, err = ioutil.ReadAll(reader)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected reading to be stopped by context, got %v", err)
+	}
+}
+
+func TestLogsRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logs, err := NewLogs(dir)
+	if err != nil {
+		t.Fatalf("Couldn't create logs directory: %s", err)
+	}
+
+	for _, id := range []string{"finished", "old", "running"} {
+		log, err := logs.Create(id)
+		if err != nil {
+			t.Fatalf("Couldn't create log: %s", err)
+		}
+		log.Write([]byte(id + "\n"))
+	}
+	logs.Finish("finished")
+	logs.Finish("old")
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "old.log"), old, old)
+	os.Chtimes(filepath.Join(dir, "running.log"), old, old)
+
+	if err = logs.Remove("finished"); err != nil {
+		t.Errorf("Couldn't remove log: %s", err)
+	}
+	if err = logs.Remove("finished"); err != nil {
+		t.Errorf("Removed log has to be ignored, got %s", err)
+	}
+
+	removed, err := logs.Expire(time.Now(), 24*time.Hour)
+	if err != nil || len(removed) != 1 || removed[0] != "old" {
+		t.Errorf("Unexpected expired logs %v, %v", removed, err)
+	}
+
+	for id, kept := range map[string]bool{"finished": false, "old": false, "running": true} {
+		reader, err := logs.Open(context.Background(), id, false)
+		if (err == nil) != kept {
+			t.Errorf("Log %s: expected to be kept %v, got error %v", id, kept, err)
+		}
+		if err == nil {
+			reader.Close()
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+const (
+	// QueueWaiting marks what task is waiting for a free worker
+	QueueWaiting = "waiting"
+
+	// QueueInProgress marks what task was sent to a worker
+	QueueInProgress = "inProgress"
+
+	// QueueMatrix marks what task is a matrix build which waits until its cells are built
+	QueueMatrix = "matrix"
+)
+
+// Record represents a task saved in the queue store
+type Record struct {
+	Task  task.CICD `json:"task"`
+	Queue string    `json:"queue"`
+	Added time.Time `json:"added"`
+	Seq   uint64    `json:"seq"` // Seq keeps order of tasks added at the same time
+}
+
+// Queue is a storage of tasks which allows the dispatcher to survive restarts
+type Queue interface {
+	// Put adds the task to the store or moves it to the given queue
+	Put(t task.CICD, queue string) error
+
+	// Remove deletes the task from the store
+	Remove(id string) error
+
+	// List returns all stored tasks in order of adding
+	List() ([]Record, error)
+}
+
+// File is a Queue which keeps tasks in a single JSON file.
+// The whole file is rewritten atomically on every change, so it is suitable for queues of moderate size.
+type File struct {
+	mx      *sync.Mutex
+	path    string
+	seq     uint64
+	records map[string]Record
+}
+
+// NewFile opens the queue file or creates it if it doesn't exist
+func NewFile(path string) (*File, error) {
+	f := &File{
+		mx:      &sync.Mutex{},
+		path:    path,
+		records: make(map[string]Record),
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create directory for queue file: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, f.flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read queue file: %s", err)
+	}
+
+	var records []Record
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &records)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse queue file %s: %s", path, err)
+		}
+	}
+
+	for _, record := range records {
+		f.records[record.Task.ID] = record
+		if record.Seq > f.seq {
+			f.seq = record.Seq
+		}
+	}
+
+	return f, nil
+}
+
+// Put adds the task to the store or moves it to the given queue
+func (f *File) Put(t task.CICD, queue string) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	record, ok := f.records[t.ID]
+	if !ok {
+		f.seq++
+		record = Record{Added: time.Now(), Seq: f.seq}
+	}
+	record.Task = t
+	record.Queue = queue
+	f.records[t.ID] = record
+
+	return f.flush()
+}
+
+// Remove deletes the task from the store
+func (f *File) Remove(id string) error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if _, ok := f.records[id]; !ok {
+		return nil
+	}
+	delete(f.records, id)
+
+	return f.flush()
+}
+
+// List returns all stored tasks in order of adding
+func (f *File) List() ([]Record, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	return f.list(), nil
+}
+
+func (f *File) list() []Record {
+	records := make([]Record, 0, len(f.records))
+	for _, record := range f.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Seq < records[j].Seq })
+
+	return records
+}
+
+// flush writes records to a temporary file and replaces the queue file by it
+func (f *File) flush() error {
+	data, err := json.Marshal(f.list())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.path), filepath.Base(f.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write queue file: %s", err)
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
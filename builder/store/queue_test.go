@@ -0,0 +1,64 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+func TestFileQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "queue.json")
+	queue, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("Couldn't create queue file: %s", err)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		err = queue.Put(*task.NewCICD(nil, id, "test", "github.com", "cicd", "master", "", "test"), QueueWaiting)
+		if err != nil {
+			t.Fatalf("Couldn't put task %s: %s", id, err)
+		}
+	}
+
+	err = queue.Put(*task.NewCICD(nil, "1", "test", "github.com", "cicd", "master", "", "test"), QueueInProgress)
+	if err != nil {
+		t.Fatalf("Couldn't move task: %s", err)
+	}
+
+	err = queue.Remove("2")
+	if err != nil {
+		t.Fatalf("Couldn't remove task: %s", err)
+	}
+
+	// reopen the file as it happens after restart
+	queue, err = NewFile(path)
+	if err != nil {
+		t.Fatalf("Couldn't reopen queue file: %s", err)
+	}
+
+	records, err := queue.List()
+	if err != nil {
+		t.Fatalf("Couldn't list tasks: %s", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 tasks, got %d", len(records))
+	}
+
+	if records[0].Task.ID != "1" || records[0].Queue != QueueInProgress {
+		t.Errorf("Unexpected first record: %+v", records[0])
+	}
+
+	if records[1].Task.ID != "3" || records[1].Queue != QueueWaiting {
+		t.Errorf("Unexpected second record: %+v", records[1])
+	}
+}
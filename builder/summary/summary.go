@@ -0,0 +1,159 @@
+// Package summary makes short descriptions of failed builds for commit statuses
+package summary
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/pipeline"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// MaxLength is the limit of descriptions of commit statuses of GitHub
+const MaxLength = 140
+
+// maxTests limits the number of failed tests named in the description
+const maxTests = 3
+
+var (
+	// compileError matches errors of the compiler and vet, e.g. "./main.go:12:5: undefined: x"
+	compileError = regexp.MustCompile(`(?m)^(\S+\.go:\d+(?::\d+)?: .+)$`)
+
+	// failedTest matches failed top-level tests of go test output
+	failedTest = regexp.MustCompile(`(?m)^--- FAIL: (\S+)`)
+
+	// toolErrorLine matches errors of git, helm and other tools, e.g. "fatal: repository not found"
+	toolErrorLine = regexp.MustCompile(`(?m)^(?:fatal|error|Error): (.+)$`)
+)
+
+// Summarize returns a short description of the failed build by the step where it failed, its output and
+// results of tests if they are parsed. The output ends with the error of the runner, e.g. "Error: exit status 2".
+func Summarize(step, output string, tests *cicd.TestReport) string {
+	output, err := splitError(output)
+
+	var s string
+	switch step {
+	case task.StepFetch:
+		s = withDetail("Couldn't fetch the repository", toolError(output, err))
+	case task.StepCheckout:
+		s = withDetail("Couldn't check out the commit", toolError(output, err))
+	case task.StepPrepare:
+		switch {
+		case strings.Contains(err, "Makefile"):
+			s = withDetail("Couldn't parse the Makefile", err)
+		case strings.Contains(err, pipeline.FileName):
+			s = withDetail("Couldn't parse "+pipeline.FileName, strings.TrimPrefix(err, "couldn't parse "+pipeline.FileName+": "))
+		default:
+			s = withDetail("Couldn't download dependencies", first(compileErrorOf(output), toolError(output, err)))
+		}
+	case task.StepTest:
+		s = testsSummary("Tests failed", output, err, tests)
+	case task.StepCoverage:
+		s = withDetail("Coverage check failed", err)
+	case task.StepDeploy:
+		s = withDetail("Deploy failed", toolError(output, err))
+	case task.StepMatrix:
+		// the dispatcher describes states of cells of the matrix build
+		s = strings.TrimSpace(output)
+	case "":
+		s = withDetail("Build failed", toolError(output, err))
+	default:
+		s = testsSummary("Stage "+step+" failed", output, err, tests)
+	}
+
+	return Truncate(s)
+}
+
+// Truncate cuts the description to MaxLength characters
+func Truncate(s string) string {
+	runes := []rune(s)
+	if len(runes) <= MaxLength {
+		return s
+	}
+	return string(runes[:MaxLength-1]) + "…"
+}
+
+// testsSummary names failed tests or describes the first compile error of the step
+func testsSummary(prefix, output, err string, tests *cicd.TestReport) string {
+	names := failedTests(output, tests)
+	if len(names) > 0 {
+		list := strings.Join(names, ", ")
+		if len(names) > maxTests {
+			list = strings.Join(names[:maxTests], ", ") + " and " + strconv.Itoa(len(names)-maxTests) + " more"
+		}
+		return prefix + ": " + list
+	}
+
+	if compileErr := compileErrorOf(output); len(compileErr) > 0 {
+		return "Build failed: " + compileErr
+	}
+
+	return withDetail(prefix, toolError(output, err))
+}
+
+// failedTests returns names of failed top-level tests from the report or from the output
+func failedTests(output string, tests *cicd.TestReport) []string {
+	var names []string
+	if tests != nil {
+		for _, p := range tests.Packages {
+			for _, t := range p.Tests {
+				if t.Result == cicd.TestFail && !strings.Contains(t.Name, "/") {
+					names = append(names, t.Name)
+				}
+			}
+		}
+		return names
+	}
+
+	for _, match := range failedTest.FindAllStringSubmatch(output, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+func compileErrorOf(output string) string {
+	match := compileError.FindStringSubmatch(output)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimPrefix(match[1], "./")
+}
+
+// toolError returns the first error printed by git or another tool, or the error of the runner
+// if it is more than an exit status of the command
+func toolError(output, err string) string {
+	if match := toolErrorLine.FindStringSubmatch(output); match != nil {
+		return match[1]
+	}
+	if strings.HasPrefix(err, "exit status") {
+		return ""
+	}
+	return err
+}
+
+// splitError separates the output of commands and the error which is added to it by the runner
+func splitError(output string) (string, string) {
+	i := strings.LastIndex(output, "\n\nError: ")
+	if i < 0 {
+		return output, ""
+	}
+	return output[:i], strings.TrimSpace(output[i+len("\n\nError: "):])
+}
+
+func withDetail(s, detail string) string {
+	if len(detail) == 0 {
+		return s
+	}
+	return s + ": " + detail
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package summary
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/k8s-community/cicd"
+)
+
+func TestSummarize(t *testing.T) {
+	report := &cicd.TestReport{
+		Packages: []cicd.TestPackage{{
+			Name:   "example.com/app",
+			Result: cicd.TestFail,
+			Tests: []cicd.TestCase{
+				{Name: "TestOK", Result: cicd.TestPass},
+				{Name: "TestSub", Result: cicd.TestFail},
+				{Name: "TestSub/a", Result: cicd.TestFail},
+			},
+		}},
+	}
+
+	tests := []struct {
+		step     string
+		output   string
+		tests    *cicd.TestReport
+		expected string
+	}{
+		{
+			step:     "fetch",
+			output:   "Cloning into '.'...\nfatal: repository 'https://github.com/user/app/' not found\n \n\nError: exit status 128",
+			expected: "Couldn't fetch the repository: repository 'https://github.com/user/app/' not found",
+		},
+		{
+			step:     "checkout",
+			output:   "error: pathspec 'abc' did not match any file(s) known to git\n \n\nError: exit status 1",
+			expected: "Couldn't check out the commit: pathspec 'abc' did not match any file(s) known to git",
+		},
+		{
+			step:     "prepare",
+			output:   " \n\nError: couldn't open the original Makefile",
+			expected: "Couldn't parse the Makefile: couldn't open the original Makefile",
+		},
+		{
+			step:     "prepare",
+			output:   " \n\nError: couldn't parse .cicd.yml: stage build doesn't have commands",
+			expected: "Couldn't parse .cicd.yml: stage build doesn't have commands",
+		},
+		{
+			step:     "prepare",
+			output:   "go: example.com/lib@v1.0.0: reading example.com/lib: 404 Not Found\n \n\nError: exit status 1",
+			expected: "Couldn't download dependencies",
+		},
+		{
+			step:     "test",
+			output:   "+ test\n# example.com/app\n./main.go:12:5: undefined: x\n./main.go:13:5: undefined: y\n \n\nError: exit status 2",
+			expected: "Build failed: main.go:12:5: undefined: x",
+		},
+		{
+			step:     "test",
+			output:   "=== RUN   TestA\n    a_test.go:4: failed\n--- FAIL: TestA (0.00s)\n--- FAIL: TestB (0.00s)\n    --- FAIL: TestB/sub (0.00s)\n \n\nError: exit status 2",
+			expected: "Tests failed: TestA, TestB",
+		},
+		{
+			step:     "test",
+			output:   "--- FAIL: TestA (0.00s)\n--- FAIL: TestB (0.00s)\n--- FAIL: TestC (0.00s)\n--- FAIL: TestD (0.00s)\n--- FAIL: TestE (0.00s)\n",
+			expected: "Tests failed: TestA, TestB, TestC and 2 more",
+		},
+		{
+			step:     "test",
+			output:   "    sub_test.go:4: failed\n \n\nError: exit status 2",
+			tests:    report,
+			expected: "Tests failed: TestSub",
+		},
+		{
+			step:     "test",
+			output:   "make: *** No rule to make target 'test'.  Stop.\n \n\nError: exit status 2",
+			expected: "Tests failed",
+		},
+		{
+			step:     "lint",
+			output:   "./main.go:3:2: \"os\" imported and not used\n \n\nError: exit status 1",
+			expected: "Build failed: main.go:3:2: \"os\" imported and not used",
+		},
+		{
+			step:     "coverage",
+			output:   "ok\n \n\nError: coverage 70.0% is below 80.0%",
+			expected: "Coverage check failed: coverage 70.0% is below 80.0%",
+		},
+		{
+			step:     "deploy",
+			output:   "Error: UPGRADE FAILED: timed out waiting for the condition\n \n\nError: exit status 1",
+			expected: "Deploy failed: UPGRADE FAILED: timed out waiting for the condition",
+		},
+		{
+			output:   " \n\nError: couldn't create workspace: permission denied",
+			expected: "Build failed: couldn't create workspace: permission denied",
+		},
+		{
+			step:     "matrix",
+			output:   "1 of 2 cells passed: go1.10 failed",
+			expected: "1 of 2 cells passed: go1.10 failed",
+		},
+	}
+
+	for _, test := range tests {
+		s := Summarize(test.step, test.output, test.tests)
+		if s != test.expected {
+			t.Errorf("Step %q: expected %q, got %q", test.step, test.expected, s)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	s := Summarize("test", "./main.go:1:1: "+strings.Repeat("ошибка ", 50)+"\n", nil)
+	if len([]rune(s)) != MaxLength || !strings.HasSuffix(s, "…") {
+		t.Errorf("Unexpected description %q", s)
+	}
+
+	if Truncate("short") != "short" {
+		t.Errorf("Short description mustn't be changed")
+	}
+}
@@ -0,0 +1,139 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/k8s-community/cicd"
+)
+
+// MaxCells limits the number of cells of a matrix build
+const MaxCells = 32
+
+var (
+	goVersion = regexp.MustCompile(`^1\.\d+(\.\d+)?((beta|rc)\d+)?$`)
+	platform  = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9]+$`)
+)
+
+// Cell is a combination of a Go version and a target platform of a matrix build
+type Cell struct {
+	Go     string `json:"go,omitempty"`     // Go is a version of the toolchain, the default toolchain of the runner is used if empty
+	GOOS   string `json:"goos,omitempty"`   // GOOS and GOARCH are the target platform,
+	GOARCH string `json:"goarch,omitempty"` // the platform of the runner is used if they are empty
+
+	// State is a final state of the build of the cell, it is set by the dispatcher when the build is finished
+	State string `json:"state,omitempty"`
+}
+
+// NewMatrix validates the matrix and returns its cells, it returns nil if the matrix is empty
+func NewMatrix(m cicd.Matrix) ([]Cell, error) {
+	if len(m.Go) == 0 && len(m.Platforms) == 0 {
+		return nil, nil
+	}
+
+	versions := m.Go
+	if len(versions) == 0 {
+		versions = []string{""}
+	}
+	platforms := m.Platforms
+	if len(platforms) == 0 {
+		platforms = []string{""}
+	}
+	if len(versions)*len(platforms) > MaxCells {
+		return nil, fmt.Errorf("matrix has %d cells, at most %d are allowed", len(versions)*len(platforms), MaxCells)
+	}
+
+	var cells []Cell
+	seen := make(map[string]bool)
+	for _, version := range versions {
+		if len(version) > 0 && !goVersion.MatchString(version) {
+			return nil, fmt.Errorf("wrong Go version %q of the matrix", version)
+		}
+		for _, p := range platforms {
+			if len(p) > 0 && !platform.MatchString(p) {
+				return nil, fmt.Errorf("wrong platform %q of the matrix, it has to be GOOS/GOARCH", p)
+			}
+
+			cell := Cell{Go: version}
+			if len(p) > 0 {
+				cell.GOOS, cell.GOARCH = p[:strings.Index(p, "/")], p[strings.Index(p, "/")+1:]
+			}
+			if seen[cell.Name()] {
+				return nil, fmt.Errorf("cell %s is declared twice", cell.Name())
+			}
+			seen[cell.Name()] = true
+			cells = append(cells, cell)
+		}
+	}
+
+	return cells, nil
+}
+
+// Name returns a name of the cell, e.g. "go1.11 linux/arm64"
+func (c Cell) Name() string {
+	var parts []string
+	if len(c.Go) > 0 {
+		parts = append(parts, "go"+c.Go)
+	}
+	if len(c.GOOS) > 0 {
+		parts = append(parts, c.Platform())
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Platform returns the target platform of the cell in form of GOOS/GOARCH, it is empty if the platform isn't set
+func (c Cell) Platform() string {
+	if len(c.GOOS) == 0 {
+		return ""
+	}
+	return c.GOOS + "/" + c.GOARCH
+}
+
+// severity orders final states of cells, the worst one becomes the state of the matrix build:
+// failure of the code is the most important, cancellation is reported only if nothing went wrong
+var severity = map[string]int{
+	StateSuccess:   0,
+	StateCancelled: 1,
+	StateError:     2,
+	StateTimeout:   3,
+	StateFailure:   4,
+}
+
+// CombineCells returns the state of the matrix build and its description by states of its cells,
+// e.g. "1 of 3 cells passed: go1.10 linux/amd64 failed, go1.11 windows/amd64 timed out"
+func CombineCells(cells []Cell) (string, string) {
+	state := StateSuccess
+	passed := 0
+	var problems []string
+	for _, cell := range cells {
+		if cell.State == StateSuccess {
+			passed++
+			continue
+		}
+		if state == StateSuccess || severity[cell.State] > severity[state] {
+			state = cell.State
+		}
+		problems = append(problems, cell.Name()+" "+pastTense(cell.State))
+	}
+
+	if len(problems) == 0 {
+		return state, fmt.Sprintf("All %d cells passed", len(cells))
+	}
+	return state, fmt.Sprintf("%d of %d cells passed: %s", passed, len(cells), strings.Join(problems, ", "))
+}
+
+func pastTense(state string) string {
+	switch state {
+	case StateFailure:
+		return "failed"
+	case StateTimeout:
+		return "timed out"
+	case StateCancelled:
+		return "cancelled"
+	}
+	return "errored"
+}
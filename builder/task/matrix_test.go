@@ -0,0 +1,88 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/k8s-community/cicd"
+)
+
+func TestNewMatrix(t *testing.T) {
+	cells, err := NewMatrix(cicd.Matrix{Go: []string{"1.10", "1.11"}, Platforms: []string{"linux/amd64", "windows/386"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	var names []string
+	for _, cell := range cells {
+		names = append(names, cell.Name())
+	}
+	expected := []string{"go1.10 linux/amd64", "go1.10 windows/386", "go1.11 linux/amd64", "go1.11 windows/386"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected cells %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("Expected cell %s, got %s", expected[i], names[i])
+		}
+	}
+
+	cells, err = NewMatrix(cicd.Matrix{Platforms: []string{"linux/arm64"}})
+	if err != nil || len(cells) != 1 || cells[0].Go != "" || cells[0].GOOS != "linux" || cells[0].GOARCH != "arm64" {
+		t.Errorf("Unexpected cells %v or error %v", cells, err)
+	}
+
+	cells, err = NewMatrix(cicd.Matrix{})
+	if err != nil || cells != nil {
+		t.Errorf("Empty matrix has to be nil, got %v or error %v", cells, err)
+	}
+
+	wrong := []cicd.Matrix{
+		{Go: []string{"latest"}},
+		{Go: []string{"1.11; rm -rf /"}},
+		{Platforms: []string{"linux"}},
+		{Platforms: []string{"linux/amd64", "linux/amd64"}},
+		{Go: make([]string, MaxCells+1)},
+	}
+	for _, m := range wrong {
+		if _, err := NewMatrix(m); err == nil {
+			t.Errorf("Expected error for matrix %v", m)
+		}
+	}
+}
+
+func TestCombineCells(t *testing.T) {
+	tests := []struct {
+		states      []string
+		state       string
+		description string
+	}{
+		{
+			states:      []string{StateSuccess, StateSuccess},
+			state:       StateSuccess,
+			description: "All 2 cells passed",
+		},
+		{
+			states:      []string{StateCancelled, StateSuccess, StateFailure},
+			state:       StateFailure,
+			description: "1 of 3 cells passed: go1.10 cancelled, go1.12 failed",
+		},
+		{
+			states:      []string{StateTimeout, StateError},
+			state:       StateTimeout,
+			description: "0 of 2 cells passed: go1.10 timed out, go1.11 errored",
+		},
+	}
+
+	versions := []string{"1.10", "1.11", "1.12"}
+	for _, test := range tests {
+		var cells []Cell
+		for i, state := range test.states {
+			cells = append(cells, Cell{Go: versions[i], State: state})
+		}
+
+		state, description := CombineCells(cells)
+		if state != test.state || description != test.description {
+			t.Errorf("Expected %s %q, got %s %q", test.state, test.description, state, description)
+		}
+	}
+}
@@ -1,5 +1,14 @@
 package task
 
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/k8s-community/cicd"
+)
+
 const (
 	// StatePending marks what task is waiting for a free worker or processing
 	StatePending = "pending"
@@ -12,6 +21,12 @@ const (
 
 	// StateError marks what task wasn't processed because of error on CI/CD system
 	StateError = "error"
+
+	// StateTimeout marks what task was stopped because it exceeded its execution time
+	StateTimeout = "timeout"
+
+	// StateCancelled marks what task was cancelled by user's request
+	StateCancelled = "cancelled"
 )
 
 const (
@@ -20,21 +35,131 @@ const (
 
 	// TypeBuild represents build task (it runs 'make test' and 'make build' commands)
 	TypeBuild = "build"
+
+	// TypeDeploy represents deploy task (it runs 'make test' and 'make deploy' commands)
+	TypeDeploy = "deploy"
+)
+
+// Priorities of tasks, tasks with higher priority are processed first
+const (
+	// PriorityDefault is a priority of tests and builds
+	PriorityDefault = 0
+
+	// PriorityDeploy is a priority of deploys, they shouldn't wait behind tests
+	PriorityDeploy = 10
+
+	// PriorityMin and PriorityMax limit priorities requested explicitly,
+	// so a build couldn't outrank deploys and make builds of other users wait forever
+	PriorityMin = -10
+	PriorityMax = PriorityDeploy
+)
+
+// SupersededPrefix starts description of the task which was cancelled because of a newer commit of the same branch
+const SupersededPrefix = "Superseded by "
+
+// Steps of task processing
+const (
+	// StepFetch is getting of the source code
+	StepFetch = "fetch"
+
+	// StepCheckout is switching of the source code to the commit
+	StepCheckout = "checkout"
+
+	// StepPrepare is reading of the original Makefile and preparing of the environment
+	StepPrepare = "prepare"
+
+	// StepTest is running of 'make test'
+	StepTest = "test"
+
+	// StepDeploy is running of 'make deploy'
+	StepDeploy = "deploy"
+
+	// StepCoverage is checking of coverage of the code by tests
+	StepCoverage = "coverage"
+
+	// StepMatrix is waiting for builds of cells of the matrix
+	StepMatrix = "matrix"
 )
 
+// Tracker receives details about processing of the task besides its state
+type Tracker interface {
+	// Started is called when the worker takes the task
+	Started(taskID string, workerID int)
+
+	// Step is called when the runner goes to the next step of the task
+	Step(taskID string, step string)
+
+	// Artifact is called when the runner saves a file produced by the task
+	Artifact(taskID string, artifact cicd.Artifact)
+
+	// Tests is called when the runner parses results of tests, every call contains all results parsed so far
+	Tests(taskID string, report *cicd.TestReport)
+
+	// Coverage is called when the runner computes coverage of the code by tests
+	Coverage(taskID string, coverage *cicd.Coverage)
+
+	// Finished is called when the task leaves the dispatcher: it is processed, cancelled or rejected
+	Finished(taskID string)
+}
+
 // Callback is a function to update information about current task state
 type Callback func(taskID string, status string, description string)
 
 // CICD represents a task for CI/CD.
 type CICD struct {
-	Callback  Callback
-	ID        string
-	Type      string
-	Prefix    string // Prefix represents a prefix part for GOPATH, e.g. github.com, gitlab.com
-	Repo      string // Repo represent full a path to the repository, e.g. k8s-community/cicd
-	Commit    string
-	Version   string
-	Namespace string
+	Callback  Callback `json:"-"`
+	ID        string   `json:"id"`
+	Type      string   `json:"type"`
+	Prefix    string   `json:"prefix"` // Prefix represents a prefix part for GOPATH, e.g. github.com, gitlab.com
+	Repo      string   `json:"repo"`   // Repo represent full a path to the repository, e.g. k8s-community/cicd
+	Commit    string   `json:"commit"`
+	Version   string   `json:"version"`
+	Namespace string   `json:"namespace"`
+
+	// Username is the owner of the repository as it is requested, Namespace is its lowercase form
+	Username string `json:"username,omitempty"`
+
+	// Priority defines order of processing, tasks with higher priority are processed first,
+	// tasks of different namespaces with the same priority are processed in turn
+	Priority int `json:"priority"`
+
+	// URL is a remote URL of the repository, it is made of Prefix, Namespace and Repo if empty
+	URL string `json:"url,omitempty"`
+
+	// Branch is a branch or another ref of the commit, tasks without a branch are never superseded
+	Branch string `json:"branch,omitempty"`
+
+	// Trusted allows runners to give secrets of the namespace and the repository to the task,
+	// builds of pull requests aren't trusted because their code may come from forks
+	Trusted bool `json:"trusted,omitempty"`
+
+	Timeout     time.Duration `json:"timeout"`     // Timeout limits execution time of the whole task, runner's default is used if zero
+	StepTimeout time.Duration `json:"stepTimeout"` // StepTimeout limits execution time of every command, runner's default is used if zero
+
+	// Context is done when the task is cancelled, runners have to stop processing in this case
+	Context context.Context `json:"-"`
+
+	// Tracker is optional, it receives details about processing of the task
+	Tracker Tracker `json:"-"`
+
+	// Log is optional, runners write output of the task to it as soon as the output appears
+	Log io.Writer `json:"-"`
+
+	// Matrix contains cells of the matrix build, the dispatcher builds every cell by a task of its own
+	// and reports the combined state of the cells by the callback of this task
+	Matrix []Cell `json:"matrix,omitempty"`
+
+	// Cell is a cell of the matrix build which is built by the task, Parent is an ID of the matrix build
+	Cell   *Cell  `json:"cell,omitempty"`
+	Parent string `json:"parent,omitempty"`
+
+	// PrepareCell is optional, it sets up callback, tracker and log of tasks of cells of the matrix build,
+	// cells are reported only by the combined state of the matrix build if it is nil
+	PrepareCell func(cell *CICD) `json:"-"`
+
+	// Expand is set by the dispatcher, runners call it to build the matrix declared in the repository
+	// instead of the task, the combined state of the cells is reported when they are built
+	Expand func(cells []Cell) error `json:"-"`
 }
 
 // NewCICD creates an instance of a task.
@@ -50,3 +175,101 @@ func NewCICD(callback Callback, id, taskType, prefix, repo, commit, version stri
 		Namespace: namespace,
 	}
 }
+
+// Ctx returns context of the task or background context if the task doesn't have it
+func (t CICD) Ctx() context.Context {
+	if t.Context == nil {
+		return context.Background()
+	}
+	return t.Context
+}
+
+// Started marks what the task was taken by the worker
+func (t CICD) Started(workerID int) {
+	if t.Tracker != nil {
+		t.Tracker.Started(t.ID, workerID)
+	}
+}
+
+// Finished marks what the task left the dispatcher
+func (t CICD) Finished() {
+	if t.Tracker != nil {
+		t.Tracker.Finished(t.ID)
+	}
+}
+
+// LogWriter returns the log of the task or a writer which discards all data if the task doesn't have a log
+func (t CICD) LogWriter() io.Writer {
+	if t.Log == nil {
+		return ioutil.Discard
+	}
+	return t.Log
+}
+
+// Step marks what the runner goes to the next step of the task
+func (t CICD) Step(step string) {
+	if t.Tracker != nil {
+		t.Tracker.Step(t.ID, step)
+	}
+}
+
+// Artifact marks what the runner saved a file produced by the task
+func (t CICD) Artifact(artifact cicd.Artifact) {
+	if t.Tracker != nil {
+		t.Tracker.Artifact(t.ID, artifact)
+	}
+}
+
+// Tests marks what the runner parsed results of tests of the task
+func (t CICD) Tests(report *cicd.TestReport) {
+	if t.Tracker != nil {
+		t.Tracker.Tests(t.ID, report)
+	}
+}
+
+// Coverage marks what the runner computed coverage of the code by tests of the task
+func (t CICD) Coverage(coverage *cicd.Coverage) {
+	if t.Tracker != nil {
+		t.Tracker.Coverage(t.ID, coverage)
+	}
+}
+
+// RemoteURL returns URL of the repository to fetch it from
+func (t CICD) RemoteURL() string {
+	if len(t.URL) > 0 {
+		return t.URL
+	}
+	return "https://" + t.Prefix + "/" + t.Namespace + "/" + t.Repo
+}
+
+// Supersedes returns true if the task is a newer build of the same branch as the other one
+func (t CICD) Supersedes(other CICD) bool {
+	return len(t.Branch) > 0 && t.Branch == other.Branch && t.Type == other.Type &&
+		t.Prefix == other.Prefix && t.Namespace == other.Namespace && t.Repo == other.Repo && t.ID != other.ID
+}
+
+// KnownType reports whether the task type is one of the types of tasks
+func KnownType(taskType string) bool {
+	switch taskType {
+	case TypeTest, TypeBuild, TypeDeploy:
+		return true
+	}
+	return false
+}
+
+// KnownStep reports whether the step is one of the steps of task processing, stages of pipelines aren't known steps
+func KnownStep(step string) bool {
+	switch step {
+	case StepFetch, StepCheckout, StepPrepare, StepTest, StepDeploy, StepCoverage, StepMatrix:
+		return true
+	}
+	return false
+}
+
+// DefaultPriority returns priority of the task type if it isn't set explicitly
+func DefaultPriority(taskType string) int {
+	if taskType == TypeDeploy {
+		return PriorityDeploy
+	}
+	return PriorityDefault
+}
@@ -0,0 +1,114 @@
+package testreport
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/k8s-community/cicd"
+)
+
+// ContentType is a content type of JUnit XML
+const ContentType = "application/xml; charset=utf-8"
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Cases     []junitCase `xml:"testcase"`
+	SystemErr string      `xml:"system-err,omitempty"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML: packages are test suites and tests are test cases.
+// Failed packages without failed tests (e.g. build errors) are reported as errors of their suites.
+func WriteJUnit(w io.Writer, report *cicd.TestReport) error {
+	suites := junitSuites{
+		Tests:    report.Passed + report.Failed + report.Skipped,
+		Failures: report.Failed,
+		Skipped:  report.Skipped,
+		Time:     seconds(report.Elapsed),
+	}
+
+	for _, p := range report.Packages {
+		suite := junitSuite{Name: p.Name, Time: seconds(p.Elapsed)}
+
+		for _, t := range p.Tests {
+			testCase := junitCase{ClassName: p.Name, Name: t.Name, Time: seconds(t.Elapsed)}
+			switch t.Result {
+			case cicd.TestFail:
+				testCase.Failure = &junitMessage{Message: "Failed", Text: t.Output}
+				suite.Failures++
+			case cicd.TestSkip:
+				testCase.Skipped = &junitMessage{Message: skipReason(t.Output), Text: t.Output}
+				suite.Skipped++
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, testCase)
+		}
+
+		if p.Result == cicd.TestFail && suite.Failures == 0 {
+			suite.Errors = 1
+			suite.SystemErr = p.Output
+		}
+
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	err = encoder.Encode(suites)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// skipReason returns the message of t.Skip, it is the last line of the output before "--- SKIP"
+func skipReason(output string) string {
+	var reason string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "=== ") || strings.HasPrefix(line, "--- ") {
+			continue
+		}
+		reason = line
+	}
+	return reason
+}
+
+func seconds(elapsed float64) string {
+	return strconv.FormatFloat(elapsed, 'f', 3, 64)
+}
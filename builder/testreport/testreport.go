@@ -0,0 +1,235 @@
+// Package testreport parses `go test -json` output into reports of tests and exports them as JUnit XML
+package testreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/k8s-community/cicd"
+)
+
+// maxOutput limits the output kept for every test and package, the rest of the output is only in the log
+const maxOutput = 64 << 10
+
+// event is a line of `go test -json` output, see `go doc test2json`
+type event struct {
+	Action     string
+	Package    string
+	Test       string
+	Elapsed    float64
+	Output     string
+	ImportPath string // ImportPath is set by build-output events instead of Package
+}
+
+// Collector is a writer which parses `go test -json` output into the report and passes the plain text
+// of the output to the log, so the log stays readable. Lines which are not events are passed as is.
+type Collector struct {
+	log io.Writer
+
+	mx       *sync.Mutex
+	buf      []byte // incomplete line
+	found    bool   // found marks what at least one event is parsed
+	packages map[string]*pkg
+	order    []string // order of packages by their first event
+}
+
+// pkg accumulates events of the package
+type pkg struct {
+	result  string
+	elapsed float64
+	output  []byte
+	tests   map[string]*test
+	order   []string
+}
+
+// test accumulates events of the test
+type test struct {
+	result  string
+	elapsed float64
+	output  []byte
+}
+
+// NewCollector returns a Collector which writes the plain text of the output to log
+func NewCollector(log io.Writer) *Collector {
+	return &Collector{
+		log:      log,
+		mx:       &sync.Mutex{},
+		packages: make(map[string]*pkg),
+	}
+}
+
+// Write parses complete lines of the output, the incomplete line is buffered until the next write or Flush
+func (c *Collector) Write(p []byte) (int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.buf = append(c.buf, p...)
+	i := bytes.LastIndexByte(c.buf, '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	text := c.parse(c.buf[:i+1])
+	c.buf = append(c.buf[:0], c.buf[i+1:]...)
+
+	_, err := c.log.Write(text)
+	return len(p), err
+}
+
+// Flush parses the rest of buffered output as the last line
+func (c *Collector) Flush() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if len(c.buf) == 0 {
+		return nil
+	}
+
+	text := c.parse(append(c.buf, '\n'))
+	c.buf = c.buf[:0]
+
+	_, err := c.log.Write(text)
+	return err
+}
+
+// Report returns results of all parsed tests, it returns nil if the output didn't contain events
+func (c *Collector) Report() *cicd.TestReport {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if !c.found {
+		return nil
+	}
+
+	report := &cicd.TestReport{Packages: []cicd.TestPackage{}}
+	for _, name := range c.order {
+		p := c.packages[name]
+		result := p.result
+		if len(result) == 0 {
+			// the package was interrupted, e.g. by timeout of the step
+			result = cicd.TestFail
+		}
+
+		item := cicd.TestPackage{Name: name, Result: result, Elapsed: p.elapsed}
+		if result == cicd.TestFail {
+			item.Output = string(p.output)
+		}
+
+		for _, testName := range p.order {
+			t := p.tests[testName]
+			testResult := t.result
+			if len(testResult) == 0 {
+				testResult = cicd.TestFail
+			}
+
+			testCase := cicd.TestCase{Name: testName, Result: testResult, Elapsed: t.elapsed}
+			if testResult != cicd.TestPass {
+				testCase.Output = string(t.output)
+			}
+			item.Tests = append(item.Tests, testCase)
+
+			switch testResult {
+			case cicd.TestPass:
+				report.Passed++
+			case cicd.TestFail:
+				report.Failed++
+			case cicd.TestSkip:
+				report.Skipped++
+			}
+		}
+
+		report.Elapsed += p.elapsed
+		report.Packages = append(report.Packages, item)
+	}
+
+	return report
+}
+
+// Text returns the plain text of `go test -json` output, lines which are not events are kept as is
+func Text(output string) string {
+	c := NewCollector(&bytes.Buffer{})
+	return string(c.parse([]byte(output)))
+}
+
+// parse applies events of complete lines and returns their plain text, it has to be called under lock
+func (c *Collector) parse(lines []byte) []byte {
+	var text []byte
+	for len(lines) > 0 {
+		line := lines
+		if i := bytes.IndexByte(lines, '\n'); i >= 0 {
+			line, lines = lines[:i+1], lines[i+1:]
+		} else {
+			lines = nil
+		}
+
+		e, ok := parseEvent(line)
+		if !ok {
+			text = append(text, line...)
+			continue
+		}
+
+		c.found = true
+		c.apply(e)
+		text = append(text, e.Output...)
+	}
+	return text
+}
+
+func parseEvent(line []byte) (event, bool) {
+	var e event
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return e, false
+	}
+	if json.Unmarshal(trimmed, &e) != nil || len(e.Action) == 0 {
+		return e, false
+	}
+	if len(e.Package) == 0 && len(e.ImportPath) > 0 {
+		// build output of test binaries is reported for "pkg [pkg.test]"
+		e.Package = strings.SplitN(e.ImportPath, " ", 2)[0]
+	}
+	return e, len(e.Package) > 0
+}
+
+func (c *Collector) apply(e event) {
+	p, ok := c.packages[e.Package]
+	if !ok {
+		p = &pkg{tests: make(map[string]*test)}
+		c.packages[e.Package] = p
+		c.order = append(c.order, e.Package)
+	}
+
+	if len(e.Test) == 0 {
+		switch e.Action {
+		case "output", "build-output":
+			p.output = appendOutput(p.output, e.Output)
+		case cicd.TestPass, cicd.TestFail, cicd.TestSkip:
+			p.result, p.elapsed = e.Action, e.Elapsed
+		}
+		return
+	}
+
+	t, ok := p.tests[e.Test]
+	if !ok {
+		t = &test{}
+		p.tests[e.Test] = t
+		p.order = append(p.order, e.Test)
+	}
+
+	switch e.Action {
+	case "output":
+		t.output = appendOutput(t.output, e.Output)
+	case cicd.TestPass, cicd.TestFail, cicd.TestSkip:
+		t.result, t.elapsed = e.Action, e.Elapsed
+	}
+}
+
+func appendOutput(output []byte, s string) []byte {
+	if len(output)+len(s) > maxOutput {
+		return output
+	}
+	return append(output, s...)
+}
@@ -0,0 +1,113 @@
+package testreport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/k8s-community/cicd"
+)
+
+const output = `{"Action":"start","Package":"example.com/app/p"}
+{"Action":"run","Package":"example.com/app/p","Test":"TestOK"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestOK","Output":"--- PASS: TestOK (0.00s)\n"}
+{"Action":"pass","Package":"example.com/app/p","Test":"TestOK","Elapsed":0.01}
+{"Action":"run","Package":"example.com/app/p","Test":"TestFail"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestFail","Output":"=== RUN   TestFail\n"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestFail","Output":"    p_test.go:4: expected 1, got 2\n"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestFail","Output":"--- FAIL: TestFail (0.00s)\n"}
+{"Action":"fail","Package":"example.com/app/p","Test":"TestFail","Elapsed":0}
+{"Action":"run","Package":"example.com/app/p","Test":"TestSkip"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestSkip","Output":"=== RUN   TestSkip\n"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestSkip","Output":"    p_test.go:5: not ready\n"}
+{"Action":"output","Package":"example.com/app/p","Test":"TestSkip","Output":"--- SKIP: TestSkip (0.00s)\n"}
+{"Action":"skip","Package":"example.com/app/p","Test":"TestSkip","Elapsed":0}
+{"Action":"run","Package":"example.com/app/p","Test":"TestSub/a"}
+{"Action":"pass","Package":"example.com/app/p","Test":"TestSub/a","Elapsed":0}
+{"Action":"output","Package":"example.com/app/p","Output":"FAIL\texample.com/app/p\t0.008s\n"}
+{"Action":"fail","Package":"example.com/app/p","Elapsed":0.5}
+{"ImportPath":"example.com/app/q [example.com/app/q.test]","Action":"build-output","Output":"q/q.go:2:12: undefined: y\n"}
+{"ImportPath":"example.com/app/q [example.com/app/q.test]","Action":"build-fail"}
+{"Action":"output","Package":"example.com/app/q","Output":"FAIL\texample.com/app/q [build failed]\n"}
+{"Action":"fail","Package":"example.com/app/q","Elapsed":0}
+make: *** [test] Error 1
+`
+
+func TestCollector(t *testing.T) {
+	log := &bytes.Buffer{}
+	collector := NewCollector(log)
+
+	if collector.Report() != nil {
+		t.Errorf("Report mustn't be returned before events")
+	}
+
+	// writes split lines in the middle
+	for _, part := range []string{output[:100], output[100:1000], output[1000:]} {
+		collector.Write([]byte(part))
+	}
+	collector.Flush()
+
+	if strings.Contains(log.String(), `"Action"`) || !strings.Contains(log.String(), "    p_test.go:4: expected 1, got 2\n") ||
+		!strings.HasSuffix(log.String(), "[build failed]\nmake: *** [test] Error 1\n") {
+		t.Errorf("Unexpected log:\n%s", log.String())
+	}
+	if Text(output) != log.String() {
+		t.Errorf("Text of the output differs from the log:\n%s", Text(output))
+	}
+
+	report := collector.Report()
+	if report == nil {
+		t.Fatalf("Report is not parsed")
+	}
+	if report.Passed != 2 || report.Failed != 1 || report.Skipped != 1 || report.Elapsed != 0.5 || len(report.Packages) != 2 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+
+	p := report.Packages[0]
+	if p.Name != "example.com/app/p" || p.Result != cicd.TestFail || len(p.Tests) != 4 {
+		t.Fatalf("Unexpected package: %+v", p)
+	}
+	expected := []cicd.TestCase{
+		{Name: "TestOK", Result: cicd.TestPass, Elapsed: 0.01},
+		{Name: "TestFail", Result: cicd.TestFail, Output: "=== RUN   TestFail\n    p_test.go:4: expected 1, got 2\n--- FAIL: TestFail (0.00s)\n"},
+		{Name: "TestSkip", Result: cicd.TestSkip, Output: "=== RUN   TestSkip\n    p_test.go:5: not ready\n--- SKIP: TestSkip (0.00s)\n"},
+		{Name: "TestSub/a", Result: cicd.TestPass},
+	}
+	for i, test := range expected {
+		if p.Tests[i] != test {
+			t.Errorf("Expected test %+v, got %+v", test, p.Tests[i])
+		}
+	}
+
+	q := report.Packages[1]
+	if q.Result != cicd.TestFail || len(q.Tests) != 0 ||
+		q.Output != "q/q.go:2:12: undefined: y\nFAIL\texample.com/app/q [build failed]\n" {
+		t.Errorf("Unexpected package: %+v", q)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	collector := NewCollector(&bytes.Buffer{})
+	collector.Write([]byte(output))
+
+	buf := &bytes.Buffer{}
+	err := WriteJUnit(buf, collector.Report())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, part := range []string{
+		`<testsuites tests="4" failures="1" skipped="1" time="0.500">`,
+		`<testsuite name="example.com/app/p" tests="4" failures="1" errors="0" skipped="1" time="0.500">`,
+		`<testcase classname="example.com/app/p" name="TestOK" time="0.010"></testcase>`,
+		`<failure message="Failed">=== RUN   TestFail&#xA;    p_test.go:4: expected 1, got 2`,
+		`<skipped message="p_test.go:5: not ready">`,
+		`<testsuite name="example.com/app/q" tests="0" failures="0" errors="1" skipped="0" time="0.000">`,
+		`<system-err>q/q.go:2:12: undefined: y&#xA;`,
+	} {
+		if !strings.Contains(buf.String(), part) {
+			t.Errorf("JUnit report doesn't contain %s:\n%s", part, buf.String())
+		}
+	}
+}
@@ -16,8 +16,10 @@ type worker struct {
 
 	pool chan task.CICD // pool of tasks to be processed, shared between the dispatcher and the workers
 
-	mutex      *sync.RWMutex        // mutex of inProgress queue, shared between the dispatcher and the workers
-	inProgress map[string]task.CICD // queue of tasks which are currently in progress, shared between the dispatcher and the workers
+	mutex      *sync.RWMutex            // mutex of inProgress queue, shared between the dispatcher and the workers
+	inProgress map[string]task.CICD     // queue of tasks which are currently in progress, shared between the dispatcher and the workers
+	key        func(t task.CICD) string // key returns key of the task in the inProgress queue
+	finished   func(t task.CICD)        // finished is called when the task is removed from the inProgress queue
 
 	wgWorkersStopped *sync.WaitGroup // wait group to mark that workers are stoped
 
@@ -29,6 +31,8 @@ type worker struct {
 
 func newWorker(
 	processor Processor,
+	key func(t task.CICD) string,
+	finished func(t task.CICD),
 	log logrus.FieldLogger,
 	id int,
 	pool chan task.CICD,
@@ -41,6 +45,8 @@ func newWorker(
 		pool:             pool,
 		mutex:            mutex,
 		inProgress:       inProgress,
+		key:              key,
+		finished:         finished,
 		wgWorkersStopped: wgWorkersStopped,
 		processor:        processor,
 		log:              log,
@@ -52,6 +58,8 @@ func newWorker(
 // It will work until cancellation signal is sent.
 // worker reads tasks from the pool channel.
 func (w *worker) run() {
+	workers.Add(1, workerIdle)
+
 	go func() {
 		for {
 			select {
@@ -59,15 +67,24 @@ func (w *worker) run() {
 				logger := w.log.WithField("task_id", t.ID)
 				logger.Infof("worker #%d is processing task %s...", w.id, t.ID)
 
+				workers.Add(-1, workerIdle)
+				workers.Add(1, workerBusy)
+
+				t.Started(w.id)
 				w.processor(t)
 
+				workers.Add(-1, workerBusy)
+				workers.Add(1, workerIdle)
+
 				w.mutex.Lock()
-				delete(w.inProgress, t.Repo)
+				delete(w.inProgress, w.key(t))
 				w.mutex.Unlock()
+				w.finished(t)
 
 				logger.Infof("worker #%d processed task %s.", w.id, t.ID)
 
 			case <-w.cancel:
+				workers.Add(-1, workerIdle)
 				w.wgWorkersStopped.Done()
 				w.log.Infof("worker #%d stopped.", w.id)
 				return
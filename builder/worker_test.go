@@ -16,8 +16,14 @@ func prepareWorker(pool chan task.CICD, mx *sync.RWMutex, inProgress map[string]
 
 	id := 1
 
+	key := func(taskItem task.CICD) string {
+		return taskItem.Repo
+	}
+
 	worker := newWorker(
 		processor,
+		key,
+		func(task.CICD) {},
 		logrus.WithField("id", id),
 		id,
 		pool,
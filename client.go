@@ -3,6 +3,7 @@ package cicd
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/k8s-community/cicd/utils/rest"
 )
@@ -47,3 +48,53 @@ func (c *Client) Build(request *BuildRequest) (*BuildResponse, error) {
 
 	return response, nil
 }
+
+// Cancel stops the build which is queued or in progress.
+func (c *Client) Cancel(requestID string) (*BuildResponse, error) {
+	req, err := c.client.NewRequest("DELETE", buildURL+"/"+url.PathEscape(requestID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response = new(BuildResponse)
+
+	resp, err := c.client.Do(req, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if response.Error != nil {
+			return nil, fmt.Errorf("Code %d, %s", response.Error.Code, response.Error.Message)
+		}
+
+		return nil, fmt.Errorf("Unknown error from CICD service.")
+	}
+
+	return response, nil
+}
+
+// GetBuild returns information about the build.
+func (c *Client) GetBuild(requestID string) (*BuildRecordResponse, error) {
+	req, err := c.client.NewRequest("GET", buildURL+"/"+url.PathEscape(requestID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response = new(BuildRecordResponse)
+
+	resp, err := c.client.Do(req, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if response.Error != nil {
+			return nil, fmt.Errorf("Code %d, %s", response.Error.Code, response.Error.Message)
+		}
+
+		return nil, fmt.Errorf("Unknown error from CICD service.")
+	}
+
+	return response, nil
+}
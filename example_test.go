@@ -26,3 +26,25 @@ func ExampleBuild() {
 		fmt.Printf("Unknown error")
 	}
 }
+
+func ExampleClient_Cancel() {
+	client := cicd.NewClient("http://127.0.0.1:8080")
+
+	resp, err := client.Cancel("fc6d3dee-cc2d-4b09-9d69-f26dcadcc8da")
+	if err != nil {
+		fmt.Printf("Server error: %s", err)
+	} else if resp.Data != nil {
+		fmt.Printf("Build %s was cancelled", resp.Data.RequestID)
+	}
+}
+
+func ExampleClient_GetBuild() {
+	client := cicd.NewClient("http://127.0.0.1:8080")
+
+	resp, err := client.GetBuild("fc6d3dee-cc2d-4b09-9d69-f26dcadcc8da")
+	if err != nil {
+		fmt.Printf("Server error: %s", err)
+	} else if resp.Data != nil {
+		fmt.Printf("Build %s is in state %s", resp.Data.RequestID, resp.Data.State)
+	}
+}
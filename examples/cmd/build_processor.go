@@ -32,6 +32,6 @@ func main() {
 		*fNamespace,
 	)
 
-	runner := runners.NewLocal(log)
+	runner := runners.NewLocal(log, runners.LocalConfig{})
 	runner.Process(*taskItem)
 }
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/secrets"
+	"github.com/takama/router"
+)
+
+// Admin is a handler of maintenance requests, they are authorized by the token of the service
+type Admin struct {
+	token   string
+	build   *Build
+	secrets *secrets.Store // secrets of builds, secrets routes are disabled if nil
+	timeout time.Duration  // default limit of waiting for running builds during the drain
+	log     logrus.FieldLogger
+
+	drainOnce *sync.Once
+	drained   chan struct{} // Event marking what the drain is done
+}
+
+// NewAdmin returns an instance of Admin, running builds are waited for timeout during the drain
+func NewAdmin(token string, build *Build, secretStore *secrets.Store, timeout time.Duration, log logrus.FieldLogger) *Admin {
+	return &Admin{
+		token:     token,
+		build:     build,
+		secrets:   secretStore,
+		timeout:   timeout,
+		log:       log,
+		drainOnce: &sync.Once{},
+		drained:   make(chan struct{}),
+	}
+}
+
+// Drain stops accepting of new builds and waits until running builds are finished, but not longer than timeout.
+// Running builds are cancelled after the timeout, waiting builds are kept in the queue store or cancelled.
+// The drain is done only once, all calls return when it is done. It couldn't be undone:
+// the dispatcher is stopped and the service has to be restarted to process builds again.
+func (a *Admin) Drain(timeout time.Duration) {
+	a.drainOnce.Do(func() {
+		go func() {
+			defer close(a.drained)
+
+			a.log.Infof("Draining: new builds are rejected, running builds are waited for %s", timeout)
+			a.build.intake.close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			a.build.state.Drain(ctx)
+			a.log.Infof("Drained")
+		}()
+	})
+
+	<-a.drained
+}
+
+// PrepareShutdown handles request to drain the service before its restart,
+// the drain goes on in background, its progress is shown by the status.
+// The service doesn't process builds anymore until it is restarted.
+// Optional timeout parameter (in seconds) overrides the default limit of waiting for running builds.
+func (a *Admin) PrepareShutdown(c *router.Control) {
+	if !a.authorized(c) {
+		return
+	}
+
+	timeout := a.timeout
+	if param := c.Get("timeout"); len(param) > 0 {
+		seconds, err := strconv.Atoi(param)
+		if err != nil || seconds < 0 {
+			a.fail(c, http.StatusBadRequest, "The parameter timeout has to be a non-negative number of seconds.")
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	go a.Drain(timeout)
+
+	response := struct {
+		Draining bool `json:"draining"`
+	}{
+		Draining: true,
+	}
+	c.Code(http.StatusAccepted).Body(response)
+}
+
+// authorized checks the bearer token of the request and responds with error if it is wrong
+func (a *Admin) authorized(c *router.Control) bool {
+	header := c.Request.Header.Get("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+	if len(a.token) == 0 || token == header || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		a.log.Warnf("Unauthorized admin request %s %s", c.Request.Method, c.Request.URL.Path)
+		a.fail(c, http.StatusUnauthorized, "Admin token is wrong.")
+		return false
+	}
+	return true
+}
+
+func (a *Admin) fail(c *router.Control, code int, message string) {
+	response := cicd.BuildResponse{
+		Error: &cicd.Error{Code: code, Message: message},
+	}
+	c.Code(code).Body(response)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/takama/router"
+)
+
+func TestAdminAuthorized(t *testing.T) {
+	admin := NewAdmin("token", nil, nil, time.Minute, logrus.WithField("test", "admin"))
+
+	tests := []struct {
+		header     string
+		authorized bool
+	}{
+		{header: "Bearer token", authorized: true},
+		{header: "Bearer wrong"},
+		{header: "token"},
+		{},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/admin/prepare-shutdown", nil)
+		if len(test.header) > 0 {
+			request.Header.Set("Authorization", test.header)
+		}
+		recorder := httptest.NewRecorder()
+
+		authorized := admin.authorized(&router.Control{Request: request, Writer: recorder})
+		if authorized != test.authorized {
+			t.Errorf("Authorization %q: expected %v, got %v", test.header, test.authorized, authorized)
+		}
+		if !authorized && recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected code %d, got %d", test.header, http.StatusUnauthorized, recorder.Code)
+		}
+	}
+
+	if NewAdmin("", nil, nil, time.Minute, logrus.WithField("test", "admin")).authorized(&router.Control{
+		Request: httptest.NewRequest(http.MethodPost, "/api/v1/admin/prepare-shutdown", nil),
+		Writer:  httptest.NewRecorder(),
+	}) {
+		t.Errorf("Requests have to be rejected without a token")
+	}
+}
+
+func TestPrepareShutdown(t *testing.T) {
+	build, _, stop := prepareBuild(t)
+	defer stop()
+	admin := NewAdmin("token", build, nil, time.Minute, logrus.WithField("test", "admin"))
+
+	r := router.New()
+	r.POST("/api/v1/admin/prepare-shutdown", admin.PrepareShutdown)
+	r.POST("/api/v1/build", build.Run)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/admin/prepare-shutdown", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected code %d, got %d: %s", http.StatusAccepted, recorder.Code, recorder.Body)
+	}
+	admin.Drain(time.Minute)
+
+	// the drained service doesn't take builds until it is restarted
+	body := `{"username":"k8s-community","repository":"cicd","commitHash":"abc","task":"test"}`
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/build", strings.NewReader(body)))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected code %d after the drain, got %d: %s", http.StatusServiceUnavailable, recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/takama/router"
+)
+
+// Artifacts is a handler to list and download artifacts of builds
+type Artifacts struct {
+	builds    store.Builds
+	artifacts *store.Artifacts
+	log       logrus.FieldLogger
+}
+
+// NewArtifacts returns an instance of Artifacts
+func NewArtifacts(builds store.Builds, artifacts *store.Artifacts, log logrus.FieldLogger) *Artifacts {
+	return &Artifacts{
+		builds:    builds,
+		artifacts: artifacts,
+		log:       log,
+	}
+}
+
+// List shows artifacts of the build with their checksums,
+// artifacts which are removed by retention rules don't have download references
+func (a *Artifacts) List(c *router.Control) {
+	requestID := c.Get(":requestID")
+
+	record, err := a.builds.Get(requestID)
+	if err == store.ErrNotFound {
+		response := cicd.ArtifactsResponse{
+			Error: &cicd.Error{Code: http.StatusNotFound, Message: "Build is not found."},
+		}
+		c.Code(http.StatusNotFound).Body(response)
+		return
+	}
+	if err != nil {
+		a.log.WithField("requestID", requestID).Errorf("Couldn't get build record: %s", err)
+		response := cicd.ArtifactsResponse{
+			Error: &cicd.Error{Code: http.StatusInternalServerError, Message: "Couldn't get build record."},
+		}
+		c.Code(http.StatusInternalServerError).Body(response)
+		return
+	}
+
+	artifacts := make([]cicd.Artifact, 0, len(record.Artifacts))
+	for _, artifact := range record.Artifacts {
+		if a.artifacts.Exists(requestID, artifact.Name) {
+			artifact.DownloadRef = artifactRef(requestID, artifact.Name)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	c.Code(http.StatusOK).Body(cicd.ArtifactsResponse{Data: artifacts})
+}
+
+// Download sends the file of the artifact, its name is passed by name parameter
+func (a *Artifacts) Download(c *router.Control) {
+	requestID := c.Get(":requestID")
+	name := c.Get("name")
+
+	file, err := a.artifacts.Open(requestID, name)
+	if err == store.ErrNotFound {
+		response := cicd.ArtifactsResponse{
+			Error: &cicd.Error{Code: http.StatusNotFound, Message: "Artifact is not found or it is expired."},
+		}
+		c.Code(http.StatusNotFound).Body(response)
+		return
+	}
+	if err != nil {
+		a.log.WithField("requestID", requestID).Errorf("Couldn't open artifact %s: %s", name, err)
+		response := cicd.ArtifactsResponse{
+			Error: &cicd.Error{Code: http.StatusInternalServerError, Message: "Couldn't open artifact."},
+		}
+		c.Code(http.StatusInternalServerError).Body(response)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		a.log.WithField("requestID", requestID).Errorf("Couldn't open artifact %s: %s", name, err)
+		response := cicd.ArtifactsResponse{
+			Error: &cicd.Error{Code: http.StatusInternalServerError, Message: "Couldn't open artifact."},
+		}
+		c.Code(http.StatusInternalServerError).Body(response)
+		return
+	}
+
+	record, err := a.builds.Get(requestID)
+	if err == nil {
+		for _, artifact := range record.Artifacts {
+			if artifact.Name == name {
+				c.Writer.Header().Set("X-Checksum-Sha256", artifact.SHA256)
+			}
+		}
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/octet-stream")
+	c.Writer.Header().Set("Content-Disposition", `attachment; filename="`+strings.Replace(path.Base(name), `"`, "", -1)+`"`)
+	http.ServeContent(c.Writer, c.Request, name, info.ModTime(), file)
+}
+
+// artifactRef returns a reference to download the artifact
+func artifactRef(requestID, name string) string {
+	return "/api/v1/build/" + requestID + "/artifacts/download?name=" + url.QueryEscape(name)
+}
@@ -1,52 +1,203 @@
 package handlers
 
 import (
+	"bufio"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/k8s-community/cicd"
 	"github.com/k8s-community/cicd/builder"
+	"github.com/k8s-community/cicd/builder/source"
+	"github.com/k8s-community/cicd/builder/store"
 	"github.com/k8s-community/cicd/builder/task"
-	ghIntegr "github.com/k8s-community/github-integration/client"
+	"github.com/k8s-community/cicd/builder/testreport"
+	"github.com/k8s-community/cicd/notifier"
 	"github.com/satori/go.uuid"
 	"github.com/takama/router"
 )
 
 // Build is a handler to process Build requests
 type Build struct {
-	state                   *builder.Dispatcher
-	log                     logrus.FieldLogger
-	githubIntegrationClient *ghIntegr.Client
+	state     *builder.Dispatcher
+	builds    store.Builds
+	logs      *store.Logs
+	recorder  *recorder
+	intake    *intake
+	log       logrus.FieldLogger
+	notifiers *notifier.Registry
 }
 
-// NewBuild returns an instance of Build
-func NewBuild(state *builder.Dispatcher, log logrus.FieldLogger, ghIntClient *ghIntegr.Client) *Build {
+// NewBuild returns an instance of Build, new builds are rejected if they exceed the limits
+func NewBuild(state *builder.Dispatcher, builds store.Builds, logs *store.Logs, log logrus.FieldLogger, notifiers *notifier.Registry, limits Limits) *Build {
+	intake := newIntake(limits)
 	return &Build{
-		state: state,
-		log:   log,
-		githubIntegrationClient: ghIntClient,
+		state:     state,
+		builds:    builds,
+		logs:      logs,
+		recorder:  &recorder{builds: builds, logs: logs, log: log, intake: intake, notifiers: notifiers},
+		intake:    intake,
+		log:       log,
+		notifiers: notifiers,
 	}
 }
 
-// Status shows current tasks status
+// Status shows current tasks status, waiting tasks are listed with their positions and priorities
 func (b *Build) Status(c *router.Control) {
-	queue, current, reassign := b.state.GetTasks()
+	queue, current, blocked := b.state.GetTasks()
 
 	response := struct {
-		Reassign   []string `json:"reassign"`
-		Queue      []string `json:"queue"`
-		InProgress []string `json:"inProgress"`
+		Draining   bool                 `json:"draining"`
+		Blocked    []string             `json:"blocked"`
+		Reassign   []string             `json:"reassign"` // Reassign is the former name of Blocked, kept for old clients
+		Queue      []string             `json:"queue"`
+		Waiting    []builder.QueuedTask `json:"waiting"`
+		InProgress []string             `json:"inProgress"`
 	}{
-		Reassign:   reassign,
+		Draining:   b.intake.isClosed(),
+		Blocked:    blocked,
+		Reassign:   blocked,
 		Queue:      queue,
+		Waiting:    b.state.Waiting(),
 		InProgress: current,
 	}
 
 	c.Code(http.StatusOK).Body(response)
 }
 
+// Get shows information about the build
+func (b *Build) Get(c *router.Control) {
+	requestID := c.Get(":requestID")
+
+	record, err := b.builds.Get(requestID)
+	if err == store.ErrNotFound {
+		response := cicd.BuildRecordResponse{
+			Error: &cicd.Error{Code: http.StatusNotFound, Message: "Build is not found."},
+		}
+		c.Code(http.StatusNotFound).Body(response)
+		return
+	}
+	if err != nil {
+		b.log.WithField("requestID", requestID).Errorf("Couldn't get build record: %s", err)
+		response := cicd.BuildRecordResponse{
+			Error: &cicd.Error{Code: http.StatusInternalServerError, Message: "Couldn't get build record."},
+		}
+		c.Code(http.StatusInternalServerError).Body(response)
+		return
+	}
+
+	c.Code(http.StatusOK).Body(cicd.BuildRecordResponse{Data: record})
+}
+
+// Log shows the log of the build.
+// If follow parameter is true, the log is streamed as Server-Sent Events until the build is finished.
+func (b *Build) Log(c *router.Control) {
+	requestID := c.Get(":requestID")
+	follow := c.Get("follow") == "true"
+
+	reader, err := b.logs.Open(c.Request.Context(), requestID, follow)
+	if err == store.ErrNotFound {
+		response := cicd.BuildResponse{
+			Error: &cicd.Error{Code: http.StatusNotFound, Message: "Log of the build is not found."},
+		}
+		c.Code(http.StatusNotFound).Body(response)
+		return
+	}
+	if err != nil {
+		b.log.WithField("requestID", requestID).Errorf("Couldn't open build log: %s", err)
+		response := cicd.BuildResponse{
+			Error: &cicd.Error{Code: http.StatusInternalServerError, Message: "Couldn't open build log."},
+		}
+		c.Code(http.StatusInternalServerError).Body(response)
+		return
+	}
+	defer reader.Close()
+
+	if !follow {
+		c.Writer.Header().Set("Content-Type", router.MIMETEXT)
+		c.Writer.WriteHeader(http.StatusOK)
+		io.Copy(c.Writer, reader)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.WriteHeader(http.StatusOK)
+	flusher, _ := c.Writer.(http.Flusher)
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fmt.Fprintf(c.Writer, "data: %s\n\n", scanner.Text())
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if scanner.Err() == nil {
+		fmt.Fprint(c.Writer, "event: end\ndata: \n\n")
+	}
+}
+
+// Tests shows results of tests of the build, they are exported as JUnit XML if format parameter is junit
+func (b *Build) Tests(c *router.Control) {
+	requestID := c.Get(":requestID")
+
+	record, err := b.builds.Get(requestID)
+	if err != nil && err != store.ErrNotFound {
+		b.log.WithField("requestID", requestID).Errorf("Couldn't get build record: %s", err)
+		response := cicd.TestsResponse{
+			Error: &cicd.Error{Code: http.StatusInternalServerError, Message: "Couldn't get build record."},
+		}
+		c.Code(http.StatusInternalServerError).Body(response)
+		return
+	}
+	if err == store.ErrNotFound || record.Tests == nil {
+		response := cicd.TestsResponse{
+			Error: &cicd.Error{Code: http.StatusNotFound, Message: "Results of tests of the build are not found."},
+		}
+		c.Code(http.StatusNotFound).Body(response)
+		return
+	}
+
+	if c.Get("format") != "junit" {
+		c.Code(http.StatusOK).Body(cicd.TestsResponse{Data: record.Tests})
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", testreport.ContentType)
+	c.Writer.WriteHeader(http.StatusOK)
+	err = testreport.WriteJUnit(c.Writer, record.Tests)
+	if err != nil {
+		b.log.WithField("requestID", requestID).Errorf("Couldn't write JUnit report: %s", err)
+	}
+}
+
+// Cancel handles cancellation of the build
+func (b *Build) Cancel(c *router.Control) {
+	requestID := c.Get(":requestID")
+	logger := b.log.WithField("requestID", requestID)
+	logger.Infof("Cancelling request...")
+
+	err := b.state.CancelTask(requestID)
+	if err != nil {
+		logger.Errorf("Couldn't cancel the build: %s", err)
+		response := cicd.BuildResponse{
+			Error: &cicd.Error{Code: http.StatusNotFound, Message: "Build is not found or already finished."},
+		}
+		c.Code(http.StatusNotFound).Body(response)
+		return
+	}
+
+	data := &cicd.Build{RequestID: requestID}
+	response := cicd.BuildResponse{Data: data}
+	c.Code(http.StatusOK).Body(response)
+}
+
 // Run handles build running
 func (b *Build) Run(c *router.Control) {
 	requestID := uuid.NewV4().String()
@@ -66,61 +217,292 @@ func (b *Build) Run(c *router.Control) {
 		return
 	}
 
-	// TODO: manage amount of goroutines!
-	// TODO: add max execution time of goroutine!!!! If processing is too slow, we need to stop it
-	go b.processBuild(req, requestID)
+	if len(req.RepositoryURL) > 0 && !validRepositoryURL(req.RepositoryURL) {
+		c.Code(http.StatusBadRequest).Body("The field repositoryURL has to be HTTPS or SSH URL of the repository.")
+		return
+	}
+
+	if len(req.Task) > 0 && !task.KnownType(req.Task) {
+		c.Code(http.StatusBadRequest).Body("The field task has to be test, build or deploy.")
+		return
+	}
+
+	if req.Priority != nil && (*req.Priority < task.PriorityMin || *req.Priority > task.PriorityMax) {
+		c.Code(http.StatusBadRequest).Body(fmt.Sprintf("The field priority has to be from %d to %d.", task.PriorityMin, task.PriorityMax))
+		return
+	}
+
+	if req.Timeout < 0 || req.StepTimeout < 0 {
+		c.Code(http.StatusBadRequest).Body("The fields timeout and stepTimeout couldn't be negative.")
+		return
+	}
+
+	if req.Matrix != nil {
+		if req.Task == cicd.TaskDeploy {
+			c.Code(http.StatusBadRequest).Body("The field matrix couldn't be used with the deploy task.")
+			return
+		}
+		if _, err := task.NewMatrix(*req.Matrix); err != nil {
+			c.Code(http.StatusBadRequest).Body("The field matrix is wrong: " + err.Error() + ".")
+			return
+		}
+	}
+
+	err = b.enqueue(req, requestID)
+	if err != nil {
+		b.log.Infof("Build is rejected: %s", err)
+		reject(c, err)
+		return
+	}
 
 	data := &cicd.Build{RequestID: requestID}
 	response := cicd.BuildResponse{Data: data}
 	c.Code(http.StatusCreated).Body(response)
 }
 
-func (b *Build) processBuild(req *cicd.BuildRequest, requestID string) {
-	namespace := strings.ToLower(req.Username)
+// enqueue starts processing of the validated build request if it doesn't exceed the limits
+func (b *Build) enqueue(req *cicd.BuildRequest, requestID string) error {
+	err := b.intake.admit(requestID, req.Username, req.Repository)
+	if err != nil {
+		return err
+	}
 
-	callback := func(taskID string, state string, description string) {
-		b.log.Info("\n\nSending a callback...\n")
+	// the record is created before the response, so the build could be requested at once
+	t := b.newTask(req, requestID)
 
-		// TODO: send result of processing to integration service too!
-		callbackData := ghIntegr.BuildCallback{
-			Username:    req.Username,
-			Repository:  req.Repository,
-			CommitHash:  req.CommitHash,
-			State:       state,
-			BuildURL:    "https://ui.k8s.community/builds/" + requestID, // TODO: fix it!
-			Description: "Waiting for " + req.Task,                      // TODO: less than 120 symbols
-			Context:     "k8s-community/" + cicd.TaskTest,               // TODO: fix it!
-		}
-		err := b.githubIntegrationClient.Build.BuildCallback(callbackData)
-		if err != nil {
-			b.log.Errorf("couldn't send github status: '%v'", err)
-		}
+	// amount of goroutines is restricted by the limits
+	go b.processBuild(t, requestID)
+	return nil
+}
 
-		if state == ghIntegr.StatePending {
-			return
+// reject responds with the reason why the build couldn't be accepted
+func reject(c *router.Control, err error) {
+	code := http.StatusServiceUnavailable
+	if limit, ok := err.(*limitError); ok {
+		code = http.StatusTooManyRequests
+		if limit.retryAfter > 0 {
+			c.Writer.Header().Set("Retry-After", strconv.Itoa(int(limit.retryAfter.Seconds())))
 		}
+	}
 
-		resultsData := &ghIntegr.BuildResults{
-			UUID: requestID,
-			Username: req.Username,
-			Repository: req.Repository,
-			CommitHash: req.CommitHash,
-			Passed: state == ghIntegr.StateSuccess,
-			Log: description,
-		}
-		err = b.githubIntegrationClient.Build.BuildResults(resultsData)
-		if err != nil {
-			b.log.Errorf("couldn't save build info: '%v'", err)
-		}
+	response := cicd.BuildResponse{
+		Error: &cicd.Error{Code: code, Message: err.Error()},
 	}
+	c.Code(code).Body(response)
+}
+
+// newTask returns the task of the build request and creates the record of its build
+func (b *Build) newTask(req *cicd.BuildRequest, requestID string) *task.CICD {
+	namespace := strings.ToLower(req.Username)
+	callback := b.callback(req, requestID, "")
 
 	version := ""
 	if req.Version != nil {
 		version = *req.Version
 	}
+
+	prefix := "github.com"
+	if len(req.RepositoryURL) > 0 {
+		prefix = source.Host(req.RepositoryURL)
+	}
+
 	t := task.NewCICD(
-		callback, requestID, req.Task, "github.com", req.Repository, req.CommitHash, version, namespace,
+		callback, requestID, req.Task, prefix, req.Repository, req.CommitHash, version, namespace,
 	)
-	callback(requestID, ghIntegr.StatePending, "Task was queued")
-	b.state.AddTask(t)
+	t.Username = req.Username
+	t.URL = req.RepositoryURL
+	t.Branch = req.Branch
+	// code of pull requests may come from forks, it never gets secrets
+	t.Trusted = !strings.HasPrefix(req.Branch, "refs/pull/")
+	t.Priority = task.DefaultPriority(req.Task)
+	if req.Priority != nil {
+		t.Priority = *req.Priority
+	}
+	t.Timeout = time.Duration(req.Timeout) * time.Second
+	t.StepTimeout = time.Duration(req.StepTimeout) * time.Second
+	t.Tracker = b.recorder
+	t.Log = b.openLog(requestID)
+	t.PrepareCell = b.prepareCell(req)
+	if req.Matrix != nil {
+		// the matrix is validated by Run
+		t.Matrix, _ = task.NewMatrix(*req.Matrix)
+	}
+
+	b.createRecord(req, t)
+	return t
+}
+
+// processBuild reports the queued build and adds its task to the dispatcher
+func (b *Build) processBuild(t *task.CICD, requestID string) {
+	t.Callback(requestID, task.StatePending, "Task was queued")
+	err := b.state.AddTask(t)
+	if err != nil {
+		b.intake.release(requestID)
+	}
+}
+
+// prepareCell returns a function which sets up the task of the cell of the matrix build,
+// the cell has a build record and a log of its own and it is reported with commit status contexts of its own
+func (b *Build) prepareCell(req *cicd.BuildRequest) func(cell *task.CICD) {
+	return func(cell *task.CICD) {
+		name := cell.Cell.Name()
+		b.createRecord(req, cell)
+		b.recorder.AddCell(cell.Parent, cicd.BuildCell{RequestID: cell.ID, Name: name, State: task.StatePending})
+
+		cell.Callback = b.callback(req, cell.ID, name)
+		cell.Tracker = b.recorder
+		cell.Log = b.openLog(cell.ID)
+		cell.Callback(cell.ID, task.StatePending, "Task was queued")
+	}
+}
+
+// createRecord creates the record of the build of the task
+func (b *Build) createRecord(req *cicd.BuildRequest, t *task.CICD) {
+	record := cicd.BuildRecord{
+		RequestID:  t.ID,
+		Username:   req.Username,
+		Repository: req.Repository,
+		CommitHash: req.CommitHash,
+		Task:       req.Task,
+		Version:    t.Version,
+
+		RepositoryURL: req.RepositoryURL,
+		Branch:        req.Branch,
+		Priority:      t.Priority,
+
+		State:    task.StatePending,
+		LogRef:   "/api/v1/build/" + t.ID + "/log",
+		QueuedAt: time.Now(),
+
+		Parent: t.Parent,
+	}
+	if t.Cell != nil {
+		record.Cell = t.Cell.Name()
+	}
+
+	err := b.builds.Create(record)
+	if err != nil {
+		b.log.WithField("requestID", t.ID).Errorf("Couldn't create build record: %s", err)
+	}
+}
+
+// RestoreTask sets up callback and tracker of the task which was restored from the queue store
+func (b *Build) RestoreTask(t *task.CICD) {
+	username := t.Username
+	if len(username) == 0 {
+		// the task was saved before usernames were kept
+		username = t.Namespace
+	}
+
+	version, priority := t.Version, t.Priority
+	req := &cicd.BuildRequest{
+		Username:   username,
+		Repository: t.Repo,
+		CommitHash: t.Commit,
+		Task:       t.Type,
+		Version:    &version,
+		Priority:   &priority,
+
+		RepositoryURL: t.URL,
+		Branch:        t.Branch,
+	}
+
+	var cell string
+	if t.Cell != nil {
+		cell = t.Cell.Name()
+	}
+
+	b.intake.force(t.ID, t.Namespace, t.Repo)
+	t.Callback = b.callback(req, t.ID, cell)
+	t.Tracker = b.recorder
+	t.Log = b.openLog(t.ID)
+	t.PrepareCell = b.prepareCell(req)
+}
+
+// validRepositoryURL returns true if the URL points to a remote host by HTTP(S), SSH or git protocols,
+// local repositories of the service mustn't be accessible
+func validRepositoryURL(remote string) bool {
+	if strings.HasPrefix(remote, "-") || len(source.Host(remote)) == 0 {
+		return false
+	}
+
+	if !strings.Contains(remote, "://") {
+		// scp-like SSH address, but not a remote helper like ext::command
+		return !strings.Contains(remote, "::")
+	}
+
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://"} {
+		if strings.HasPrefix(remote, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openLog opens the log of the build, the build is processed without log if it couldn't be opened
+func (b *Build) openLog(requestID string) io.Writer {
+	log, err := b.logs.Create(requestID)
+	if err != nil {
+		b.log.WithField("requestID", requestID).Errorf("Couldn't create build log: %s", err)
+		return nil
+	}
+
+	return log
+}
+
+// callback returns a function which records state of the task and notifies about it,
+// cell is a name of the cell if the task builds a cell of the matrix build
+func (b *Build) callback(req *cicd.BuildRequest, requestID string, cell string) task.Callback {
+	version := ""
+	if req.Version != nil {
+		version = *req.Version
+	}
+
+	return func(taskID string, state string, output string) {
+		b.recorder.State(taskID, state)
+
+		desc := description(state, req.Task, output)
+		if state == task.StateError || state == task.StateFailure {
+			desc = b.recorder.Summary(taskID, output)
+		}
+		if state == task.StateSuccess {
+			if coverageDesc := b.recorder.CoverageSummary(taskID); len(coverageDesc) > 0 {
+				desc = coverageDesc
+			}
+		}
+		if state != task.StatePending {
+			if matrixDesc := b.recorder.MatrixSummary(taskID, output); len(matrixDesc) > 0 {
+				desc = matrixDesc
+			}
+			b.recorder.FinishStage(taskID, state, desc)
+		}
+
+		b.notifiers.Notify(notifier.Event{
+			RequestID:   requestID,
+			Namespace:   strings.ToLower(req.Username),
+			Username:    req.Username,
+			Repository:  req.Repository,
+			CommitHash:  req.CommitHash,
+			Task:        req.Task,
+			Version:     version,
+			Cell:        cell,
+			State:       state,
+			Description: desc,
+			Log:         output,
+		})
+	}
+}
+
+// description returns a short description of the state for commit statuses
+func description(state, taskType, output string) string {
+	switch state {
+	case task.StateTimeout:
+		return "Timed out while waiting for " + taskType
+	case task.StateCancelled:
+		if strings.HasPrefix(output, task.SupersededPrefix) {
+			return output
+		}
+		return "Cancelled while waiting for " + taskType
+	}
+	return "Waiting for " + taskType
 }
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder"
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/notifier"
+	"github.com/takama/router"
+)
+
+// prepareBuild returns the Build whose tasks are sent to the channel and succeed at once,
+// stop shuts the dispatcher down and removes logs of builds
+func prepareBuild(t *testing.T) (*Build, chan task.CICD, func()) {
+	dir, err := ioutil.TempDir("", "cicd-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := store.NewLogs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := make(chan task.CICD, 10)
+	processor := func(taskItem task.CICD) {
+		tasks <- taskItem
+		taskItem.Callback(taskItem.ID, task.StateSuccess, "Passed")
+	}
+	log := logrus.WithField("test", "build")
+	disp := builder.NewDispatcher(processor, log, 1)
+
+	templates, _ := notifier.NewTemplates("", "")
+	build := NewBuild(disp, store.NewMemoryBuilds(store.Retention{}), logs, log, notifier.NewRegistry(log, templates), Limits{})
+
+	return build, tasks, func() {
+		disp.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestValidRepositoryURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://gitlab.com/group/repo.git":   true,
+		"ssh://git@gitea.local:2222/repo.git": true,
+		"git@github.com:k8s-community/cicd":   true,
+		"file:///var/lib/repos/repo.git":      false,
+		"/var/lib/repos/repo.git":             false,
+		"--upload-pack=touch /tmp/pwned":      false,
+		"ext::sh -c touch /tmp/pwned":         false,
+	}
+
+	for remote, valid := range tests {
+		if validRepositoryURL(remote) != valid {
+			t.Errorf("Expected %v for %s", valid, remote)
+		}
+	}
+}
+
+func TestRunValidation(t *testing.T) {
+	build := NewBuild(nil, nil, nil, logrus.WithField("test", "build"), nil, Limits{})
+
+	tests := map[string]string{
+		`{"username":"k8s-community","repository":"cicd"}`:                                                           "required",
+		`{"username":"k8s-community","repository":"cicd","commitHash":"1","task":"lint"}`:                            "field task",
+		`{"username":"k8s-community","repository":"cicd","commitHash":"1","priority":1000}`:                          "field priority",
+		`{"username":"k8s-community","repository":"cicd","commitHash":"1","priority":-11}`:                           "field priority",
+		`{"username":"k8s-community","repository":"cicd","commitHash":"1","timeout":-1}`:                             "negative",
+		`{"username":"k8s-community","repository":"cicd","commitHash":"1","matrix":{"go":["latest"]}}`:               "matrix is wrong",
+		`{"username":"k8s-community","repository":"cicd","commitHash":"1","task":"deploy","matrix":{"go":["1.11"]}}`: "deploy task",
+	}
+
+	for body, message := range tests {
+		recorder := httptest.NewRecorder()
+		build.Run(&router.Control{Request: httptest.NewRequest(http.MethodPost, "/api/v1/build", strings.NewReader(body)), Writer: recorder})
+
+		if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), message) {
+			t.Errorf("Request %s: expected code %d and %q, got %d %s", body, http.StatusBadRequest, message, recorder.Code, recorder.Body)
+		}
+	}
+}
+
+func TestRunCreatesRecord(t *testing.T) {
+	build, tasks, stop := prepareBuild(t)
+	defer stop()
+
+	r := router.New()
+	r.POST("/api/v1/build", build.Run)
+	r.GET("/api/v1/build/:requestID", build.Get)
+
+	body := `{"username":"k8s-community","repository":"cicd","commitHash":"abc","task":"test"}`
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/build", strings.NewReader(body)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Expected code %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body)
+	}
+	response := new(cicd.BuildResponse)
+	json.NewDecoder(recorder.Body).Decode(response)
+
+	// the record is available right after the response
+	recorder = httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/build/"+response.Data.RequestID, nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected code %d of the new build, got %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+
+	select {
+	case <-tasks:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Build wasn't started")
+	}
+}
+
+func TestRestoreTask(t *testing.T) {
+	build, _, stop := prepareBuild(t)
+	defer stop()
+	fake := &fakeNotifier{}
+	build.notifiers.Register("", fake)
+
+	restored := task.NewCICD(nil, "1", task.TypeDeploy, "github.com", "cicd", "abc", "v1.0.0", "k8s-community")
+	restored.Username = "K8s-Community"
+	restored.Priority = 5
+	restored.Matrix = []task.Cell{{Go: "1.11"}}
+	build.RestoreTask(restored)
+	restored.Callback(restored.ID, task.StatePending, "Task was restored")
+
+	if len(fake.events) != 1 || fake.events[0].Username != "K8s-Community" || fake.events[0].Namespace != "k8s-community" ||
+		fake.events[0].Version != "v1.0.0" {
+		t.Errorf("Unexpected events of the restored task: %+v", fake.events)
+	}
+
+	// cells of the restored matrix build get records of their own from the restored request
+	cell := *restored
+	cell.ID, cell.Parent, cell.Cell = "1-1", restored.ID, &restored.Matrix[0]
+	restored.PrepareCell(&cell)
+
+	record, err := build.builds.Get(cell.ID)
+	if err != nil {
+		t.Fatalf("Record of the cell wasn't created: %s", err)
+	}
+	if record.Version != "v1.0.0" || record.Priority != 5 || record.Username != "K8s-Community" {
+		t.Errorf("Unexpected record of the cell of the restored build: %+v", record)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	build, _, stop := prepareBuild(t)
+	defer stop()
+
+	recorder := httptest.NewRecorder()
+	build.Status(&router.Control{Request: httptest.NewRequest(http.MethodGet, "/api/v1/status", nil), Writer: recorder})
+
+	status := make(map[string]interface{})
+	json.NewDecoder(recorder.Body).Decode(&status)
+	for _, key := range []string{"draining", "blocked", "reassign", "queue", "waiting", "inProgress"} {
+		if _, ok := status[key]; !ok {
+			t.Errorf("Status doesn't contain %s: %v", key, status)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits restrict amount of builds which are accepted but not taken by workers yet, zero means no limit
+type Limits struct {
+	Queue      int // Queue limits builds of the whole service
+	Namespace  int // Namespace limits builds of every user
+	Repository int // Repository limits builds of every repository
+
+	// RetryAfter is suggested to clients whose builds are rejected because of the limits
+	RetryAfter time.Duration
+}
+
+// errShuttingDown means what the build is rejected because the service is drained
+var errShuttingDown = errors.New("CI/CD service is shutting down, please, try again later.")
+
+// limitError means what the build is rejected because one of the limits is reached
+type limitError struct {
+	message    string
+	retryAfter time.Duration
+}
+
+func (e *limitError) Error() string {
+	return e.message
+}
+
+// intake counts builds which are accepted but not taken by workers yet
+type intake struct {
+	limits Limits
+
+	mx         *sync.Mutex
+	closed     bool                 // closed intake rejects all builds
+	builds     map[string][2]string // namespace and repository of every counted build
+	namespaces map[string]int
+	repos      map[string]int
+}
+
+func newIntake(limits Limits) *intake {
+	return &intake{
+		limits:     limits,
+		mx:         &sync.Mutex{},
+		builds:     make(map[string][2]string),
+		namespaces: make(map[string]int),
+		repos:      make(map[string]int),
+	}
+}
+
+// admit counts the build if none of the limits is reached, otherwise it returns *limitError.
+// All builds are rejected with errShuttingDown if the intake is closed.
+func (i *intake) admit(requestID, namespace, repository string) error {
+	namespace = strings.ToLower(namespace)
+	repository = namespace + "/" + strings.ToLower(repository)
+
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	if i.closed {
+		return errShuttingDown
+	}
+
+	var message string
+	switch {
+	case i.limits.Queue > 0 && len(i.builds) >= i.limits.Queue:
+		message = fmt.Sprintf("Queue of the service is full (%d builds), please, try again later.", i.limits.Queue)
+	case i.limits.Namespace > 0 && i.namespaces[namespace] >= i.limits.Namespace:
+		message = fmt.Sprintf("User %s has %d queued builds already, please, try again later.", namespace, i.limits.Namespace)
+	case i.limits.Repository > 0 && i.repos[repository] >= i.limits.Repository:
+		message = fmt.Sprintf("Repository %s has %d queued builds already, please, try again later.", repository, i.limits.Repository)
+	}
+	if len(message) > 0 {
+		return &limitError{message: message, retryAfter: i.limits.RetryAfter}
+	}
+
+	i.add(requestID, namespace, repository)
+	return nil
+}
+
+// close makes the intake reject all new builds
+func (i *intake) close() {
+	i.mx.Lock()
+	i.closed = true
+	i.mx.Unlock()
+}
+
+// isClosed returns true if the intake rejects all new builds
+func (i *intake) isClosed() bool {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	return i.closed
+}
+
+// force counts the build regardless of the limits, e.g. builds restored after restart have to be processed anyway
+func (i *intake) force(requestID, namespace, repository string) {
+	namespace = strings.ToLower(namespace)
+	repository = namespace + "/" + strings.ToLower(repository)
+
+	i.mx.Lock()
+	i.add(requestID, namespace, repository)
+	i.mx.Unlock()
+}
+
+// release stops counting the build, it is safe to release the build several times
+func (i *intake) release(requestID string) {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	build, ok := i.builds[requestID]
+	if !ok {
+		return
+	}
+
+	delete(i.builds, requestID)
+	i.decrement(i.namespaces, build[0])
+	i.decrement(i.repos, build[1])
+}
+
+func (i *intake) add(requestID, namespace, repository string) {
+	if _, ok := i.builds[requestID]; ok {
+		return
+	}
+
+	i.builds[requestID] = [2]string{namespace, repository}
+	i.namespaces[namespace]++
+	i.repos[repository]++
+}
+
+func (i *intake) decrement(counts map[string]int, key string) {
+	counts[key]--
+	if counts[key] <= 0 {
+		delete(counts, key)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntake(t *testing.T) {
+	in := newIntake(Limits{Queue: 3, Namespace: 2, Repository: 1, RetryAfter: time.Minute})
+
+	admit := func(id, namespace, repository string, allowed bool) {
+		err := in.admit(id, namespace, repository)
+		if allowed && err != nil {
+			t.Fatalf("Build %s was rejected: %s", id, err)
+		}
+		if !allowed {
+			limit, ok := err.(*limitError)
+			if !ok {
+				t.Fatalf("Build %s: expected limit error, got %v", id, err)
+			}
+			if limit.retryAfter != time.Minute {
+				t.Errorf("Build %s: expected retry after %s, got %s", id, time.Minute, limit.retryAfter)
+			}
+		}
+	}
+
+	admit("1", "user_1", "repo_1", true)
+	admit("2", "User_1", "Repo_1", false) // repository limit
+	admit("3", "user_1", "repo_2", true)
+	admit("4", "user_1", "repo_3", false) // namespace limit
+	admit("5", "user_2", "repo_1", true)
+	admit("6", "user_3", "repo_1", false) // queue limit
+
+	in.release("1")
+	in.release("1")
+	admit("7", "user_1", "repo_1", true)
+
+	// restored builds are counted, but never rejected
+	in.force("8", "user_4", "repo_1")
+	if len(in.builds) != 4 {
+		t.Errorf("Expected 4 counted builds, got %d", len(in.builds))
+	}
+
+	for _, id := range []string{"3", "5", "7", "8"} {
+		in.release(id)
+	}
+	if len(in.builds) != 0 || len(in.namespaces) != 0 || len(in.repos) != 0 {
+		t.Errorf("Counters weren't released: %v %v %v", in.builds, in.namespaces, in.repos)
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/coverage"
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/summary"
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/notifier"
+)
+
+// recorder keeps build records and logs up to date and reports states of steps of builds, it implements task.Tracker
+type recorder struct {
+	builds    store.Builds
+	logs      *store.Logs
+	intake    *intake // builds leave the intake when they are taken by workers or finished without processing
+	log       logrus.FieldLogger
+	notifiers *notifier.Registry
+}
+
+// Started marks what the build was taken by the worker
+func (r *recorder) Started(taskID string, workerID int) {
+	r.intake.release(taskID)
+	r.update(taskID, func(record *cicd.BuildRecord) {
+		now := time.Now()
+		record.StartedAt = &now
+		record.WorkerID = &workerID
+	})
+}
+
+// Step marks what the build goes to the next step, so the previous step is passed
+func (r *recorder) Step(taskID string, step string) {
+	var previous string
+	record, ok := r.update(taskID, func(record *cicd.BuildRecord) {
+		previous = record.Step
+		record.Step = step
+	})
+	if !ok || previous == step {
+		return
+	}
+
+	if len(previous) > 0 {
+		r.notifyStage(record, previous, task.StateSuccess, "Stage "+previous+" passed")
+	}
+	r.notifyStage(record, step, task.StatePending, "Stage "+step+" is running")
+}
+
+// FinishStage reports the final state of the step where the build is stopped
+func (r *recorder) FinishStage(taskID string, state string, description string) {
+	record, err := r.builds.Get(taskID)
+	if err != nil {
+		r.log.WithField("requestID", taskID).Errorf("Couldn't get build record: %s", err)
+		return
+	}
+	if len(record.ExitStep) == 0 {
+		return
+	}
+
+	r.notifyStage(*record, record.ExitStep, state, description)
+}
+
+// Artifact adds the artifact to the record of the build
+func (r *recorder) Artifact(taskID string, artifact cicd.Artifact) {
+	r.update(taskID, func(record *cicd.BuildRecord) {
+		record.Artifacts = append(record.Artifacts, artifact)
+	})
+}
+
+// Tests saves results of tests to the record of the build
+func (r *recorder) Tests(taskID string, report *cicd.TestReport) {
+	r.update(taskID, func(record *cicd.BuildRecord) {
+		record.Tests = report
+	})
+}
+
+// Coverage saves coverage of the code by tests to the record of the build
+func (r *recorder) Coverage(taskID string, coverage *cicd.Coverage) {
+	r.update(taskID, func(record *cicd.BuildRecord) {
+		record.Coverage = coverage
+	})
+}
+
+// Summary saves a short description of the failed build to its record and returns it
+func (r *recorder) Summary(taskID string, output string) string {
+	var desc string
+	r.update(taskID, func(record *cicd.BuildRecord) {
+		desc = summary.Summarize(record.ExitStep, output, record.Tests)
+		record.Summary = desc
+	})
+	if len(desc) == 0 {
+		// the record is lost, so the step is unknown
+		desc = summary.Summarize("", output, nil)
+	}
+	return desc
+}
+
+// CoverageSummary returns a short description of coverage of the build or empty string if it isn't collected
+func (r *recorder) CoverageSummary(taskID string) string {
+	record, err := r.builds.Get(taskID)
+	if err != nil || record.Coverage == nil {
+		return ""
+	}
+	return summary.Truncate(coverage.Describe(record.Coverage))
+}
+
+// Finished closes the log of the build
+func (r *recorder) Finished(taskID string) {
+	r.intake.release(taskID)
+	err := r.logs.Finish(taskID)
+	if err != nil {
+		r.log.WithField("requestID", taskID).Errorf("Couldn't close build log: %s", err)
+	}
+}
+
+// State saves the state of the build reported by the callback, the final state of the cell
+// is saved to the record of its matrix build too
+func (r *recorder) State(taskID string, state string) {
+	record, ok := r.update(taskID, func(record *cicd.BuildRecord) {
+		record.State = state
+		if state == task.StatePending {
+			return
+		}
+
+		now := time.Now()
+		record.FinishedAt = &now
+		record.ExitStep = record.Step
+	})
+	if !ok || len(record.Parent) == 0 || state == task.StatePending {
+		return
+	}
+
+	r.update(record.Parent, func(parent *cicd.BuildRecord) {
+		for i := range parent.Cells {
+			if parent.Cells[i].RequestID == taskID {
+				parent.Cells[i].State = state
+			}
+		}
+	})
+}
+
+// AddCell adds the cell to the record of its matrix build
+func (r *recorder) AddCell(parentID string, cell cicd.BuildCell) {
+	r.update(parentID, func(record *cicd.BuildRecord) {
+		record.Cells = append(record.Cells, cell)
+	})
+}
+
+// MatrixSummary returns the description of the finished matrix build made of states of its cells by the dispatcher,
+// it returns empty string if the build isn't a matrix build
+func (r *recorder) MatrixSummary(taskID string, output string) string {
+	record, err := r.builds.Get(taskID)
+	if err != nil || record.ExitStep != task.StepMatrix {
+		return ""
+	}
+	return summary.Truncate(output)
+}
+
+// notifyStage sends the event about the step of the build, its commit status has a context of its own
+func (r *recorder) notifyStage(record cicd.BuildRecord, stage string, state string, description string) {
+	r.notifiers.Notify(notifier.Event{
+		RequestID:   record.RequestID,
+		Namespace:   strings.ToLower(record.Username),
+		Username:    record.Username,
+		Repository:  record.Repository,
+		CommitHash:  record.CommitHash,
+		Task:        record.Task,
+		Version:     record.Version,
+		Stage:       stage,
+		Cell:        record.Cell,
+		State:       state,
+		Description: description,
+	})
+}
+
+// update changes the record and returns its copy, it returns false if the record couldn't be updated
+func (r *recorder) update(taskID string, update func(record *cicd.BuildRecord)) (cicd.BuildRecord, bool) {
+	var updated cicd.BuildRecord
+	err := r.builds.Update(taskID, func(record *cicd.BuildRecord) {
+		update(record)
+		updated = *record
+	})
+	if err != nil {
+		r.log.WithField("requestID", taskID).Errorf("Couldn't update build record: %s", err)
+		return updated, false
+	}
+	return updated, true
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/store"
+	"github.com/k8s-community/cicd/builder/task"
+	"github.com/k8s-community/cicd/notifier"
+)
+
+// fakeNotifier collects received events
+type fakeNotifier struct {
+	events []notifier.Event
+}
+
+func (f *fakeNotifier) Notify(event notifier.Event) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestRecorderStages(t *testing.T) {
+	log := logrus.WithField("test", "recorder")
+	templates, _ := notifier.NewTemplates("", "")
+	notifiers := notifier.NewRegistry(log, templates)
+	fake := &fakeNotifier{}
+	notifiers.Register("", fake)
+
+	builds := store.NewMemoryBuilds(store.Retention{})
+	builds.Create(cicd.BuildRecord{RequestID: "1", Username: "k8s-community", Repository: "cicd", Task: cicd.TaskDeploy})
+
+	r := &recorder{builds: builds, log: log, intake: newIntake(Limits{}), notifiers: notifiers}
+	r.Step("1", task.StepFetch)
+	r.Step("1", task.StepTest)
+	r.Step("1", task.StepTest)
+	r.Step("1", task.StepDeploy)
+	r.State("1", task.StateError)
+	r.FinishStage("1", task.StateError, "Deploy failed")
+
+	expected := []struct {
+		context string
+		state   string
+	}{
+		{"k8s-community/cicd/fetch", task.StatePending},
+		{"k8s-community/cicd/fetch", task.StateSuccess},
+		{"k8s-community/cicd/test", task.StatePending},
+		{"k8s-community/cicd/test", task.StateSuccess},
+		{"k8s-community/cicd/deploy", task.StatePending},
+		{"k8s-community/cicd/deploy", task.StateError},
+	}
+	if len(fake.events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), fake.events)
+	}
+	for i, e := range expected {
+		event := fake.events[i]
+		if event.Context != e.context || event.State != e.state || event.RequestID != "1" || event.Namespace != "k8s-community" {
+			t.Errorf("Event %d: expected %s %s, got %+v", i, e.context, e.state, event)
+		}
+	}
+	if fake.events[5].Description != "Deploy failed" {
+		t.Errorf("Unexpected description of the failed stage %q", fake.events[5].Description)
+	}
+
+	// builds which didn't start any step don't have stages
+	builds.Create(cicd.BuildRecord{RequestID: "2", Username: "k8s-community", Repository: "cicd", Task: cicd.TaskTest})
+	r.State("2", task.StateCancelled)
+	r.FinishStage("2", task.StateCancelled, "Cancelled while waiting for test")
+	if len(fake.events) != len(expected) {
+		t.Errorf("Unexpected events of the build without steps: %+v", fake.events[len(expected):])
+	}
+}
+
+func TestRecorderCells(t *testing.T) {
+	log := logrus.WithField("test", "recorder")
+	templates, _ := notifier.NewTemplates("", "")
+	notifiers := notifier.NewRegistry(log, templates)
+	fake := &fakeNotifier{}
+	notifiers.Register("", fake)
+
+	builds := store.NewMemoryBuilds(store.Retention{})
+	builds.Create(cicd.BuildRecord{RequestID: "m", Username: "k8s-community", Repository: "cicd", Task: cicd.TaskTest})
+	builds.Create(cicd.BuildRecord{RequestID: "m-1", Username: "k8s-community", Repository: "cicd", Task: cicd.TaskTest, Parent: "m", Cell: "go1.11"})
+
+	r := &recorder{builds: builds, log: log, intake: newIntake(Limits{}), notifiers: notifiers}
+	r.AddCell("m", cicd.BuildCell{RequestID: "m-1", Name: "go1.11", State: task.StatePending})
+	r.Step("m", task.StepMatrix)
+	r.Step("m-1", task.StepTest)
+	r.State("m-1", task.StatePending)
+	r.State("m-1", task.StateFailure)
+	r.State("m", task.StateFailure)
+
+	if len(fake.events) != 2 || fake.events[0].Context != "k8s-community/cicd/matrix" ||
+		fake.events[1].Context != "k8s-community/cicd/test (go1.11)" || fake.events[1].Cell != "go1.11" {
+		t.Errorf("Unexpected events: %+v", fake.events)
+	}
+
+	record, _ := builds.Get("m")
+	if len(record.Cells) != 1 || record.Cells[0].State != task.StateFailure {
+		t.Errorf("State of the cell isn't saved to the matrix build: %+v", record.Cells)
+	}
+
+	desc := "0 of 1 cells passed: go1.11 failed"
+	if s := r.MatrixSummary("m", desc); s != desc {
+		t.Errorf("Unexpected description of the matrix build %q", s)
+	}
+	if s := r.MatrixSummary("m-1", desc); len(s) > 0 {
+		t.Errorf("Cell isn't a matrix build, got description %q", s)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/secrets"
+	"github.com/takama/router"
+)
+
+// ListSecrets handles request of names of secrets of the namespace,
+// optional repository parameter selects secrets of the repository. Values of secrets are never returned.
+func (a *Admin) ListSecrets(c *router.Control) {
+	if !a.authorized(c) {
+		return
+	}
+
+	names := a.secrets.Names(c.Get(":namespace"), c.Get("repository"))
+	c.Code(http.StatusOK).Body(cicd.SecretsResponse{Data: names})
+}
+
+// SetSecret handles request to save the secret of the namespace or of the repository
+func (a *Admin) SetSecret(c *router.Control) {
+	if !a.authorized(c) {
+		return
+	}
+
+	req := new(cicd.SecretRequest)
+	err := json.NewDecoder(c.Request.Body).Decode(req)
+	if err != nil {
+		a.failSecrets(c, http.StatusBadRequest, "Couldn't parse request body.")
+		return
+	}
+
+	namespace, repo, name := c.Get(":namespace"), c.Get("repository"), c.Get(":name")
+	err = secrets.Validate(namespace, repo, name, req.Value)
+	if err != nil {
+		a.failSecrets(c, http.StatusBadRequest, "Secret is wrong: "+err.Error()+".")
+		return
+	}
+
+	err = a.secrets.Set(namespace, repo, name, req.Value)
+	if err != nil {
+		a.log.Errorf("Couldn't save secret %s of %s/%s: %s", name, namespace, repo, err)
+		a.failSecrets(c, http.StatusInternalServerError, "Couldn't save the secret.")
+		return
+	}
+	a.log.Infof("Secret %s of %s/%s is saved", name, namespace, repo)
+
+	c.Code(http.StatusOK).Body(cicd.SecretsResponse{Data: a.secrets.Names(namespace, repo)})
+}
+
+// DeleteSecret handles request to remove the secret of the namespace or of the repository
+func (a *Admin) DeleteSecret(c *router.Control) {
+	if !a.authorized(c) {
+		return
+	}
+
+	namespace, repo, name := c.Get(":namespace"), c.Get("repository"), c.Get(":name")
+	err := a.secrets.Delete(namespace, repo, name)
+	if err == secrets.ErrNotFound {
+		a.failSecrets(c, http.StatusNotFound, "Secret is not found.")
+		return
+	}
+	if err != nil {
+		a.log.Errorf("Couldn't remove secret %s of %s/%s: %s", name, namespace, repo, err)
+		a.failSecrets(c, http.StatusInternalServerError, "Couldn't remove the secret.")
+		return
+	}
+	a.log.Infof("Secret %s of %s/%s is removed", name, namespace, repo)
+
+	c.Code(http.StatusOK).Body(cicd.SecretsResponse{Data: a.secrets.Names(namespace, repo)})
+}
+
+func (a *Admin) failSecrets(c *router.Control, code int, message string) {
+	response := cicd.SecretsResponse{
+		Error: &cicd.Error{Code: code, Message: message},
+	}
+	c.Code(code).Body(response)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/k8s-community/cicd/builder/secrets"
+	"github.com/takama/router"
+)
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cicd-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretStore, err := secrets.NewStore(filepath.Join(dir, "secrets"), bytes.Repeat([]byte{1}, secrets.KeySize))
+	if err != nil {
+		t.Fatalf("Couldn't create store: %s", err)
+	}
+	admin := NewAdmin("token", nil, secretStore, time.Minute, logrus.WithField("test", "secrets"))
+
+	r := router.New()
+	r.GET("/api/v1/admin/secrets/:namespace", admin.ListSecrets)
+	r.PUT("/api/v1/admin/secrets/:namespace/:name", admin.SetSecret)
+	r.DELETE("/api/v1/admin/secrets/:namespace/:name", admin.DeleteSecret)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		code   int
+		names  []string
+	}{
+		{method: http.MethodPut, path: "/api/v1/admin/secrets/k8s-community/TOKEN", body: `{"value":"namespace-token"}`, code: http.StatusOK, names: []string{"TOKEN"}},
+		{method: http.MethodPut, path: "/api/v1/admin/secrets/k8s-community/PASSWORD?repository=cicd", body: `{"value":"password"}`, code: http.StatusOK, names: []string{"PASSWORD"}},
+		{method: http.MethodPut, path: "/api/v1/admin/secrets/k8s-community/1WRONG", body: `{"value":"value"}`, code: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/v1/admin/secrets/k8s-community", code: http.StatusOK, names: []string{"TOKEN"}},
+		{method: http.MethodGet, path: "/api/v1/admin/secrets/k8s-community?repository=cicd", code: http.StatusOK, names: []string{"PASSWORD"}},
+		{method: http.MethodDelete, path: "/api/v1/admin/secrets/k8s-community/TOKEN", code: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/v1/admin/secrets/k8s-community/TOKEN", code: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		request.Header.Set("Authorization", "Bearer token")
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s %s: expected code %d, got %d: %s", test.method, test.path, test.code, recorder.Code, recorder.Body)
+			continue
+		}
+		response := new(cicd.SecretsResponse)
+		err = json.NewDecoder(recorder.Body).Decode(response)
+		if err != nil {
+			t.Errorf("%s %s: couldn't parse response: %s", test.method, test.path, err)
+			continue
+		}
+		if test.code == http.StatusOK && !reflect.DeepEqual(response.Data, test.names) {
+			t.Errorf("%s %s: expected secrets %v, got %v", test.method, test.path, test.names, response.Data)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/satori/go.uuid"
+	"github.com/takama/router"
+)
+
+// maxPayloadSize is the maximal size of webhook payload which GitHub sends
+const maxPayloadSize = 25 << 20
+
+// GitHub events and actions which start builds
+const (
+	eventPing        = "ping"
+	eventPush        = "push"
+	eventPullRequest = "pull_request"
+
+	refBranchPrefix = "refs/heads/"
+	refTagPrefix    = "refs/tags/"
+	zeroCommit      = "0000000000000000000000000000000000000000"
+)
+
+// pullRequestActions are actions of pull request which change its code
+var pullRequestActions = map[string]bool{
+	"opened":      true,
+	"reopened":    true,
+	"synchronize": true,
+}
+
+// GitHubWebhook is a handler to process webhooks sent by GitHub directly
+type GitHubWebhook struct {
+	build      *Build
+	secret     []byte
+	deployTags bool // pushes of tags are deployed if true, otherwise they are tested
+	log        logrus.FieldLogger
+}
+
+// NewGitHubWebhook returns an instance of GitHubWebhook, payloads are verified by the secret of the webhook.
+// Pushes of tags are deployed only if deployTags is true.
+func NewGitHubWebhook(build *Build, secret string, deployTags bool, log logrus.FieldLogger) *GitHubWebhook {
+	return &GitHubWebhook{
+		build:      build,
+		secret:     []byte(secret),
+		deployTags: deployTags,
+		log:        log,
+	}
+}
+
+// githubRepository is a part of repository description in webhook payloads
+type githubRepository struct {
+	Name     string `json:"name"`
+	CloneURL string `json:"clone_url"` // CloneURL lets to fetch repositories of GitHub Enterprise
+	Owner    struct {
+		Login string `json:"login"`
+		Name  string `json:"name"` // Name is used instead of Login in push payloads of old webhooks
+	} `json:"owner"`
+}
+
+// owner returns login of the repository owner
+func (r githubRepository) owner() string {
+	if len(r.Owner.Login) > 0 {
+		return r.Owner.Login
+	}
+	return r.Owner.Name
+}
+
+// githubPush is a part of push event payload
+type githubPush struct {
+	Ref        string           `json:"ref"`
+	After      string           `json:"after"`
+	Deleted    bool             `json:"deleted"`
+	Repository githubRepository `json:"repository"`
+}
+
+// githubPullRequest is a part of pull_request event payload
+type githubPullRequest struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Repo githubRepository `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// Handle verifies the payload and starts a build for it.
+// Pushes to branches and pull requests are tested, pushes of tags are tested or deployed with version of the tag.
+func (h *GitHubWebhook) Handle(c *router.Control) {
+	event := c.Request.Header.Get("X-GitHub-Event")
+	logger := h.log.WithFields(logrus.Fields{
+		"event":    event,
+		"delivery": c.Request.Header.Get("X-GitHub-Delivery"),
+	})
+	logger.Infof("Processing webhook...")
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPayloadSize))
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "Couldn't read request body.")
+		return
+	}
+
+	if !h.verify(body, c.Request.Header.Get("X-Hub-Signature-256")) {
+		logger.Errorf("Signature of the webhook is wrong")
+		h.fail(c, http.StatusUnauthorized, "Signature of the payload is wrong.")
+		return
+	}
+
+	payload, err := webhookPayload(c.Request.Header.Get("Content-Type"), body)
+	if err != nil {
+		h.fail(c, http.StatusBadRequest, "Couldn't parse form of the payload.")
+		return
+	}
+
+	var req *cicd.BuildRequest
+	switch event {
+	case eventPing:
+		c.Code(http.StatusOK).Body("pong")
+		return
+	case eventPush:
+		req, err = pushRequest(payload, h.deployTags)
+	case eventPullRequest:
+		req, err = pullRequestRequest(payload)
+	}
+	if err != nil {
+		logger.Errorf("Couldn't parse payload: %s", err)
+		h.fail(c, http.StatusBadRequest, "Couldn't parse payload.")
+		return
+	}
+	if req == nil {
+		logger.Infof("Event is ignored")
+		c.Code(http.StatusOK).Body("Event is ignored.")
+		return
+	}
+
+	if len(req.Username) == 0 || len(req.Repository) == 0 || len(req.CommitHash) == 0 {
+		h.fail(c, http.StatusBadRequest, "Payload doesn't contain repository or commit.")
+		return
+	}
+	if len(req.RepositoryURL) > 0 && !validRepositoryURL(req.RepositoryURL) {
+		h.fail(c, http.StatusBadRequest, "Clone URL of the repository is wrong.")
+		return
+	}
+
+	requestID := uuid.NewV4().String()
+	logger.WithField("requestID", requestID).Infof("Starting %s of %s/%s at %s", req.Task, req.Username, req.Repository, req.CommitHash)
+	err = h.build.enqueue(req, requestID)
+	if err != nil {
+		logger.Infof("Build is rejected: %s", err)
+		reject(c, err)
+		return
+	}
+
+	data := &cicd.Build{RequestID: requestID}
+	response := cicd.BuildResponse{Data: data}
+	c.Code(http.StatusCreated).Body(response)
+}
+
+// verify checks HMAC of the payload, the signature has form "sha256=<hex digest>"
+func (h *GitHubWebhook) verify(body []byte, signature string) bool {
+	if len(h.secret) == 0 || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func (h *GitHubWebhook) fail(c *router.Control, code int, message string) {
+	response := cicd.BuildResponse{
+		Error: &cicd.Error{Code: code, Message: message},
+	}
+	c.Code(code).Body(response)
+}
+
+// webhookPayload returns JSON payload, GitHub sends it in the payload field if the form content type is chosen
+func webhookPayload(contentType string, body []byte) ([]byte, error) {
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return body, nil
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(form.Get("payload")), nil
+}
+
+// pushRequest maps push payload to the build request, nil request means what the push doesn't need a build.
+// Tags are deployed if deployTags is true, otherwise they are tested.
+func pushRequest(payload []byte, deployTags bool) (*cicd.BuildRequest, error) {
+	push := githubPush{}
+	err := json.Unmarshal(payload, &push)
+	if err != nil {
+		return nil, err
+	}
+
+	if push.Deleted || push.After == zeroCommit || len(push.After) == 0 {
+		return nil, nil
+	}
+
+	req := &cicd.BuildRequest{
+		Username:   push.Repository.owner(),
+		Repository: push.Repository.Name,
+		CommitHash: push.After,
+
+		RepositoryURL: push.Repository.CloneURL,
+	}
+
+	switch {
+	case strings.HasPrefix(push.Ref, refBranchPrefix):
+		req.Task = cicd.TaskTest
+		req.Branch = strings.TrimPrefix(push.Ref, refBranchPrefix)
+	case strings.HasPrefix(push.Ref, refTagPrefix):
+		version := strings.TrimPrefix(push.Ref, refTagPrefix)
+		req.Task = cicd.TaskTest
+		if deployTags {
+			req.Task = cicd.TaskDeploy
+		}
+		req.Version = &version
+	default:
+		return nil, nil
+	}
+
+	return req, nil
+}
+
+// pullRequestRequest maps pull_request payload to the build request, nil request means what the action doesn't need a build
+func pullRequestRequest(payload []byte) (*cicd.BuildRequest, error) {
+	pr := githubPullRequest{}
+	err := json.Unmarshal(payload, &pr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !pullRequestActions[pr.Action] {
+		return nil, nil
+	}
+
+	return &cicd.BuildRequest{
+		Username:   pr.PullRequest.Base.Repo.owner(),
+		Repository: pr.PullRequest.Base.Repo.Name,
+		CommitHash: pr.PullRequest.Head.SHA,
+		Task:       cicd.TaskTest,
+
+		RepositoryURL: pr.PullRequest.Base.Repo.CloneURL,
+		Branch:        "refs/pull/" + strconv.Itoa(pr.Number) + "/head",
+	}, nil
+}
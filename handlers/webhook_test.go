@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd"
+	"github.com/takama/router"
+)
+
+func TestWebhookVerify(t *testing.T) {
+	webhook := NewGitHubWebhook(nil, "secret", false, logrus.WithField("test", "webhook"))
+	body := []byte(`{"zen":"Keep it logically awesome."}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !webhook.verify(body, signature) {
+		t.Errorf("Valid signature was rejected")
+	}
+
+	for _, wrong := range []string{"", "sha256=", "sha1=" + signature[7:], signature[:len(signature)-2] + "00", "sha256=zz"} {
+		if webhook.verify(body, wrong) {
+			t.Errorf("Wrong signature %q was accepted", wrong)
+		}
+	}
+
+	if NewGitHubWebhook(nil, "", false, nil).verify(body, signature) {
+		t.Errorf("Signature has to be rejected without a secret")
+	}
+}
+
+func TestPushRequest(t *testing.T) {
+	tests := []struct {
+		payload    string
+		deployTags bool
+		task       string
+		version    string
+		branch     string
+	}{
+		{
+			payload: `{"ref":"refs/heads/master","after":"abc","repository":{"name":"cicd","owner":{"name":"k8s-community"}}}`,
+			task:    cicd.TaskTest,
+			branch:  "master",
+		},
+		{
+			payload: `{"ref":"refs/tags/v1.0.0","after":"abc","repository":{"name":"cicd","owner":{"login":"k8s-community"}}}`,
+			task:    cicd.TaskTest,
+			version: "v1.0.0",
+		},
+		{
+			payload:    `{"ref":"refs/tags/v1.0.0","after":"abc","repository":{"name":"cicd","owner":{"login":"k8s-community"}}}`,
+			deployTags: true,
+			task:       cicd.TaskDeploy,
+			version:    "v1.0.0",
+		},
+		{payload: `{"ref":"refs/heads/master","after":"` + zeroCommit + `","deleted":true}`},
+	}
+
+	for _, test := range tests {
+		req, err := pushRequest([]byte(test.payload), test.deployTags)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if len(test.task) == 0 {
+			if req != nil {
+				t.Errorf("Expected ignored push, got %+v", req)
+			}
+			continue
+		}
+
+		if req == nil || req.Task != test.task || req.Username != "k8s-community" || req.Repository != "cicd" || req.CommitHash != "abc" {
+			t.Fatalf("Unexpected request %+v for %s", req, test.payload)
+		}
+
+		if len(test.version) > 0 && (req.Version == nil || *req.Version != test.version) {
+			t.Errorf("Expected version %s, got %v", test.version, req.Version)
+		}
+
+		if req.Branch != test.branch {
+			t.Errorf("Expected branch %q, got %q", test.branch, req.Branch)
+		}
+	}
+}
+
+func TestPullRequestRequest(t *testing.T) {
+	payload := `{"action":"synchronize","number":7,"pull_request":{"head":{"sha":"abc"},"base":{"repo":{"name":"cicd","owner":{"login":"k8s-community"}}}}}`
+
+	req, err := pullRequestRequest([]byte(payload))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if req == nil || req.Task != cicd.TaskTest || req.Username != "k8s-community" || req.Repository != "cicd" || req.CommitHash != "abc" || req.Branch != "refs/pull/7/head" {
+		t.Errorf("Unexpected request %+v", req)
+	}
+
+	req, err = pullRequestRequest([]byte(`{"action":"closed"}`))
+	if err != nil || req != nil {
+		t.Errorf("Closed pull request has to be ignored, got %+v, %v", req, err)
+	}
+}
+
+func TestWebhookHandle(t *testing.T) {
+	build, tasks, stop := prepareBuild(t)
+	defer stop()
+	webhook := NewGitHubWebhook(build, "secret", false, logrus.WithField("test", "webhook"))
+
+	r := router.New()
+	r.POST("/api/v1/webhook/github", webhook.Handle)
+
+	tests := []struct {
+		event   string
+		payload string
+		task    string
+		branch  string
+		trusted bool
+	}{
+		{
+			event:   eventPush,
+			payload: `{"ref":"refs/heads/master","after":"abc","repository":{"name":"cicd","owner":{"login":"k8s-community"}}}`,
+			task:    cicd.TaskTest,
+			branch:  "master",
+			trusted: true,
+		},
+		{
+			event:   eventPullRequest,
+			payload: `{"action":"opened","number":7,"pull_request":{"head":{"sha":"def"},"base":{"repo":{"name":"cicd","owner":{"login":"k8s-community"}}}}}`,
+			task:    cicd.TaskTest,
+			branch:  "refs/pull/7/head",
+		},
+	}
+
+	for _, test := range tests {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(test.payload))
+
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/webhook/github", strings.NewReader(test.payload))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-GitHub-Event", test.event)
+		request.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("Event %s: expected code %d, got %d: %s", test.event, http.StatusCreated, recorder.Code, recorder.Body)
+		}
+		response := new(cicd.BuildResponse)
+		json.NewDecoder(recorder.Body).Decode(response)
+
+		select {
+		case taskItem := <-tasks:
+			if taskItem.ID != response.Data.RequestID || taskItem.Type != test.task || taskItem.Branch != test.branch ||
+				taskItem.Trusted != test.trusted || taskItem.Namespace != "k8s-community" || taskItem.Repo != "cicd" {
+				t.Errorf("Event %s: unexpected task %+v", test.event, taskItem)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Event %s: build wasn't started", test.event)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/webhook/github", strings.NewReader(tests[0].payload))
+	request.Header.Set("X-GitHub-Event", eventPush)
+	request.Header.Set("X-Hub-Signature-256", "sha256=00")
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected code %d for the wrong signature, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -0,0 +1,248 @@
+// Package metrics collects metrics of the service and exposes them in Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is a content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DurationBuckets are upper bounds (in seconds) of histogram buckets suitable for durations of builds
+var DurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// DefaultRegistry keeps metrics of all packages of the service
+var DefaultRegistry = NewRegistry()
+
+// Registry keeps metrics to write them in Prometheus text format
+type Registry struct {
+	mx       *sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{mx: &sync.Mutex{}}
+}
+
+// NewCounter registers a counter, values of the labels have to be passed in the same order to its methods
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", labels, nil)}
+}
+
+// NewGauge registers a gauge, values of the labels have to be passed in the same order to its methods
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", labels, nil)}
+}
+
+// NewHistogram registers a histogram with upper bounds of buckets sorted in increasing order,
+// values of the labels have to be passed in the same order to its methods
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(name, help, "histogram", labels, buckets)}
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		mx:      &sync.Mutex{},
+		series:  make(map[string]*series),
+	}
+
+	r.mx.Lock()
+	r.families = append(r.families, f)
+	r.mx.Unlock()
+
+	return f
+}
+
+// Write writes all metrics in Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mx.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mx.Unlock()
+
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	buf := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(buf)
+	}
+	return buf.Flush()
+}
+
+// Counter is a metric which only grows
+type Counter struct {
+	family *family
+}
+
+// Inc increases the counter by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by the positive value
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.family.update(labelValues, func(s *series) {
+		s.value += value
+	})
+}
+
+// Gauge is a metric which might go up and down
+type Gauge struct {
+	family *family
+}
+
+// Set sets the value of the gauge
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *series) {
+		s.value = value
+	})
+}
+
+// Add changes the value of the gauge by the value, it might be negative
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.family.update(labelValues, func(s *series) {
+		s.value += value
+	})
+}
+
+// Histogram counts observed values in buckets
+type Histogram struct {
+	family *family
+}
+
+// Observe adds the value to the histogram
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.family.update(labelValues, func(s *series) {
+		for i, bound := range h.family.buckets {
+			if value <= bound {
+				s.buckets[i]++
+			}
+		}
+		s.count++
+		s.sum += value
+	})
+}
+
+// family is a metric with all its series
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mx     *sync.Mutex
+	series map[string]*series
+}
+
+// series is a value of the metric with the values of labels
+type series struct {
+	labelValues []string
+	value       float64
+
+	buckets []uint64 // cumulative counts of observations in buckets of histograms
+	count   uint64
+	sum     float64
+}
+
+func (f *family) update(labelValues []string, update func(s *series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", f.name, len(f.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.kind == "histogram" {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	update(s)
+}
+
+func (f *family) write(w io.Writer) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(s.labelValues, ""), formatFloat(s.value))
+			continue
+		}
+
+		for i, bound := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s.labelValues, formatFloat(bound)), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelPairs(s.labelValues, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelPairs(s.labelValues, ""), s.count)
+	}
+}
+
+// labelPairs formats labels of the series, le label of histogram buckets is added if it isn't empty
+func (f *family) labelPairs(labelValues []string, le string) string {
+	var pairs []string
+	for i, label := range f.labels {
+		pairs = append(pairs, label+`="`+escape(labelValues[i], true)+`"`)
+	}
+	if len(le) > 0 {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quote bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quote {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	registry := NewRegistry()
+
+	builds := registry.NewCounter("builds_total", "Number of builds", "type", "state")
+	builds.Inc("test", "success")
+	builds.Add(2, "test", "success")
+	builds.Inc("deploy", `fail"ed`)
+
+	queue := registry.NewGauge("queue_tasks", "Number of tasks")
+	queue.Set(5)
+	queue.Add(-2)
+
+	duration := registry.NewHistogram("duration_seconds", "Duration\nof builds", []float64{1, 10}, "type")
+	duration.Observe(0.5, "test")
+	duration.Observe(5, "test")
+	duration.Observe(50, "test")
+
+	buf := &bytes.Buffer{}
+	err := registry.Write(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := `# HELP builds_total Number of builds
+# TYPE builds_total counter
+builds_total{type="deploy",state="fail\"ed"} 1
+builds_total{type="test",state="success"} 3
+# HELP duration_seconds Duration\nof builds
+# TYPE duration_seconds histogram
+duration_seconds_bucket{type="test",le="1"} 1
+duration_seconds_bucket{type="test",le="10"} 2
+duration_seconds_bucket{type="test",le="+Inf"} 3
+duration_seconds_sum{type="test"} 55.5
+duration_seconds_count{type="test"} 3
+# HELP queue_tasks Number of tasks
+# TYPE queue_tasks gauge
+queue_tasks 3
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
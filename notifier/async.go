@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"errors"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// errQueueFull means what the event is dropped because the notifier doesn't keep up with events
+var errQueueFull = errors.New("queue of events is full, the event is dropped")
+
+// Async delivers events to the notifier in the background in order of their arrival,
+// so slow receivers don't hold builds. Failures of delivery are logged.
+type Async struct {
+	notifier Notifier
+	queue    chan Event
+	log      logrus.FieldLogger
+}
+
+// NewAsync returns an instance of Async which keeps up to size events waiting for delivery
+func NewAsync(n Notifier, size int, log logrus.FieldLogger) *Async {
+	a := &Async{
+		notifier: n,
+		queue:    make(chan Event, size),
+		log:      log,
+	}
+	go a.deliver()
+
+	return a
+}
+
+// Notify adds the event to the queue, it returns an error if the queue is full
+func (a *Async) Notify(event Event) error {
+	select {
+	case a.queue <- event:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (a *Async) deliver() {
+	for event := range a.queue {
+		err := a.notifier.Notify(event)
+		if err != nil {
+			notificationFailures.Inc()
+			a.log.WithFields(logrus.Fields{"requestID": event.RequestID, "state": event.State}).Errorf("Couldn't send notification: %s", err)
+		}
+	}
+}
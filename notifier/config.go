@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Types of notifiers in the configuration file
+const (
+	TypeGitHubIntegration = "github-integration"
+	TypeWebhook           = "webhook"
+)
+
+// Config describes a notifier in the configuration file
+type Config struct {
+	Type   string `json:"type"`
+	URL    string `json:"url,omitempty"`    // URL is used by webhooks only
+	Secret string `json:"secret,omitempty"` // Secret is used by webhooks only
+}
+
+// New returns a notifier described by the config, github is shared by all namespaces which use github-integration.
+// Webhooks deliver events in the background, their failures are logged.
+func New(config Config, github *GitHubIntegration, log logrus.FieldLogger) (Notifier, error) {
+	switch config.Type {
+	case TypeGitHubIntegration:
+		if github == nil {
+			return nil, fmt.Errorf("github-integration client is not configured")
+		}
+		return github, nil
+	case TypeWebhook:
+		if len(config.URL) == 0 {
+			return nil, fmt.Errorf("URL of the webhook is required")
+		}
+		return NewAsync(NewWebhook(nil, config.URL, config.Secret), WebhookQueueSize, log), nil
+	}
+
+	return nil, fmt.Errorf("unknown notifier type %q", config.Type)
+}
+
+// Load registers notifiers of namespaces from the JSON file, for example:
+//
+//	{
+//	  "k8s-community": [{"type": "github-integration"}],
+//	  "team": [{"type": "webhook", "url": "https://example.com/hook", "secret": "..."}]
+//	}
+func (r *Registry) Load(path string, github *GitHubIntegration) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var namespaces map[string][]Config
+	err = json.Unmarshal(data, &namespaces)
+	if err != nil {
+		return fmt.Errorf("couldn't parse notifiers file %s: %s", path, err)
+	}
+
+	for namespace, configs := range namespaces {
+		if len(namespace) == 0 {
+			return fmt.Errorf("namespace of notifiers couldn't be empty")
+		}
+
+		var notifiers []Notifier
+		for _, config := range configs {
+			n, err := New(config, github, r.log.WithField("namespace", namespace))
+			if err != nil {
+				return fmt.Errorf("wrong notifier of namespace %s: %s", namespace, err)
+			}
+			notifiers = append(notifiers, n)
+		}
+		r.Register(namespace, notifiers...)
+	}
+
+	return nil
+}
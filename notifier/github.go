@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"github.com/k8s-community/cicd/builder/task"
+	ghIntegr "github.com/k8s-community/github-integration/client"
+)
+
+// GitHubIntegration sends commit statuses and build results to the github-integration service
+type GitHubIntegration struct {
+	client *ghIntegr.Client
+}
+
+// NewGitHubIntegration returns an instance of GitHubIntegration
+func NewGitHubIntegration(client *ghIntegr.Client) *GitHubIntegration {
+	return &GitHubIntegration{client: client}
+}
+
+// Notify updates the commit status, results are sent for finished builds only (not for their stages)
+func (g *GitHubIntegration) Notify(event Event) error {
+	callbackData := ghIntegr.BuildCallback{
+		Username:    event.Username,
+		Repository:  event.Repository,
+		CommitHash:  event.CommitHash,
+		State:       githubState(event.State),
+		BuildURL:    event.BuildURL,
+		Description: event.Description,
+		Context:     event.Context,
+	}
+	err := g.client.Build.BuildCallback(callbackData)
+	if err != nil {
+		return err
+	}
+
+	// results are reported once for the whole build, the matrix build reports the combined state of its cells
+	if event.State == task.StatePending || len(event.Stage) > 0 || len(event.Cell) > 0 {
+		return nil
+	}
+
+	resultsData := &ghIntegr.BuildResults{
+		UUID:       event.RequestID,
+		Username:   event.Username,
+		Repository: event.Repository,
+		CommitHash: event.CommitHash,
+		Passed:     event.State == task.StateSuccess,
+		Log:        event.Log,
+	}
+	return g.client.Build.BuildResults(resultsData)
+}
+
+// githubState maps state of the task to the commit status state.
+// GitHub doesn't know about timeouts and cancellations, so they are reported as failures and errors.
+func githubState(state string) string {
+	switch state {
+	case task.StateTimeout:
+		return ghIntegr.StateFailure
+	case task.StateCancelled:
+		return ghIntegr.StateError
+	}
+	return state
+}
@@ -0,0 +1,181 @@
+// Package notifier reports state transitions of builds to external systems
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/metrics"
+)
+
+var (
+	notifications = metrics.DefaultRegistry.NewCounter(
+		"cicd_notifications_total", "Number of notifications about states of builds sent to notifiers",
+	)
+	notificationFailures = metrics.DefaultRegistry.NewCounter(
+		"cicd_notification_failures_total", "Number of notifications about states of builds which weren't delivered",
+	)
+)
+
+const (
+	// DefaultBuildURL is a default template of URL of the page with build details
+	DefaultBuildURL = "https://ui.k8s.community/builds/{{.RequestID}}"
+
+	// DefaultContext is a default template of the commit status context,
+	// every stage of the build has a context of its own and the whole build has a context of its task under build/,
+	// so the build never overwrites the status of its stage, every cell of the matrix build has contexts of its own
+	DefaultContext = "k8s-community/cicd/{{if .Stage}}{{.Stage}}{{else}}build/{{.Task}}{{end}}{{if .Cell}} ({{.Cell}}){{end}}"
+)
+
+// Event describes a state transition of the build
+type Event struct {
+	RequestID  string `json:"requestID"`
+	Namespace  string `json:"namespace"`
+	Username   string `json:"username"`
+	Repository string `json:"repository"`
+	CommitHash string `json:"commitHash"`
+	Task       string `json:"task"`
+	Version    string `json:"version,omitempty"`
+
+	// Stage is a step of the build which the event is about, e.g. fetch or test, it is empty for events of the whole build
+	Stage string `json:"stage,omitempty"`
+
+	// Cell is a name of the cell of the matrix build which the event is about, e.g. go1.11 linux/arm64
+	Cell string `json:"cell,omitempty"`
+
+	State       string `json:"state"`       // State is a state of the task, see builder/task
+	Description string `json:"description"` // Description is a short human readable description of the state
+	Log         string `json:"log"`         // Log is an output of the build collected so far
+
+	BuildURL string `json:"buildURL"` // BuildURL is filled by the registry from the template
+	Context  string `json:"context"`  // Context is filled by the registry from the template
+}
+
+// Notifier sends events to an external system
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// Templates produce build URL and status context of events
+type Templates struct {
+	buildURL *template.Template
+	context  *template.Template
+}
+
+// NewTemplates parses templates of build URL and status context, fields of Event are available in templates.
+// Default templates are used for empty strings.
+func NewTemplates(buildURL, context string) (*Templates, error) {
+	if len(buildURL) == 0 {
+		buildURL = DefaultBuildURL
+	}
+	if len(context) == 0 {
+		context = DefaultContext
+	}
+
+	urlTemplate, err := template.New("buildURL").Option("missingkey=error").Parse(buildURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse build URL template: %s", err)
+	}
+
+	contextTemplate, err := template.New("context").Option("missingkey=error").Parse(context)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse context template: %s", err)
+	}
+
+	return &Templates{buildURL: urlTemplate, context: contextTemplate}, nil
+}
+
+// Apply fills build URL and status context of the event
+func (t *Templates) Apply(event *Event) error {
+	buildURL, err := execute(t.buildURL, event)
+	if err != nil {
+		return err
+	}
+
+	context, err := execute(t.context, event)
+	if err != nil {
+		return err
+	}
+
+	event.BuildURL = buildURL
+	event.Context = context
+	return nil
+}
+
+func execute(t *template.Template, event *Event) (string, error) {
+	var buf bytes.Buffer
+	err := t.Execute(&buf, event)
+	if err != nil {
+		return "", fmt.Errorf("couldn't execute %s template: %s", t.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// Registry keeps notifiers of the service and of namespaces
+type Registry struct {
+	log       logrus.FieldLogger
+	templates *Templates
+
+	mx         *sync.RWMutex
+	service    []Notifier
+	namespaces map[string][]Notifier
+}
+
+// NewRegistry returns an empty registry, templates are applied to every event
+func NewRegistry(log logrus.FieldLogger, templates *Templates) *Registry {
+	return &Registry{
+		log:        log,
+		templates:  templates,
+		mx:         &sync.RWMutex{},
+		namespaces: make(map[string][]Notifier),
+	}
+}
+
+// Register adds notifiers of the namespace, empty namespace means notifiers of the whole service.
+// Builds of a namespace which has its own notifiers aren't reported to notifiers of the service.
+func (r *Registry) Register(namespace string, notifiers ...Notifier) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if len(namespace) == 0 {
+		r.service = append(r.service, notifiers...)
+		return
+	}
+
+	namespace = strings.ToLower(namespace)
+	r.namespaces[namespace] = append(r.namespaces[namespace], notifiers...)
+}
+
+// For returns notifiers of the namespace
+func (r *Registry) For(namespace string) []Notifier {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	if notifiers, ok := r.namespaces[strings.ToLower(namespace)]; ok {
+		return notifiers
+	}
+	return r.service
+}
+
+// Notify sends the event to all notifiers of its namespace, failures are logged and don't stop other notifiers
+func (r *Registry) Notify(event Event) {
+	logger := r.log.WithFields(logrus.Fields{"requestID": event.RequestID, "state": event.State})
+
+	err := r.templates.Apply(&event)
+	if err != nil {
+		logger.Errorf("Couldn't prepare event: %s", err)
+	}
+
+	for _, n := range r.For(event.Namespace) {
+		notifications.Inc()
+		err := n.Notify(event)
+		if err != nil {
+			notificationFailures.Inc()
+			logger.Errorf("Couldn't send notification: %s", err)
+		}
+	}
+}
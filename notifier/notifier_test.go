@@ -0,0 +1,227 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/k8s-community/cicd/builder/task"
+)
+
+// fakeNotifier collects received events
+type fakeNotifier struct {
+	events []Event
+}
+
+func (f *fakeNotifier) Notify(event Event) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestTemplates(t *testing.T) {
+	templates, err := NewTemplates("https://ci.example.com/{{.Namespace}}/{{.RequestID}}", "ci/{{.Task}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	event := Event{RequestID: "ID", Namespace: "k8s-community", Task: "deploy"}
+	err = templates.Apply(&event)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if event.BuildURL != "https://ci.example.com/k8s-community/ID" || event.Context != "ci/deploy" {
+		t.Errorf("Unexpected build URL %s or context %s", event.BuildURL, event.Context)
+	}
+
+	_, err = NewTemplates("{{.RequestID", "")
+	if err == nil {
+		t.Errorf("Expected error for wrong template")
+	}
+
+	templates, err = NewTemplates("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	templates.Apply(&event)
+	if event.BuildURL != "https://ui.k8s.community/builds/ID" || event.Context != "k8s-community/cicd/build/deploy" {
+		t.Errorf("Unexpected default build URL %s or context %s", event.BuildURL, event.Context)
+	}
+
+	event.Stage = "test"
+	templates.Apply(&event)
+	if event.Context != "k8s-community/cicd/test" {
+		t.Errorf("Unexpected default context of the stage %s", event.Context)
+	}
+
+	event.Cell = "go1.11 linux/arm64"
+	templates.Apply(&event)
+	if event.Context != "k8s-community/cicd/test (go1.11 linux/arm64)" {
+		t.Errorf("Unexpected default context of the cell %s", event.Context)
+	}
+}
+
+func TestDefaultContextCollision(t *testing.T) {
+	templates, err := NewTemplates("", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	tasks := []string{task.TypeTest, task.TypeBuild, task.TypeDeploy}
+	stages := []string{
+		task.StepFetch, task.StepCheckout, task.StepPrepare, task.StepTest, task.StepDeploy, task.StepCoverage, task.StepMatrix,
+		"build", "lint",
+	}
+
+	builds := make(map[string]bool)
+	for _, cell := range []string{"", "go1.11"} {
+		for _, taskType := range tasks {
+			event := Event{RequestID: "ID", Task: taskType, Cell: cell}
+			templates.Apply(&event)
+			builds[event.Context] = true
+		}
+	}
+
+	for _, cell := range []string{"", "go1.11"} {
+		for _, taskType := range tasks {
+			for _, stage := range stages {
+				event := Event{RequestID: "ID", Task: taskType, Stage: stage, Cell: cell}
+				templates.Apply(&event)
+				if builds[event.Context] {
+					t.Errorf("Stage %s of the %s build has the context of the whole build: %s", stage, taskType, event.Context)
+				}
+			}
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	templates, _ := NewTemplates("", "")
+	registry := NewRegistry(logrus.WithField("test", "notifier"), templates)
+
+	service, team, silent := &fakeNotifier{}, &fakeNotifier{}, &fakeNotifier{}
+	registry.Register("", service)
+	registry.Register("Team", team)
+	registry.Register("silent")
+
+	registry.Notify(Event{RequestID: "1", Namespace: "k8s-community"})
+	registry.Notify(Event{RequestID: "2", Namespace: "team"})
+	registry.Notify(Event{RequestID: "3", Namespace: "silent"})
+
+	if len(service.events) != 1 || service.events[0].RequestID != "1" {
+		t.Errorf("Unexpected events of the service: %+v", service.events)
+	}
+	if len(team.events) != 1 || team.events[0].RequestID != "2" {
+		t.Errorf("Unexpected events of the namespace: %+v", team.events)
+	}
+	if len(silent.events) != 0 {
+		t.Errorf("Namespace without notifiers received events: %+v", silent.events)
+	}
+	if service.events[0].BuildURL != "https://ui.k8s.community/builds/1" {
+		t.Errorf("Templates were not applied: %+v", service.events[0])
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var received Event
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+		if r.Header.Get("X-CICD-Signature-256") != signature {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	err := NewWebhook(nil, server.URL, "secret").Notify(Event{RequestID: "ID", State: "success"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if received.RequestID != "ID" || received.State != "success" {
+		t.Errorf("Unexpected event %+v", received)
+	}
+
+	err = NewWebhook(nil, server.URL, "wrong").Notify(Event{RequestID: "ID"})
+	if err == nil {
+		t.Errorf("Expected error for wrong status")
+	}
+}
+
+// blockingNotifier sends received events to the channel
+type blockingNotifier chan Event
+
+func (b blockingNotifier) Notify(event Event) error {
+	b <- event
+	return nil
+}
+
+func TestAsync(t *testing.T) {
+	received := make(blockingNotifier)
+	async := NewAsync(received, 1, logrus.WithField("test", "notifier"))
+
+	// the first event is being delivered, the second one waits in the queue
+	for _, id := range []string{"1", "2"} {
+		if err := async.Notify(Event{RequestID: id}); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if id == "1" {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if err := async.Notify(Event{RequestID: "3"}); err != errQueueFull {
+		t.Errorf("Expected error of the full queue, got %v", err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		select {
+		case event := <-received:
+			if event.RequestID != id {
+				t.Errorf("Expected event %s, got %s", id, event.RequestID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Event %s wasn't delivered", id)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifiers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "notifiers.json")
+	ioutil.WriteFile(path, []byte(`{"team": [{"type": "webhook", "url": "http://localhost/hook"}]}`), 0644)
+
+	templates, _ := NewTemplates("", "")
+	registry := NewRegistry(logrus.WithField("test", "notifier"), templates)
+	err = registry.Load(path, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(registry.For("team")) != 1 {
+		t.Errorf("Notifier of the namespace was not registered")
+	}
+
+	ioutil.WriteFile(path, []byte(`{"team": [{"type": "github-integration"}]}`), 0644)
+	err = registry.Load(path, nil)
+	if err == nil {
+		t.Errorf("Expected error for github-integration without client")
+	}
+}
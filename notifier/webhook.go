@@ -0,0 +1,74 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// webhookTimeout limits delivery of the event by the default client of webhooks
+	webhookTimeout = 10 * time.Second
+
+	// WebhookQueueSize is a number of events waiting for delivery to the webhook, newer events are dropped
+	WebhookQueueSize = 100
+)
+
+// Webhook posts events as JSON to the URL
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhook returns an instance of Webhook.
+// If the secret isn't empty, the body is signed by HMAC SHA-256 in the X-CICD-Signature-256 header.
+// If a nil httpClient is provided, a client with 10 seconds timeout will be used.
+func NewWebhook(httpClient *http.Client, url, secret string) *Webhook {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: webhookTimeout}
+	}
+
+	return &Webhook{
+		url:    url,
+		secret: []byte(secret),
+		client: httpClient,
+	}
+}
+
+// Notify posts the event, any status except 2xx is an error
+func (w *Webhook) Notify(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set("X-CICD-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't send webhook to %s: %s", w.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", w.url, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cicd
+
+const (
+	// TestPass is a result of passed tests and packages
+	TestPass = "pass"
+
+	// TestFail is a result of failed tests and packages
+	TestFail = "fail"
+
+	// TestSkip is a result of skipped tests and packages without tests
+	TestSkip = "skip"
+)
+
+// TestReport contains results of tests of the build parsed from `go test -json` output
+type TestReport struct {
+	Passed  int     `json:"passed"`  // Passed is a number of passed tests
+	Failed  int     `json:"failed"`  // Failed is a number of failed tests
+	Skipped int     `json:"skipped"` // Skipped is a number of skipped tests
+	Elapsed float64 `json:"elapsed"` // Elapsed is a total duration of packages in seconds
+
+	Packages []TestPackage `json:"packages"`
+}
+
+// TestPackage contains results of tests of the package
+type TestPackage struct {
+	Name    string     `json:"name"`
+	Result  string     `json:"result"`  // Result is pass, fail or skip
+	Elapsed float64    `json:"elapsed"` // Elapsed is a duration of the package in seconds
+	Tests   []TestCase `json:"tests,omitempty"`
+
+	// Output is the output of the failed package which doesn't belong to its tests, e.g. build errors
+	Output string `json:"output,omitempty"`
+}
+
+// TestCase contains result of the test, subtests are named as "TestParent/subtest"
+type TestCase struct {
+	Name    string  `json:"name"`
+	Result  string  `json:"result"`  // Result is pass, fail or skip
+	Elapsed float64 `json:"elapsed"` // Elapsed is a duration of the test in seconds
+
+	// Output is kept only for failed and skipped tests, it contains the failure message or the reason of the skip
+	Output string `json:"output,omitempty"`
+}
+
+// TestsResponse defines response body of GetTests API method
+type TestsResponse struct {
+	Error *Error      `json:"error,omitempty"`
+	Data  *TestReport `json:"data,omitempty"`
+}
+
+// Coverage contains coverage of the code by tests of the build, percents are in range 0-100
+type Coverage struct {
+	Total      float64 `json:"total"`      // Total is a percent of covered statements of all packages
+	Statements int     `json:"statements"` // Statements is a number of statements of all packages
+	Covered    int     `json:"covered"`    // Covered is a number of statements executed by tests
+
+	Packages []PackageCoverage `json:"packages,omitempty"`
+
+	// Base is coverage of the last successful build of the base branch, Delta is a difference with it
+	Base  *CoverageBase `json:"base,omitempty"`
+	Delta *float64      `json:"delta,omitempty"`
+
+	// Warnings describe violated thresholds of coverage if they don't fail the build
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PackageCoverage contains coverage of the package
+type PackageCoverage struct {
+	Name       string  `json:"name"`
+	Total      float64 `json:"total"`
+	Statements int     `json:"statements"`
+	Covered    int     `json:"covered"`
+}
+
+// CoverageBase describes coverage of the build which others are compared with
+type CoverageBase struct {
+	Branch    string  `json:"branch"`
+	RequestID string  `json:"requestID"`
+	Total     float64 `json:"total"`
+}
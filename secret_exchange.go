@@ -0,0 +1,12 @@
+package cicd
+
+// SecretRequest defines request body of SetSecret API method
+type SecretRequest struct {
+	Value string `json:"value"`
+}
+
+// SecretsResponse defines response body of GetSecrets API method, it contains only names of secrets
+type SecretsResponse struct {
+	Error *Error   `json:"error,omitempty"`
+	Data  []string `json:"data,omitempty"`
+}
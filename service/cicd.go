@@ -1,19 +1,29 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/k8s-community/cicd/builder"
+	"github.com/k8s-community/cicd/builder/coverage"
 	"github.com/k8s-community/cicd/builder/runners"
+	"github.com/k8s-community/cicd/builder/secrets"
+	"github.com/k8s-community/cicd/builder/source"
+	"github.com/k8s-community/cicd/builder/store"
 	"github.com/k8s-community/cicd/handlers"
+	"github.com/k8s-community/cicd/metrics"
+	"github.com/k8s-community/cicd/notifier"
 	"github.com/k8s-community/cicd/version"
 	ghIntegr "github.com/k8s-community/github-integration/client"
 	"github.com/octago/sflags/gen/gflag"
@@ -32,11 +42,78 @@ type HTTPConfig struct {
 type Config struct {
 	SERVICE         HTTPConfig
 	GHIntegrBaseURL string `flag:"githubint-base-url"`
+	WebhookSecret   string `flag:"github-webhook-secret" desc:"Secret of GitHub webhooks, the webhook route is disabled if empty"`
+	WebhookDeploy   bool   `flag:"github-webhook-deploy-tags" desc:"Deploy pushed tags of GitHub webhooks, they are only tested if false"`
+	AdminToken      string `flag:"admin-token" desc:"Bearer token of admin requests, admin routes are disabled if empty"`
+
+	DrainTimeout time.Duration `flag:"drain-timeout" desc:"Time to wait for running builds on shutdown or drain before they are cancelled"`
+
+	BuildURLTemplate string `flag:"build-url-template" desc:"Template of URL of the page with build details"`
+	ContextTemplate  string `flag:"context-template" desc:"Template of the commit status context"`
+	NotifyWebhookURL string `flag:"notify-webhook-url" desc:"URL to post JSON notifications about every build to"`
+	NotifiersFile    string `flag:"notifiers-file" desc:"JSON file with notifiers of namespaces"`
+
+	Runner        string `flag:"runner" desc:"Runner to process tasks: local or kubernetes"`
+	KubeHost      string `flag:"kube-host" desc:"Kubernetes API server URL, in-cluster config is used if empty"`
+	KubeNamespace string `flag:"kube-namespace" desc:"Kubernetes namespace to run build jobs in"`
+	KubeImage     string `flag:"kube-image" desc:"Image to run build jobs with"`
+	KubeImages    string `flag:"kube-images" desc:"Images of Go versions for matrix builds, e.g. 1.10=golang:1.10,1.11=golang:1.11"`
+	KubePlatform  string `flag:"kube-platform" desc:"GOOS/GOARCH of nodes, tests of matrix builds for other platforms are only compiled"`
+
+	BuildTimeout time.Duration `flag:"build-timeout" desc:"Default limit of execution time of a build, zero means no limit"`
+	StepTimeout  time.Duration `flag:"step-timeout" desc:"Default limit of execution time of a build step, zero means no limit"`
+
+	QueueFile          string `flag:"queue-file" desc:"File to keep queued tasks between restarts, queue lives in memory if empty"`
+	RequeueInterrupted bool   `flag:"requeue-interrupted" desc:"Process tasks interrupted by restart again instead of marking them as errored"`
+	BuildsDir          string `flag:"builds-dir" desc:"Directory to keep build records, records live in memory if empty"`
+	LogsDir            string `flag:"logs-dir" desc:"Directory to keep build logs, temporary directory is used if empty"`
+
+	BuildsMaxAge    time.Duration `flag:"builds-max-age" desc:"Records of builds finished earlier are removed, zero means no limit"`
+	BuildsMaxBuilds int           `flag:"builds-max-builds" desc:"Records of only the latest finished builds are kept, zero means no limit"`
+
+	ArtifactsDir       string        `flag:"artifacts-dir" desc:"Directory to keep artifacts of builds, temporary directory is used if empty"`
+	ArtifactsMaxAge    time.Duration `flag:"artifacts-max-age" desc:"Artifacts of older builds are removed, zero means no limit"`
+	ArtifactsMaxBuilds int           `flag:"artifacts-max-builds" desc:"Artifacts of only the latest builds are kept, zero means no limit"`
+
+	MaxQueuedBuilds     int           `flag:"max-queued-builds" desc:"Maximum number of builds waiting for a worker, zero means no limit"`
+	MaxUserQueuedBuilds int           `flag:"max-user-queued-builds" desc:"Maximum number of builds of a user waiting for a worker, zero means no limit"`
+	MaxRepoQueuedBuilds int           `flag:"max-repo-queued-builds" desc:"Maximum number of builds of a repository waiting for a worker, zero means no limit"`
+	RetryAfter          time.Duration `flag:"retry-after" desc:"Delay suggested to clients whose builds are rejected because of the limits"`
+
+	WorkspaceDir      string `flag:"workspace-dir" desc:"Directory for workspaces of builds, temporary directory is used if empty"`
+	KeepWorkspaces    bool   `flag:"keep-workspaces" desc:"Keep workspaces of builds after processing for debugging"`
+	ParallelRepoTasks bool   `flag:"parallel-repo-tasks" desc:"Process builds of the same repository in the same time"`
+	SupersedeBuilds   bool   `flag:"supersede-builds" desc:"Cancel queued builds of a branch when a newer commit of the branch comes"`
+	SupersedeRunning  bool   `flag:"supersede-running" desc:"Cancel also running builds of a branch when a newer commit of the branch comes"`
+
+	GoProxy    string `flag:"go-proxy" desc:"GOPROXY of builds of repositories with go.mod"`
+	GoPrivate  string `flag:"go-private" desc:"GOPRIVATE of builds of repositories with go.mod"`
+	GoFlags    string `flag:"go-flags" desc:"GOFLAGS of builds of repositories with go.mod"`
+	GoModCache string `flag:"go-mod-cache" desc:"Module download cache shared by builds, it is created in workspace directory if empty"`
+
+	ToolchainsDir string `flag:"toolchains-dir" desc:"Directory with Go toolchains for matrix builds named by versions, e.g. go1.11"`
+
+	GitDepth           int    `flag:"git-depth" desc:"Depth of shallow clones of repositories, the whole history is fetched if zero"`
+	GitSubmodules      bool   `flag:"git-submodules" desc:"Check out submodules of repositories"`
+	GitMirrorDir       string `flag:"git-mirror-dir" desc:"Directory to keep bare mirrors of repositories, mirrors aren't used if empty"`
+	GitCredentialsFile string `flag:"git-credentials-file" desc:"JSON file with HTTPS tokens and SSH keys of git hosts"`
+
+	CoverageThreshold  float64 `flag:"coverage-threshold" desc:"Minimal coverage of the code by tests in percent, it isn't checked if zero"`
+	CoverageMaxDrop    float64 `flag:"coverage-max-drop" desc:"Allowed drop of coverage in percent against the last successful build of the base branch"`
+	CoverageBaseBranch string  `flag:"coverage-base-branch" desc:"Branch to compare coverage of builds with, coverage isn't compared if empty"`
+	CoverageFail       bool    `flag:"coverage-fail" desc:"Fail builds which violate coverage thresholds instead of marking them with warnings"`
+	CoverageFile       string  `flag:"coverage-file" desc:"File to keep coverage of base branches, it lives in memory if empty"`
+
+	SecretsFile string `flag:"secrets-file" desc:"Encrypted file with secrets of builds, SECRETS_KEY has to contain base64 of 32 bytes key"`
+	KubeContext string `flag:"kube-context" desc:"KUBE_CONTEXT of builds, the default of the Makefile is used if empty"`
+	Registry    string `flag:"registry" desc:"REGISTRY of builds, the default of the Makefile is used if empty"`
 }
 
 func main() {
 	// To be able to work under daemon we need to set some environment...
-	os.Setenv("GOPATH", "/root/go")
+	if len(os.Getenv("GOPATH")) == 0 {
+		os.Setenv("GOPATH", "/root/go")
+	}
 	os.Setenv("PATH", "$PATH:/bin:/snap/bin/:/usr/bin:/usr/local/bin:/usr/local/go/bin:/root/go/bin")
 	os.Setenv("HOME", "/root")
 
@@ -48,7 +125,28 @@ func main() {
 			Host: "0.0.0.0",
 			Port: 8080,
 		},
-		GHIntegrBaseURL: "https://services.k8s.community/github-integration",
+		GHIntegrBaseURL:  "https://services.k8s.community/github-integration",
+		BuildURLTemplate: notifier.DefaultBuildURL,
+		ContextTemplate:  notifier.DefaultContext,
+		Runner:           "local",
+		KubeNamespace:    "cicd",
+		KubeImage:        "golang:1.11",
+		BuildTimeout:     time.Hour,
+		StepTimeout:      30 * time.Minute,
+
+		MaxQueuedBuilds:     1000,
+		MaxUserQueuedBuilds: 100,
+		MaxRepoQueuedBuilds: 20,
+		RetryAfter:          time.Minute,
+
+		DrainTimeout: time.Minute,
+
+		ArtifactsMaxAge: 30 * 24 * time.Hour,
+
+		BuildsMaxAge:    30 * 24 * time.Hour,
+		BuildsMaxBuilds: 10000,
+
+		CoverageBaseBranch: "master",
 	}
 	err := gflag.ParseToDef(cfg)
 	if err != nil {
@@ -80,32 +178,147 @@ func main() {
 		ghIntBaseURL = cfg.GHIntegrBaseURL
 	}
 
-	logger.Infof("Github integration base URL is %s", ghIntBaseURL)
+	notifiers, err := newNotifiers(cfg, ghIntBaseURL, logger)
+	if err != nil {
+		logger.Fatalf("Couldn't prepare notifiers: %+v", err)
+	}
+
+	artifactsDir := cfg.ArtifactsDir
+	if len(artifactsDir) == 0 {
+		artifactsDir = filepath.Join(os.TempDir(), "cicd-artifacts")
+	}
+	artifacts, err := store.NewArtifacts(artifactsDir, store.Retention{MaxAge: cfg.ArtifactsMaxAge, MaxBuilds: cfg.ArtifactsMaxBuilds})
+	if err != nil {
+		logger.Fatalf("Couldn't open artifacts directory: %+v", err)
+	}
+	go expireArtifacts(artifacts, logger)
+
+	var secretStore *secrets.Store
+	if len(cfg.SecretsFile) > 0 {
+		key, err := base64.StdEncoding.DecodeString(os.Getenv("SECRETS_KEY"))
+		if err != nil {
+			logger.Fatalf("Couldn't decode SECRETS_KEY: %+v", err)
+		}
+		secretStore, err = secrets.NewStore(cfg.SecretsFile, key)
+		if err != nil {
+			logger.Fatalf("Couldn't open secrets file: %+v", err)
+		}
+	}
+
+	processor, err := newProcessor(cfg, log, artifacts, secretStore)
+	if err != nil {
+		logger.Fatalf("Couldn't prepare a runner: %+v", err)
+	}
 
-	ghIntClient, err := ghIntegr.NewClient(nil, ghIntBaseURL)
+	var options []builder.Option
+	if len(cfg.QueueFile) > 0 {
+		queue, err := store.NewFile(cfg.QueueFile)
+		if err != nil {
+			logger.Fatalf("Couldn't open queue file: %+v", err)
+		}
+		options = append(options, builder.WithQueueStore(queue, cfg.RequeueInterrupted))
+	}
+	if cfg.ParallelRepoTasks {
+		options = append(options, builder.WithParallelRepoTasks())
+	}
+	if cfg.SupersedeBuilds || cfg.SupersedeRunning {
+		options = append(options, builder.WithSupersede(cfg.SupersedeRunning))
+	}
+
+	state := builder.NewDispatcher(processor, logger, 10, options...)
+
+	buildsRetention := store.Retention{MaxAge: cfg.BuildsMaxAge, MaxBuilds: cfg.BuildsMaxBuilds}
+	var builds store.Builds = store.NewMemoryBuilds(buildsRetention)
+	if len(cfg.BuildsDir) == 0 {
+		logger.Warnf("Build records live in memory and are lost on restart, set builds-dir to keep them")
+	}
+	if len(cfg.BuildsDir) > 0 {
+		builds, err = store.NewDirBuilds(cfg.BuildsDir, buildsRetention)
+		if err != nil {
+			logger.Fatalf("Couldn't open build records directory: %+v", err)
+		}
+	}
+
+	logsDir := cfg.LogsDir
+	if len(logsDir) == 0 {
+		logsDir = filepath.Join(os.TempDir(), "cicd-logs")
+	}
+	logs, err := store.NewLogs(logsDir)
 	if err != nil {
-		logger.Fatalf("Couldn't get an instance of github-integration's service client: %+v", err)
+		logger.Fatalf("Couldn't open build logs directory: %+v", err)
 	}
+	go expireBuilds(builds, logs, cfg.BuildsMaxAge, logger)
 
-	// TODO: add graceful shutdown
-	runner := runners.NewLocal(log)
-	state := builder.NewDispatcher(runner.Process, logger, 10, 15*time.Second)
+	limits := handlers.Limits{
+		Queue:      cfg.MaxQueuedBuilds,
+		Namespace:  cfg.MaxUserQueuedBuilds,
+		Repository: cfg.MaxRepoQueuedBuilds,
+		RetryAfter: cfg.RetryAfter,
+	}
+	buildHandler := handlers.NewBuild(state, builds, logs, logger, notifiers, limits)
 
-	buildHandler := handlers.NewBuild(state, logger, ghIntClient)
+	err = state.Restore(buildHandler.RestoreTask)
+	if err != nil {
+		logger.Fatalf("Couldn't restore queued tasks: %+v", err)
+	}
 
 	r := router.New()
 
 	r.POST("/api/v1/build", buildHandler.Run)
+	r.GET("/api/v1/build/:requestID", buildHandler.Get)
+	r.GET("/api/v1/build/:requestID/log", buildHandler.Log)
+	r.GET("/api/v1/build/:requestID/tests", buildHandler.Tests)
+	artifactsHandler := handlers.NewArtifacts(builds, artifacts, logger)
+	r.GET("/api/v1/build/:requestID/artifacts", artifactsHandler.List)
+	r.GET("/api/v1/build/:requestID/artifacts/download", artifactsHandler.Download)
+	r.DELETE("/api/v1/build/:requestID", buildHandler.Cancel)
 	r.GET("/api/v1/status", buildHandler.Status)
 
+	webhookSecret, err := getFromEnv("GITHUB_WEBHOOK_SECRET")
+	if err != nil {
+		webhookSecret = cfg.WebhookSecret
+	}
+	if len(webhookSecret) > 0 {
+		webhookHandler := handlers.NewGitHubWebhook(buildHandler, webhookSecret, cfg.WebhookDeploy, logger)
+		r.POST("/api/v1/webhook/github", webhookHandler.Handle)
+	}
+
+	adminToken, err := getFromEnv("ADMIN_TOKEN")
+	if err != nil {
+		adminToken = cfg.AdminToken
+	}
+	adminHandler := handlers.NewAdmin(adminToken, buildHandler, secretStore, cfg.DrainTimeout, logger)
+	if len(adminToken) > 0 {
+		// the drain is one-way, the service has to be restarted after it
+		r.POST("/api/v1/admin/prepare-shutdown", adminHandler.PrepareShutdown)
+	}
+	if len(adminToken) > 0 && secretStore != nil {
+		r.GET("/api/v1/admin/secrets/:namespace", adminHandler.ListSecrets)
+		r.PUT("/api/v1/admin/secrets/:namespace/:name", adminHandler.SetSecret)
+		r.DELETE("/api/v1/admin/secrets/:namespace/:name", adminHandler.DeleteSecret)
+	}
+
 	r.GET("/info", info.Handler(version.RELEASE, version.REPO, version.COMMIT))
 	r.GET("/healthz", func(c *router.Control) {
 		c.Code(http.StatusOK).Body(http.StatusText(http.StatusOK))
 	})
+	r.GET("/metrics", func(c *router.Control) {
+		c.Writer.Header().Set("Content-Type", metrics.ContentType)
+		err := metrics.DefaultRegistry.Write(c.Writer)
+		if err != nil {
+			logger.Errorf("Couldn't write metrics: %s", err)
+		}
+	})
 
 	hostPort := fmt.Sprintf("%s:%s", serviceHost, servicePort)
 	logger.Infof("Ready to listen %s. Routes: %+v", hostPort, r.Routes())
-	go r.Listen(hostPort)
+	server := &http.Server{Addr: hostPort, Handler: r}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logger.Fatalf("Couldn't listen %s: %s", hostPort, err)
+		}
+	}()
 
 	// Set up channel on which to send signal notifications.
 	// We must use a buffered channel or risk missing the signal
@@ -114,7 +327,7 @@ func main() {
 	signal.Notify(interrupt, os.Interrupt, os.Kill, syscall.SIGTERM)
 	killSignal := <-interrupt
 	logger.Infof("Got signal: %s", killSignal)
-	status, err = shutdown()
+	status, err = shutdown(server, adminHandler, cfg.DrainTimeout)
 	if err != nil {
 		logger.Fatalf("Error: %s Status: %s\n", err.Error(), status)
 	}
@@ -123,10 +336,212 @@ func main() {
 	} else {
 		logger.Infof("Service was terminated by system signal")
 	}
-	logger.Infof(status)
+	logger.Info(status)
+}
+
+func newProcessor(cfg *Config, log *logrus.Logger, artifacts *store.Artifacts, secretStore *secrets.Store) (builder.Processor, error) {
+	timeouts := runners.Timeouts{Task: cfg.BuildTimeout, Step: cfg.StepTimeout}
+
+	switch cfg.Runner {
+	case "local":
+		gitConfig := source.GitConfig{
+			Depth:      cfg.GitDepth,
+			Submodules: cfg.GitSubmodules,
+			MirrorDir:  cfg.GitMirrorDir,
+		}
+		if len(cfg.GitCredentialsFile) > 0 {
+			var err error
+			gitConfig.Credentials, err = source.LoadCredentials(cfg.GitCredentialsFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		baselines, err := store.NewBaselines(cfg.CoverageFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(cfg.CoverageBaseBranch) > 0 && len(cfg.CoverageFile) == 0 {
+			log.Warnf("Coverage of the base branch lives in memory and is lost on restart, set coverage-file to keep it")
+		}
+
+		var toolchains map[string]string
+		if len(cfg.ToolchainsDir) > 0 {
+			toolchains, err = runners.FindToolchains(cfg.ToolchainsDir)
+			if err != nil {
+				return nil, err
+			}
+			log.Infof("Go toolchains for matrix builds: %v", toolchains)
+		}
+
+		localConfig := runners.LocalConfig{
+			Timeouts:       timeouts,
+			WorkspaceDir:   cfg.WorkspaceDir,
+			KeepWorkspaces: cfg.KeepWorkspaces,
+			Source:         source.NewGit(gitConfig),
+			Modules: runners.ModulesConfig{
+				Proxy:   cfg.GoProxy,
+				Private: cfg.GoPrivate,
+				Flags:   cfg.GoFlags,
+				Cache:   cfg.GoModCache,
+			},
+			Artifacts: artifacts,
+			Env:       buildEnv(cfg),
+			Coverage: runners.CoverageConfig{
+				Thresholds: coverage.Thresholds{Minimum: cfg.CoverageThreshold, MaxDrop: cfg.CoverageMaxDrop},
+				BaseBranch: cfg.CoverageBaseBranch,
+				Baselines:  baselines,
+				Fail:       cfg.CoverageFail,
+			},
+			Toolchains: toolchains,
+		}
+		if secretStore != nil {
+			localConfig.Secrets = secretStore
+		}
+		return runners.NewLocal(log, localConfig).Process, nil
+	case "kubernetes":
+		kubeConfig := runners.KubernetesConfig{
+			Host:  cfg.KubeHost,
+			Token: os.Getenv("KUBE_TOKEN"),
+		}
+		if len(kubeConfig.Host) == 0 {
+			var err error
+			kubeConfig, err = runners.InClusterKubernetesConfig()
+			if err != nil {
+				return nil, err
+			}
+		}
+		kubeConfig.Namespace = cfg.KubeNamespace
+		kubeConfig.Image = cfg.KubeImage
+		kubeConfig.Platform = cfg.KubePlatform
+		kubeConfig.Images = make(map[string]string)
+		for _, pair := range strings.Split(cfg.KubeImages, ",") {
+			if len(pair) == 0 {
+				continue
+			}
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("wrong image of Go version %q, it has to be version=image", pair)
+			}
+			kubeConfig.Images[parts[0]] = parts[1]
+		}
+		kubeConfig.Timeouts = timeouts
+		kubeConfig.Env = buildEnv(cfg)
+		kubeConfig.MakefileTemplate = os.Getenv("GOPATH") + "/src/github.com/k8s-community/cicd/templates/Makefile.tpl"
+		if secretStore != nil {
+			kubeConfig.Secrets = secretStore
+		}
+
+		return runners.NewKubernetes(log, kubeConfig).Process, nil
+	}
+
+	return nil, fmt.Errorf("unknown runner %s", cfg.Runner)
+}
+
+// buildEnv returns the environment added to builds of all repositories,
+// empty variables are skipped to keep defaults of Makefiles of repositories
+func buildEnv(cfg *Config) []string {
+	var env []string
+	if len(cfg.KubeContext) > 0 {
+		env = append(env, "KUBE_CONTEXT="+cfg.KubeContext)
+	}
+	if len(cfg.Registry) > 0 {
+		env = append(env, "REGISTRY="+cfg.Registry)
+	}
+	return env
+}
+
+func newNotifiers(cfg *Config, ghIntBaseURL string, logger logrus.FieldLogger) (*notifier.Registry, error) {
+	templates, err := notifier.NewTemplates(cfg.BuildURLTemplate, cfg.ContextTemplate)
+	if err != nil {
+		return nil, err
+	}
+	notifiers := notifier.NewRegistry(logger, templates)
+
+	var github *notifier.GitHubIntegration
+	if len(ghIntBaseURL) > 0 {
+		logger.Infof("Github integration base URL is %s", ghIntBaseURL)
+
+		ghIntClient, err := ghIntegr.NewClient(nil, ghIntBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get an instance of github-integration's service client: %s", err)
+		}
+		github = notifier.NewGitHubIntegration(ghIntClient)
+		notifiers.Register("", github)
+	}
+
+	if len(cfg.NotifyWebhookURL) > 0 {
+		webhook := notifier.NewWebhook(nil, cfg.NotifyWebhookURL, os.Getenv("NOTIFY_WEBHOOK_SECRET"))
+		notifiers.Register("", notifier.NewAsync(webhook, notifier.WebhookQueueSize, logger))
+	}
+
+	if len(cfg.NotifiersFile) > 0 {
+		err = notifiers.Load(cfg.NotifiersFile, github)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return notifiers, nil
+}
+
+// expireArtifacts removes artifacts according to the retention rules every hour
+func expireArtifacts(artifacts *store.Artifacts, logger logrus.FieldLogger) {
+	for now := time.Now(); ; now = <-time.After(time.Hour) {
+		removed, err := artifacts.Expire(now)
+		if err != nil {
+			logger.Errorf("Couldn't remove expired artifacts: %s", err)
+		}
+		if len(removed) > 0 {
+			logger.Infof("Artifacts of %d builds are expired", len(removed))
+		}
+	}
 }
 
-func shutdown() (string, error) {
+// expireBuilds removes records and logs of finished builds according to the retention rules every hour,
+// logs of builds without records are removed after maxAge
+func expireBuilds(builds store.Builds, logs *store.Logs, maxAge time.Duration, logger logrus.FieldLogger) {
+	for now := time.Now(); ; now = <-time.After(time.Hour) {
+		removed, err := builds.Expire(now)
+		if err != nil {
+			logger.Errorf("Couldn't remove expired build records: %s", err)
+		}
+		for _, id := range removed {
+			err = logs.Remove(id)
+			if err != nil {
+				logger.Errorf("Couldn't remove log of the expired build %s: %s", id, err)
+			}
+		}
+		if len(removed) > 0 {
+			logger.Infof("Records of %d builds are expired", len(removed))
+		}
+
+		orphans, err := logs.Expire(now, maxAge)
+		if err != nil {
+			logger.Errorf("Couldn't remove expired build logs: %s", err)
+		}
+		if len(orphans) > 0 {
+			logger.Infof("Logs of %d builds are expired", len(orphans))
+		}
+	}
+}
+
+// shutdown drains the service: new builds are rejected, running builds are waited for drainTimeout
+// while status and logs are still served, then the HTTP server is stopped
+func shutdown(server *http.Server, admin *handlers.Admin, drainTimeout time.Duration) (string, error) {
+	admin.Drain(drainTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		// followers of build logs might keep their connections open
+		err = server.Close()
+	}
+	if err != nil {
+		return "Couldn't stop HTTP server", err
+	}
 	return "Shutdown", nil
 }
 
@@ -5,9 +5,14 @@ REGISTRY?=gcr.io/containers-206912
 
 # Use the 0.0.0 tag for testing, it shouldn't clobber any release builds
 RELEASE?=1.2.3
+
+# Target platform, cells of matrix builds of the CI/CD service set their own platforms
 GOOS?=linux
 GOARCH?=amd64
 
+# Flags of go test, the CI/CD service sets -json to parse results of tests
+TESTFLAGS?=-v
+
 # Namespace: dev, prod, release, cte, username ...
 NAMESPACE?=k8s-community
 
@@ -67,7 +72,13 @@ deploy: push
 .PHONY: test
 test: clean
 	@echo "+ $@"
-	go test -v -race ./...
+	go test ${TESTFLAGS} -race ./...
+
+.PHONY: compile
+compile: clean
+	@echo "+ $@"
+	CGO_ENABLED=0 GOOS=${GOOS} GOARCH=${GOARCH} go build ./...
+	CGO_ENABLED=0 GOOS=${GOOS} GOARCH=${GOARCH} go vet ./...
 
 .PHONY: clean
 clean: